@@ -3,15 +3,33 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // array of all pieces on a given board
 type Board struct {
 	Board []*Piece // all of the pieces on the board
 	Turn  int      // 1 : white , -1 : black
+
+	listeners []Listener
+}
+
+// Returns a deep copy of the board, so that it can be modified without affecting the original.
+// Listeners are not copied.
+func (b *Board) Copy() *Board {
+	newboard := &Board{
+		Board: make([]*Piece, len(b.Board)),
+		Turn:  b.Turn,
+	}
+	for i, p := range b.Board {
+		piece := *p
+		newboard.Board[i] = &piece
+	}
+	return newboard
 }
 
 // Converts the board to an array of strings, ready for printing or conversion to FEN.
@@ -78,6 +96,94 @@ func (b *Board) ToFen() string {
 	return string(fen)
 }
 
+// Sets up a board from a position in FEN.
+// Only the piece placement and the turn are required, as produced by ToFen; castling rights and the
+// en passant square are read if present and the move counters are ignored.
+// Kings are placed first, as IsCheck expects.
+func FromFen(fen string) (*Board, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 2 {
+		return nil, errors.New("func FromFen: missing turn")
+	}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return nil, errors.New("func FromFen: expected 8 ranks")
+	}
+	b := &Board{Board: make([]*Piece, 0)}
+	switch fields[1] {
+	case "w":
+		b.Turn = 1
+	case "b":
+		b.Turn = -1
+	default:
+		return nil, errors.New("func FromFen: invalid turn")
+	}
+	others := &Board{}
+	for i, rank := range ranks {
+		y := 8 - i
+		x := 1
+		for _, c := range rank {
+			if '1' <= c && c <= '8' {
+				x += int(c - '0')
+				continue
+			}
+			name := byte(unicode.ToLower(c))
+			if !strings.ContainsRune("pnbrqk", rune(name)) || x > 8 {
+				return nil, errors.New("func FromFen: invalid piece placement")
+			}
+			color := -1
+			if unicode.IsUpper(c) {
+				color = 1
+			}
+			if name == 'k' {
+				b.PlacePiece(name, color, x, y)
+			} else {
+				others.PlacePiece(name, color, x, y)
+			}
+			x++
+		}
+		if x != 9 {
+			return nil, errors.New("func FromFen: rank does not have 8 squares")
+		}
+	}
+	if len(b.Board) != 2 || b.Board[0].Color == b.Board[1].Color {
+		return nil, errors.New("func FromFen: expected one king of each color")
+	}
+	if b.Board[0].Color == -1 {
+		b.Board[0], b.Board[1] = b.Board[1], b.Board[0]
+	}
+	b.Board = append(b.Board, others.Board...)
+	if len(fields) > 2 && fields[2] != "-" {
+		for _, c := range fields[2] {
+			color, y, rookx := 1, 1, 8
+			if unicode.IsLower(c) {
+				color, y = -1, 8
+			}
+			if unicode.ToLower(c) == 'q' {
+				rookx = 1
+			}
+			for _, p := range b.Board {
+				if p.Color == color && p.Position.Y == y && (p.Name == 'k' || (p.Name == 'r' && p.Position.X == rookx)) {
+					p.Can_castle = true
+				}
+			}
+		}
+	}
+	if len(fields) > 3 && fields[3] != "-" && len(fields[3]) == 2 {
+		x := strings.IndexByte(string(Files), fields[3][0]) + 1
+		y := 5
+		if b.Turn == -1 {
+			y = 4
+		}
+		for _, p := range b.Board {
+			if p.Name == 'p' && p.Position.X == x && p.Position.Y == y {
+				p.Can_en_passant = true
+			}
+		}
+	}
+	return b, nil
+}
+
 // Checks if a king is in check.
 // Pass the color of the king that you want to check.
 // Returns true if king in check / false if not.
@@ -125,6 +231,32 @@ func (b *Board) IsOver() int {
 	return 0
 }
 
+// Checks if neither side has the material to deliver mate, in which case the game is a draw.
+// That is bare kings, a king and a single minor piece against a bare king, or bishops all on squares of one color.
+func (b *Board) InsufficientMaterial() bool {
+	var knights, bishops int
+	var bishopcolors [2]bool
+	for _, p := range b.Board {
+		if p.Captured {
+			continue
+		}
+		switch p.Name {
+		case 'k':
+		case 'n':
+			knights++
+		case 'b':
+			bishops++
+			bishopcolors[(p.Position.X+p.Position.Y)%2] = true
+		default:
+			return false
+		}
+	}
+	if knights+bishops <= 1 {
+		return true
+	}
+	return knights == 0 && !(bishopcolors[0] && bishopcolors[1])
+}
+
 // Given a name, color, and coordinates, place the appropriate piece on the board.
 // Does not add flags such as Can_Castle, must be done manually.
 func (b *Board) PlacePiece(name byte, color, x, y int) {
@@ -125,6 +125,14 @@ func TestAttacking(t *testing.T) {
 	if rook.Attacking(s, board) {
 		t.Errorf("Rook attacking through own piece, should not be attacking %+v from %+v", s, rook.Position)
 	}
+	s.X, s.Y = 3, 5
+	if rook.Attacking(s, board) {
+		t.Errorf("Rook attacking off its lines, should not be attacking %+v from %+v", s, rook.Position)
+	}
+	king := board.Board[0]
+	if king.Attacking(s, board) {
+		t.Errorf("King attacking a distant square, should not be attacking %+v from %+v", s, king.Position)
+	}
 }
 
 func TestMakeMoveTo(t *testing.T) {
@@ -419,6 +427,13 @@ func TestLegalMoves(t *testing.T) {
 	if numlegalmoves := len(board.Board[0].legalMoves(board, false)); numlegalmoves == 1 {
 		t.Error("Only one legal move recognized for promoting pawn")
 	}
+	promotions := make(map[byte]bool)
+	for _, m := range board.Board[0].legalMoves(board, false) {
+		promotions[m.Promotion] = true
+	}
+	if len(promotions) != 4 || promotions[0] {
+		t.Errorf("Promoting pawn should offer four distinct promotions, got %v", promotions)
+	}
 	board = &Board{Turn: 1}
 	board.PlacePiece('k', 1, 1, 1)
 	if numlegalmoves := len(board.Board[0].legalMoves(board, true)); numlegalmoves != 3 {
@@ -468,8 +483,8 @@ func TestLegalMoves(t *testing.T) {
 	for _, m := range board.Board[1].legalMoves(board, true) {
 		if m.End.X == 1 && m.End.Y == 2 {
 			if m.Capture != 0 {
-				break
 				t.Errorf("Capturing a previously captured piece gave capture %s", string(m.Capture))
+				break
 			} else {
 				break
 			}
@@ -552,3 +567,163 @@ func TestToFen(t *testing.T) {
 		t.Errorf("After 1.e4 expected fen:\n%s\nInstead got:\n%s\n", "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b", fen)
 	}
 }
+
+func TestFromFen(t *testing.T) {
+	start := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	board, err := FromFen(start)
+	if err != nil {
+		t.Fatalf("Initial position gave error %s", err)
+	}
+	if fen := board.ToFen(); fen != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w" {
+		t.Errorf("Initial position read back as %s", fen)
+	}
+	if board.Board[0].Name != 'k' || board.Board[0].Color != 1 || board.Board[1].Name != 'k' || board.Board[1].Color != -1 {
+		t.Error("Kings were not placed first")
+	}
+	setup := &Board{Turn: 1}
+	setup.SetUpPieces()
+	if board.Hash() != setup.Hash() {
+		t.Error("Castling rights differ from SetUpPieces")
+	}
+	board, err = FromFen("4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1")
+	if err != nil {
+		t.Fatalf("En passant position gave error %s", err)
+	}
+	var enpassant bool
+	for _, m := range board.AllLegalMoves() {
+		if m.Piece == 'p' && m.End.X == 4 && m.End.Y == 6 {
+			enpassant = true
+		}
+	}
+	if !enpassant {
+		t.Error("En passant square was not read")
+	}
+	for _, fen := range []string{"8/8/8/8/8/8/8/8 w", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR", "rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w"} {
+		if _, err := FromFen(fen); err == nil {
+			t.Errorf("Invalid FEN %s did not give an error", fen)
+		}
+	}
+}
+
+func TestPawnHash(t *testing.T) {
+	board, _ := FromFen("4k3/p7/8/8/8/8/P7/4K3 w")
+	moved, _ := FromFen("3k4/p7/8/8/8/8/P7/3K4 b")
+	if board.PawnHash() != moved.PawnHash() || board.Hash() == moved.Hash() {
+		t.Error("Expected the pawn hash to ignore the kings and the turn")
+	}
+	pushed, _ := FromFen("4k3/p7/8/8/8/P7/8/4K3 w")
+	if board.PawnHash() == pushed.PawnHash() {
+		t.Error("Expected the pawn hash to change when a pawn moves")
+	}
+	if empty, _ := FromFen("4k3/8/8/8/8/8/8/4K3 w"); empty.PawnHash() != 0 {
+		t.Error("Expected a board without pawns to have a pawn hash of 0")
+	}
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	for fen, expected := range map[string]bool{
+		"8/8/4k3/8/8/3K4/8/8 w":      true,
+		"8/8/4k3/8/8/3KN3/8/8 w":     true,
+		"8/8/4kb2/8/8/3KB3/8/8 w":    true,  // both bishops on light squares
+		"8/8/4k1b1/8/8/3KB3/8/8 w":   false, // bishops on opposite colors
+		"8/8/4kn2/8/8/3KN3/8/8 w":    false,
+		"8/8/4k3/8/8/3KP3/8/8 w":     false,
+		"8/8/4k3/8/8/3KBN2/8/8 w":    false,
+		"rnbqkbnr/8/8/8/8/8/8/4K3 w": false,
+	} {
+		board, err := FromFen(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board.InsufficientMaterial() != expected {
+			t.Errorf("Expected insufficient material to be %t in %s", expected, fen)
+		}
+	}
+}
+
+type countingListener struct {
+	squares map[Square]int // pieces added minus pieces removed on each square
+	names   map[byte]int   // the same by piece
+}
+
+func (l *countingListener) Added(name byte, color int, s Square) {
+	l.squares[s]++
+	l.names[name]++
+}
+
+func (l *countingListener) Removed(name byte, color int, s Square) {
+	l.squares[s]--
+	l.names[name]--
+}
+
+func TestListener(t *testing.T) {
+	board, err := FromFen("4k3/1P6/8/8/8/8/7r/4K3 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &countingListener{squares: make(map[Square]int), names: make(map[byte]int)}
+	board.AddListener(l)
+	var promotion *Move
+	for _, m := range board.AllLegalMoves() {
+		if m.Piece == 'p' && m.Promotion == 'q' {
+			promotion = m
+		}
+	}
+	board.ForceMove(promotion)
+	if l.squares[Square{X: 2, Y: 7}] != -1 || l.squares[Square{X: 2, Y: 8}] != 1 || l.names['p'] != -1 || l.names['q'] != 1 {
+		t.Errorf("Expected a pawn removed from b7 and a queen added on b8, got %v and %v", l.squares, l.names)
+	}
+	board.UndoMove(promotion)
+	for s, n := range l.squares {
+		if n != 0 {
+			t.Errorf("Expected taking the move back to restore %s, got %d", s.ToString(), n)
+		}
+	}
+	board.RemoveListener(l)
+	board.ForceMove(promotion)
+	if l.names['q'] != 0 {
+		t.Error("Removed listener was still told about a move")
+	}
+}
+
+type nopListener struct{}
+
+func (nopListener) Added(name byte, color int, s Square)   {}
+func (nopListener) Removed(name byte, color int, s Square) {}
+
+func TestListenerCastleAndCapture(t *testing.T) {
+	board, err := FromFen("r3k3/8/8/8/8/8/8/R3K2R w KQq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &countingListener{squares: make(map[Square]int), names: make(map[byte]int)}
+	board.AddListener(l)
+	castle := &Move{Piece: 'k', Begin: Square{X: 5, Y: 1}, End: Square{X: 7, Y: 1}}
+	board.ForceMove(castle)
+	if l.squares[Square{X: 8, Y: 1}] != -1 || l.squares[Square{X: 6, Y: 1}] != 1 || l.names['r'] != 0 || l.names['k'] != 0 {
+		t.Errorf("Expected the king and rook moved, got %v and %v", l.squares, l.names)
+	}
+	board.UndoMove(castle)
+	capture := &Move{Piece: 'r', Begin: Square{X: 1, Y: 1}, End: Square{X: 1, Y: 8}, Capture: 'r'}
+	board.ForceMove(capture)
+	if l.squares[Square{X: 1, Y: 8}] != 0 || l.squares[Square{X: 1, Y: 1}] != -1 || l.names['r'] != -1 {
+		t.Errorf("Expected a rook taken on a8, got %v and %v", l.squares, l.names)
+	}
+	board.UndoMove(capture)
+	for s, n := range l.squares {
+		if n != 0 {
+			t.Errorf("Expected taking the moves back to restore %s, got %d", s.ToString(), n)
+		}
+	}
+	board.RemoveListener(l)
+
+	// telling listeners about a move must not cost an allocation
+	board.AddListener(nopListener{})
+	allocs := testing.AllocsPerRun(100, func() {
+		board.ForceMove(capture)
+		board.UndoMove(capture)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations to make and take back a move, got %v", allocs)
+	}
+}
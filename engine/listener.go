@@ -0,0 +1,64 @@
+package engine
+
+// Told about every piece put on or taken off a square as moves are made and taken back, so that values that
+// depend on where the pieces stand can be kept up to date instead of being worked out again for every position.
+// A move tells its listeners that the moving piece was removed from its old square and added on its new one,
+// along with any piece it captures, a rook that castles with it and the piece a pawn promotes to.
+type Listener interface {
+	Added(name byte, color int, s Square)
+	Removed(name byte, color int, s Square)
+}
+
+// A piece as it stood before a move changed it, to tell listeners what the move changed.
+type pieceState struct {
+	index    int // in Board.Board
+	name     byte
+	position Square
+	captured bool
+}
+
+// The pieces a move changes: the one moving, one it captures and a rook castling with it.
+type moveChanges struct {
+	pieces [3]pieceState
+	n      int
+}
+
+// Records the piece at index i as it stands before the move changes it.
+func (c *moveChanges) record(b *Board, i int) {
+	p := b.Board[i]
+	c.pieces[c.n] = pieceState{index: i, name: p.Name, position: p.Position, captured: p.Captured}
+	c.n++
+}
+
+// Starts telling l about the pieces moved on the board.
+func (b *Board) AddListener(l Listener) {
+	b.listeners = append(b.listeners, l)
+}
+
+// Stops telling l about the pieces moved on the board.
+func (b *Board) RemoveListener(l Listener) {
+	for i, listener := range b.listeners {
+		if listener == l {
+			b.listeners = append(b.listeners[:i], b.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// Tells the listeners about the pieces recorded in c, now that the move has changed them.
+func (b *Board) notify(c *moveChanges) {
+	for _, old := range c.pieces[:c.n] {
+		p := b.Board[old.index]
+		if old.name == p.Name && old.position == p.Position && old.captured == p.Captured {
+			continue
+		}
+		for _, l := range b.listeners {
+			if !old.captured {
+				l.Removed(old.name, p.Color, old.position)
+			}
+			if !p.Captured {
+				l.Added(p.Name, p.Color, p.Position)
+			}
+		}
+	}
+}
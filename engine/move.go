@@ -6,7 +6,7 @@ import "errors"
 type Move struct {
 	Piece      byte // Piece.Name
 	Begin, End Square
-	Score      float64
+	Score      int
 	Promotion  byte
 	Capture    byte
 }
@@ -42,7 +42,7 @@ func (p *Piece) makeMoveTo(x, y int) *Move {
 // Returns a pointer to a copy of a move.
 // Does not copy move's score.
 func (m *Move) CopyMove() *Move {
-	newmove := &Move{Piece: m.Piece}
+	newmove := &Move{Piece: m.Piece, Promotion: m.Promotion, Capture: m.Capture}
 	newmove.Begin.X, newmove.Begin.Y = m.Begin.X, m.Begin.Y
 	newmove.End.X, newmove.End.Y = m.End.X, m.End.Y
 	return newmove
@@ -55,12 +55,17 @@ func (m *Move) ToString() string {
 
 // Modifies a board in-place to undo a given move
 func (b *Board) UndoMove(m *Move) {
+	var changes moveChanges
+	if len(b.listeners) > 0 {
+		defer b.notify(&changes)
+	}
 	var pieceadded bool
 	var piecemoved bool
 	for i, p := range b.Board {
 		if p.Position == m.End {
 			if p.Color == b.Turn*-1 {
 				if !piecemoved && !p.Captured {
+					changes.record(b, i)
 					b.Board[i].Position = m.Begin
 					piecemoved = true
 					if m.Piece == 'p' && b.Board[i].Name != 'p' {
@@ -76,9 +81,11 @@ func (b *Board) UndoMove(m *Move) {
 							for i, p := range b.Board {
 								if p.Name == 'r' && p.Color == b.Turn*-1 && !p.Captured && p.Position.Y == m.Begin.Y {
 									if m.End.X == 3 && p.Position.X == 4 {
+										changes.record(b, i)
 										b.Board[i].Position.X = 1
 										break
 									} else if m.End.X == 7 && p.Position.X == 6 {
+										changes.record(b, i)
 										b.Board[i].Position.X = 8
 										break
 									}
@@ -89,6 +96,7 @@ func (b *Board) UndoMove(m *Move) {
 				}
 			} else {
 				if p.Captured && p.Name == m.Capture && !pieceadded {
+					changes.record(b, i)
 					b.Board[i].Captured = false
 					pieceadded = true
 				}
@@ -101,9 +109,14 @@ func (b *Board) UndoMove(m *Move) {
 // Modifies a bord in-place.
 // Forces a piece to a given square without checking move legality.
 func (b *Board) ForceMove(m *Move) {
+	var changes moveChanges
+	if len(b.listeners) > 0 {
+		defer b.notify(&changes)
+	}
 	for i, p := range b.Board {
 		if !p.Captured {
 			if m.Begin == p.Position {
+				changes.record(b, i)
 				b.Board[i].Position.X, b.Board[i].Position.Y = m.End.X, m.End.Y
 				if m.Piece == 'p' {
 					if (p.Color == 1 && m.End.Y == 8) || (p.Color == -1 && m.End.Y == 1) {
@@ -158,9 +171,11 @@ func (b *Board) ForceMove(m *Move) {
 						for i, p := range b.Board {
 							if p.Name == 'r' && p.Color == b.Turn && !p.Captured && p.Position.Y == m.Begin.Y {
 								if m.End.X == 3 && p.Position.X == 1 {
+									changes.record(b, i)
 									b.Board[i].Position.X = 4
 									break
 								} else if m.End.X == 7 && p.Position.X == 8 {
+									changes.record(b, i)
 									b.Board[i].Position.X = 6
 									break
 								}
@@ -169,6 +184,7 @@ func (b *Board) ForceMove(m *Move) {
 					}
 				}
 			} else if p.Position.X == m.End.X && p.Position.Y == m.End.Y {
+				changes.record(b, i)
 				b.Board[i].Captured = true
 			}
 		}
@@ -181,6 +197,10 @@ func (b *Board) ForceMove(m *Move) {
 // Sets a captured piece's location to (0, 0)
 // Changes the turn of the board once move is successfully completed.
 func (b *Board) Move(m *Move) error {
+	var changes moveChanges
+	if len(b.listeners) > 0 {
+		defer b.notify(&changes)
+	}
 	if m.Piece == 'k' && m.Begin.X-m.End.X != 1 && m.End.X-m.Begin.X != 1 {
 		if (b.Turn == 1 && m.End.Y != 1) || (b.Turn == -1 && m.End.Y != 8) {
 			return errors.New("func Move: illegal move")
@@ -196,7 +216,7 @@ func (b *Board) Move(m *Move) error {
 		if !b.can_castle(side) {
 			return errors.New("func can_castle: cannot castle")
 		}
-		err := b.castleHandler(m, side)
+		err := b.castleHandler(m, side, &changes)
 		if err == nil {
 			b.Turn *= -1
 		}
@@ -227,6 +247,7 @@ func (b *Board) Move(m *Move) error {
 	for _, move := range legals {
 		if m.Begin == move.Begin && m.End == move.End && m.Piece == move.Piece {
 			legal = true
+			changes.record(b, pieceindex)
 			b.Board[pieceindex].Position = move.End
 			break
 		}
@@ -247,6 +268,7 @@ func (b *Board) Move(m *Move) error {
 	}
 
 	if capture {
+		changes.record(b, capturedpiece)
 		b.Board[capturedpiece].Captured = true
 	}
 	if m.Piece == 'k' || m.Piece == 'r' {
@@ -356,7 +378,7 @@ func (b *Board) can_castle(side int) bool {
 	return true
 }
 
-func (b *Board) castleHandler(m *Move, side int) error {
+func (b *Board) castleHandler(m *Move, side int, changes *moveChanges) error {
 	var rookindex int
 	var kingindex int
 	if b.Turn == 1 {
@@ -373,6 +395,8 @@ func (b *Board) castleHandler(m *Move, side int) error {
 	if rookindex == 0 {
 		return errors.New("func castleHandler: should have found rook")
 	}
+	changes.record(b, kingindex)
+	changes.record(b, rookindex)
 	b.Board[kingindex].Position = m.End
 	if side == 8 {
 		b.Board[rookindex].Position.X = 6
@@ -69,7 +69,7 @@ func (p *Piece) Attacking(s *Square, b *Board) bool {
 			}
 		}
 	}
-	return true
+	return false
 }
 
 // Returns true if a move places the mover in check
@@ -171,11 +171,11 @@ func (p *Piece) legalMoves(b *Board, checkcheck bool) []*Move {
 						move := m.CopyMove()
 						move.Promotion = promotion
 						if checkcheck {
-							if !moveIsCheck(b, m) {
-								legals = append(legals, m)
+							if !moveIsCheck(b, move) {
+								legals = append(legals, move)
 							}
 						} else {
-							legals = append(legals, m)
+							legals = append(legals, move)
 						}
 					}
 				} else {
@@ -205,11 +205,11 @@ func (p *Piece) legalMoves(b *Board, checkcheck bool) []*Move {
 						move := m.CopyMove()
 						move.Promotion = promotion
 						if checkcheck {
-							if !moveIsCheck(b, m) {
-								legals = append(legals, m)
+							if !moveIsCheck(b, move) {
+								legals = append(legals, move)
 							}
 						} else {
-							legals = append(legals, m)
+							legals = append(legals, move)
 						}
 					}
 				} else {
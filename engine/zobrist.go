@@ -0,0 +1,93 @@
+package engine
+
+import "math/rand"
+
+// Zobrist hashing: every feature of a position is given a random number, and a position hashes to the xor of
+// the numbers of its features.
+// See: https://www.chessprogramming.org/Zobrist_Hashing
+var (
+	zobristPieces    [2][6][8][8]uint64 // by color, piece, file and rank
+	zobristCastle    [2][8]uint64       // by color and file of a king or rook that may still castle
+	zobristEnPassant [8]uint64          // by file of a pawn that may be captured en passant
+	zobristTurn      uint64             // black to move
+)
+
+func init() {
+	r := rand.New(rand.NewSource(20140501))
+	for c := range zobristPieces {
+		for p := range zobristPieces[c] {
+			for x := range zobristPieces[c][p] {
+				for y := range zobristPieces[c][p][x] {
+					zobristPieces[c][p][x][y] = r.Uint64()
+				}
+			}
+		}
+		for x := range zobristCastle[c] {
+			zobristCastle[c][x] = r.Uint64()
+		}
+	}
+	for x := range zobristEnPassant {
+		zobristEnPassant[x] = r.Uint64()
+	}
+	zobristTurn = r.Uint64()
+}
+
+// Index of a piece name in the Zobrist tables.
+func pieceIndex(name byte) int {
+	switch name {
+	case 'p':
+		return 0
+	case 'n':
+		return 1
+	case 'b':
+		return 2
+	case 'r':
+		return 3
+	case 'q':
+		return 4
+	}
+	return 5
+}
+
+// Index of a color in the Zobrist tables.
+func colorIndex(color int) int {
+	if color == 1 {
+		return 0
+	}
+	return 1
+}
+
+// Returns the Zobrist hash of the position, including the turn, castling rights and en passant captures.
+// Two boards holding the same position hash the same regardless of the order of their pieces.
+func (b *Board) Hash() uint64 {
+	var hash uint64
+	for _, p := range b.Board {
+		if p.Captured {
+			continue
+		}
+		c := colorIndex(p.Color)
+		hash ^= zobristPieces[c][pieceIndex(p.Name)][p.Position.X-1][p.Position.Y-1]
+		if p.Can_castle && (p.Name == 'k' || p.Name == 'r') {
+			hash ^= zobristCastle[c][p.Position.X-1]
+		}
+		if p.Can_en_passant {
+			hash ^= zobristEnPassant[p.Position.X-1]
+		}
+	}
+	if b.Turn == -1 {
+		hash ^= zobristTurn
+	}
+	return hash
+}
+
+// Returns the Zobrist hash of the pawns alone, for caching evaluation terms that only depend on the pawns.
+// It is 0 when there are no pawns on the board.
+func (b *Board) PawnHash() uint64 {
+	var hash uint64
+	for _, p := range b.Board {
+		if !p.Captured && p.Name == 'p' {
+			hash ^= zobristPieces[colorIndex(p.Color)][0][p.Position.X-1][p.Position.Y-1]
+		}
+	}
+	return hash
+}
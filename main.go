@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jacobroberts/chess/engine"
@@ -25,6 +34,23 @@ const (
 </head>
 <body>
 	<div id="board" style="width: 400px"></div>
+	<p>
+		Level <select id="level"></select>
+		<button id="newgame">New game</button>
+	</p>
+	<script>
+		// levels from 0 to search.MAXSKILL, the one the game was started at selected
+		var started = /level=(\d+)/.exec(location.search);
+		for (var level = 0; level <= %[1]d; level++) {
+			$("#level").append($("<option>").val(level).text(level).prop("selected", level == (started ? started[1] : %[1]d)));
+		}
+		$("#newgame").click(function() {
+			var level = $("#level").val();
+			$.post("/new", {level: level}, function() {
+				location.search = "level=" + level;
+			});
+		});
+	</script>
 	<script src="http://csmarlboro.org/jacobr/chess/js/chessboardjs/chessboard-0.3.0.js"></script>
 	<script src="http://csmarlboro.org/jacobr/chess/js/legalmovesonly.js"></script>
 </body>
@@ -32,19 +58,89 @@ const (
 `
 	PORT = ":9999"
 	LOG  = true
+
+	ANALYZEDEPTH = 12               // the deepest an analysis request may ask for
+	ANALYZETIME  = 30 * time.Second // the longest an analysis request may search
 )
 
 var (
-	incmoves = make(chan *engine.Move, 1)
-	outmoves = make(chan *engine.Move, 1)
+	threads = flag.Int("threads", runtime.NumCPU(), "number of threads the engine searches with")
+	params  = flag.String("params", "", "JSON or TOML file of evaluation weights for this engine, as written by the tune command")
+	nnue    = flag.String("nnue", "", "network file to evaluate with instead of the hand-crafted evaluation, see search.Network")
+	syzygy  = flag.String("syzygy", "", "directories of Syzygy tablebase files, separated as in $PATH")
+	dtm     = flag.String("dtm", "", "directories of distance to mate tables made by the tb command, separated as in $PATH; each four piece table takes 16 MB of memory, and root moves are ranked by distance to mate only")
+	algo    = flag.String("search", "alphabeta", "how the engine searches: alphabeta, or mcts for Monte Carlo tree search")
+
+	incmoves = make(chan moveRequest, 1)
 	quit     = make(chan int, 1)
+	newgame  = make(chan gameSettings, 1) // starts over with new settings
+
+	stopsearch   = func() {}      // cancels the search in progress, if any
+	weights      *search.Params   // loaded with -params, nil for the defaults
+	evaluator    search.Evaluator // the network loaded with -nnue, or the hand-crafted evaluation with weights
+	tablebase    search.Tablebase // the tablebases found with -syzygy or -dtm, nil for none
+	stopsearchmu sync.Mutex
 )
 
+// A move sent by the player, along with the context of the HTTP request it came in.
+// The engine's reply goes back on reply, which is buffered so that a request given up on never blocks the game.
+type moveRequest struct {
+	ctx   context.Context
+	move  *engine.Move
+	reply chan *engine.Move
+}
+
+// How the engine plays a game, chosen when the game starts.
+type gameSettings struct {
+	strength *search.Strength // nil or at search.MAXSKILL for full strength
+	contempt int              // see search.Options.Contempt
+	clock    *search.Clock    // the engine's time control, nil to search to a fixed depth instead
+}
+
+// Returns a searcher of the kind chosen with -search, with nothing kept from earlier searches.
+func newSearcher() search.Searcher {
+	if *algo == "mcts" {
+		return &search.MCTS{Policy: true}
+	}
+	return search.AlphaBetaSearcher{}
+}
+
 // Intended to run as a goroutine.
 // Keeps track of the state of a single game, recieving and sending moves through the appropriate channel.
 func game() {
 	board := &engine.Board{Turn: 1}
 	board.SetUpPieces()
+	table := search.NewTranspositionTable(search.DEFAULTHASH)
+	var searcher search.Searcher
+	var settings gameSettings
+	// positions since the last capture or pawn move, including the current one, for recognizing draws
+	var history []uint64
+	var pieces int
+	var clock search.Clock // time left for the engine, when playing on time
+	newGame := func() {
+		board.SetUpPieces()
+		board.Turn = 1
+		table.Clear()
+		searcher = newSearcher()
+		history, pieces = []uint64{board.Hash()}, len(board.Board)
+		if settings.clock != nil {
+			clock = *settings.clock
+		}
+	}
+	newGame()
+	// to be called after each move; the player's moves do not say whether they capture, so pieces are counted
+	played := func(m *engine.Move) {
+		remaining := 0
+		for _, p := range board.Board {
+			if !p.Captured {
+				remaining++
+			}
+		}
+		if m.Piece == 'p' || remaining < pieces {
+			history, pieces = history[:0], remaining
+		}
+		history = append(history, board.Hash())
+	}
 	url := fmt.Sprintf("http://localhost%s", PORT)
 	cmd := exec.Command("open", url)
 	if _, err := cmd.Output(); err != nil {
@@ -53,38 +149,86 @@ func game() {
 	rand.Seed(time.Now().UTC().UnixNano())
 	for {
 		select {
-		case oppmove := <-incmoves:
+		case request := <-incmoves:
+			oppmove := request.move
 			for _, p := range board.Board {
 				if p.Position.X == oppmove.Begin.X && p.Position.Y == oppmove.Begin.Y {
 					oppmove.Piece = p.Name
 					break
 				}
 			}
+			// kept to take the move back if the player leaves before the engine replies
+			before, beforehistory, beforepieces := board.Copy(), append([]uint64{}, history...), pieces
 			board.ForceMove(oppmove)
+			played(oppmove)
 			if LOG {
 				fmt.Println(oppmove.ToString())
 				board.PrintBoard()
 			}
 			var mymove *engine.Move
+			start := time.Now()
 			if moves, ok := search.Book[board.ToFen()]; ok {
 				mymove = stringToMove(moves[rand.Intn(len(moves))])
 			} else {
-				if m := search.AlphaBeta(board, 4, search.BLACKWIN, search.WHITEWIN); m != nil {
-					mymove = m
+				ctx, cancel := context.WithCancel(request.ctx)
+				stopsearchmu.Lock()
+				stopsearch = cancel
+				stopsearchmu.Unlock()
+				opts := search.Options{
+					Depth:         4,
+					Threads:       *threads,
+					Table:         table,
+					Strength:      settings.strength,
+					Contempt:      settings.contempt,
+					Evaluator:     evaluator,
+					Tablebase:     tablebase,
+					History:       history[:len(history)-1],
+					HalfmoveClock: len(history) - 1,
+				}
+				if settings.clock != nil {
+					opts.Depth = 0
+					opts.Clock = &clock
+				}
+				if LOG {
+					opts.Info = func(info search.Info) {
+						fmt.Println(info)
+					}
+				}
+				result := searcher.Search(ctx, board, opts)
+				cancel()
+				if request.ctx.Err() != nil {
+					// the player left while the engine was thinking: the request never happened, so the game
+					// goes on from before it and the player may send the move again
+					board, history, pieces = before, beforehistory, beforepieces
+					continue
+				}
+				if result.Move != nil {
+					mymove = result.Move
+					if LOG && result.Mate != 0 {
+						fmt.Println("mate in", result.Mate)
+					}
 				} else {
 					quit <- 1
 					break
 				}
 			}
+			if settings.clock != nil {
+				clock.Remaining += clock.Increment - time.Since(start)
+				if clock.Remaining < 0 {
+					clock.Remaining = 0
+				}
+			}
 			board.ForceMove(mymove)
-			outmoves <- mymove
+			played(mymove)
+			request.reply <- mymove
 			if LOG {
 				fmt.Println(mymove.ToString())
 				board.PrintBoard()
 			}
 		case <-quit:
-			board.SetUpPieces()
-			board.Turn = 1
+			newGame()
+		case settings = <-newgame:
+			newGame()
 		}
 
 	}
@@ -117,9 +261,9 @@ func stringToSquare(s string) engine.Square {
 	return square
 }
 
-// Serves the index, including relevant JS files.
+// Serves the index, including relevant JS files and a selector to start a new game at another level.
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, INDEX)
+	fmt.Fprintf(w, INDEX, search.MAXSKILL)
 }
 
 // Gets a move form from an AJAX request and sends it to the chess program.
@@ -139,19 +283,411 @@ func chessHandler(w http.ResponseWriter, r *http.Request) {
 		End:       stringToSquare(r.Form["to"][0]),
 		Promotion: promotion,
 	}
-	incmoves <- oppmove
-	mymove := <-outmoves
+	request := moveRequest{ctx: r.Context(), move: oppmove, reply: make(chan *engine.Move, 1)}
+	incmoves <- request
+	var mymove *engine.Move
+	select {
+	case mymove = <-request.reply:
+	case <-r.Context().Done():
+		return
+	}
 	mymoveD := map[string]interface{}{"from": mymove.Begin.ToString(), "to": mymove.End.ToString(), "promotion": "q"}
 	mymoveB, _ := json.Marshal(mymoveD)
 	fmt.Fprint(w, string(mymoveB))
 }
 
-// Listens for HTTP requests and dispatches them to appropriate function
+// Stops the engine's search, so that it plays the best move it has found so far.
+func stopHandler(w http.ResponseWriter, r *http.Request) {
+	stopsearchmu.Lock()
+	stopsearch()
+	stopsearchmu.Unlock()
+}
+
+// Starts a new game against the engine at the level given by the "level" parameter, from 0 to search.MAXSKILL,
+// or at about the rating given by "elo". Without either the engine plays at full strength.
+// "contempt" is how many centipawns worse than equal the engine counts a draw, 0 by default.
+// With "time" the engine plays on a clock of that many seconds for the game, plus "inc" seconds a move.
+func newGameHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var settings gameSettings
+	if level, err := strconv.Atoi(r.Form.Get("level")); err == nil {
+		settings.strength = &search.Strength{Skill: level}
+	}
+	if elo, err := strconv.Atoi(r.Form.Get("elo")); err == nil {
+		settings.strength = &search.Strength{Elo: elo}
+	}
+	if contempt, err := strconv.Atoi(r.Form.Get("contempt")); err == nil {
+		settings.contempt = contempt
+	}
+	if seconds, err := strconv.ParseFloat(r.Form.Get("time"), 64); err == nil {
+		if seconds <= 0 {
+			http.Error(w, "time must be more than 0 seconds", http.StatusBadRequest)
+			return
+		}
+		settings.clock = &search.Clock{Remaining: time.Duration(seconds * float64(time.Second))}
+		if inc, err := strconv.ParseFloat(r.Form.Get("inc"), 64); err == nil {
+			settings.clock.Increment = time.Duration(inc * float64(time.Second))
+		}
+	}
+	newgame <- settings
+}
+
+// Analyzes the position given in FEN by the "fen" parameter and sends back the best lines as JSON.
+// "depth" defaults to 4, and at most ANALYZEDEPTH, and "multipv", the number of lines, to 1 and at most the number
+// of legal moves. Either below 1 is rejected.
+// The search stops after ANALYZETIME, sending back the lines found by then.
+func analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	board, err := engine.FromFen(r.Form.Get("fen"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	depth, multipv := 4, 1
+	if d, err := strconv.Atoi(r.Form.Get("depth")); err == nil {
+		if d < 1 {
+			http.Error(w, "depth must be at least 1", http.StatusBadRequest)
+			return
+		}
+		depth = d
+	}
+	if depth > ANALYZEDEPTH {
+		depth = ANALYZEDEPTH
+	}
+	if m, err := strconv.Atoi(r.Form.Get("multipv")); err == nil {
+		if m < 1 {
+			http.Error(w, "multipv must be at least 1", http.StatusBadRequest)
+			return
+		}
+		multipv = m
+	}
+	// there are never more lines than moves
+	if moves := len(board.AllLegalMoves()); multipv > moves && moves > 0 {
+		multipv = moves
+	}
+	opts := search.Options{
+		Depth:     depth,
+		Threads:   *threads,
+		Table:     search.NewTranspositionTable(search.DEFAULTHASH),
+		MultiPV:   multipv,
+		Evaluator: evaluator,
+		Tablebase: tablebase,
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), ANALYZETIME)
+	defer cancel()
+	result := newSearcher().Search(ctx, board, opts)
+	if r.Context().Err() != nil {
+		return
+	}
+	lines := make([]map[string]interface{}, len(result.Lines))
+	for i, line := range result.Lines {
+		pv := make([]string, len(line.PV))
+		for j, m := range line.PV {
+			pv[j] = m.ToString()
+		}
+		lines[i] = map[string]interface{}{"move": line.Move.ToString(), "score": line.Score, "mate": line.Mate, "pv": pv}
+	}
+	analysisB, _ := json.Marshal(map[string]interface{}{"depth": result.Depth, "lines": lines})
+	fmt.Fprint(w, string(analysisB))
+}
+
+// Sends back the evaluation of the position given in FEN by the "fen" parameter, broken down by term, as JSON,
+// or as a table with "format=text".
+func evalHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	board, err := engine.FromFen(r.Form.Get("fen"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trace := search.TraceEval(board, weights)
+	if r.Form.Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, trace)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	traceB, _ := json.Marshal(trace)
+	fmt.Fprint(w, string(traceB))
+}
+
+// Tunes the evaluation weights on a file of positions labelled with game results, see search.Tune, and writes
+// them to a file that the -params flag can load. Tuning starts from the weights given with -params, if any.
+// Usage: tune [-passes n] [-step n] [-only NAME,...] positions params.json
+func tune(args []string) error {
+	flags := flag.NewFlagSet("tune", flag.ExitOnError)
+	passes := flags.Int("passes", 0, "passes over all weights, 0 to go on until the error stops falling")
+	step := flags.Int("step", 1, "how far a weight is changed at a time, in centipawns")
+	only := flags.String("only", "", "comma separated names or name prefixes of the weights to tune, all if empty")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return errors.New("usage: tune [-passes n] [-step n] [-only NAME,...] positions params.json")
+	}
+	positions, err := search.LoadTuningPositions(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	opts := search.TuneOptions{
+		Passes:  *passes,
+		Step:    *step,
+		Threads: *threads,
+		Progress: func(pass int, err float64) {
+			fmt.Printf("pass %d error %.6f\n", pass, err)
+		},
+	}
+	if *only != "" {
+		opts.Only = strings.Split(*only, ",")
+	}
+	tuned := search.DefaultParams()
+	if weights != nil {
+		tuned = weights.Clone()
+	}
+	fmt.Printf("tuning on %d positions\n", len(positions))
+	search.Tune(positions, tuned, opts)
+	return tuned.Save(flags.Arg(1))
+}
+
+// Plays games of the engine against itself and writes the positions, with the engine's scores and the results,
+// to a file for training an evaluation offline, see search.SelfPlay.
+// Usage: export [-games n] [-depth n] [-random n] positions.txt
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	games := flags.Int("games", 10, "number of games to play")
+	depth := flags.Int("depth", 2, "depth searched for every move")
+	random := flags.Int("random", 8, "half-moves played at random at the start of each game")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: export [-games n] [-depth n] [-random n] positions.txt")
+	}
+	file, err := os.Create(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	opts := search.SelfPlayOptions{
+		Depth:       *depth,
+		RandomPlies: *random,
+		Evaluator:   evaluator,
+		Searcher:    newSearcher(),
+		Rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for i := 1; i <= *games; i++ {
+		positions, err := search.SelfPlay(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		if err := search.WriteTrainingPositions(file, positions); err != nil {
+			return err
+		}
+		fmt.Printf("game %d: %d positions\n", i, len(positions))
+	}
+	return file.Close()
+}
+
+// Makes distance to mate tables, or looks up a position in them.
+// Making a four piece table takes about fifty megabytes of memory, and every four piece table loaded with -dtm or
+// probed here 16 MB.
+// Usage: tb generate [-dir d] SIGNATURE... or tb probe [-dir d] FEN
+func tb(args []string) error {
+	usage := errors.New("usage: tb generate [-dir d] SIGNATURE... or tb probe [-dir d] FEN")
+	if len(args) == 0 {
+		return usage
+	}
+	flags := flag.NewFlagSet("tb", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory the tables are written to or read from")
+	flags.Parse(args[1:])
+	switch args[0] {
+	case "generate":
+		for _, signature := range flags.Args() {
+			start := time.Now()
+			table, err := search.GenerateDTM(signature)
+			if err != nil {
+				return err
+			}
+			filename := filepath.Join(*dir, table.Signature+".dtm")
+			if err := table.Save(filename); err != nil {
+				return err
+			}
+			fmt.Printf("%s: longest mate %d half-moves, made in %v, written to %s\n",
+				table.Signature, table.LongestMate(), time.Since(start).Round(time.Millisecond), filename)
+		}
+		return nil
+	case "probe":
+		board, err := engine.FromFen(strings.Join(flags.Args(), " "))
+		if err != nil {
+			return err
+		}
+		tables, err := search.LoadDTM(*dir)
+		if err != nil {
+			return err
+		}
+		wdl, plies, ok := tables.Probe(board)
+		if !ok {
+			return errors.New("position not in the tables")
+		}
+		fmt.Println(tbResult(wdl, plies))
+		for _, move := range board.AllLegalMoves() {
+			board.ForceMove(move)
+			wdl, plies, ok := tables.Probe(board)
+			board.UndoMove(move)
+			result := "not in the tables"
+			if ok {
+				result = tbResult(-wdl, plies+1)
+			}
+			fmt.Printf("%s %s\n", move.ToString(), result)
+		}
+		return nil
+	}
+	return usage
+}
+
+// Describes a table's result for the side to move.
+func tbResult(wdl, plies int) string {
+	switch {
+	case wdl > 0:
+		return fmt.Sprintf("win, mate in %d", (plies+1)/2)
+	case wdl < 0:
+		return fmt.Sprintf("loss, mated in %d", plies/2)
+	}
+	return "draw"
+}
+
+// Proves or refutes a mate in n for the side to move and prints every key move, see search.SolveMate.
+// Usage: mate [-checks] n FEN
+func mate(args []string) error {
+	flags := flag.NewFlagSet("mate", flag.ExitOnError)
+	checks := flags.Bool("checks", false, "only try checks for the side mating")
+	flags.Parse(args)
+	n, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || flags.NArg() < 2 {
+		return errors.New("usage: mate [-checks] n FEN")
+	}
+	if n < 1 || n > search.MAXMATEMOVES {
+		return fmt.Errorf("mate: n must be from 1 to %d", search.MAXMATEMOVES)
+	}
+	board, err := engine.FromFen(strings.Join(flags.Args()[1:], " "))
+	if err != nil {
+		return err
+	}
+	solution, err := search.SolveMate(context.Background(), board, n, search.MateOptions{ChecksOnly: *checks})
+	if err != nil {
+		return err
+	}
+	if solution.Shortest == 0 {
+		fmt.Printf("no mate in %d (%d nodes)\n", n, solution.Nodes)
+		return nil
+	}
+	fmt.Printf("mate in %d, at most %d (%d nodes)\n", solution.Shortest, n, solution.Nodes)
+	for _, key := range solution.Keys {
+		fmt.Println("key", key.ToString())
+	}
+	if solution.Cooked() {
+		fmt.Printf("cooked: %d key moves\n", len(solution.Keys))
+	}
+	return nil
+}
+
+// Listens for HTTP requests and dispatches them to appropriate function.
+// "eval <fen>" prints the evaluation of a position broken down by term instead, "tune" tunes the evaluation,
+// "export" writes self-play positions for training, "tb" makes and probes distance to mate tables and "mate"
+// solves mate in N problems.
 func main() {
+	flag.Parse()
+	if *params != "" {
+		var err error
+		if weights, err = search.LoadParams(*params); err != nil {
+			fmt.Fprintln(os.Stderr, "-params:", err)
+			os.Exit(2)
+		}
+	}
+	evaluator = search.Classical{Params: weights}
+	if *nnue != "" {
+		network, err := search.LoadNetwork(*nnue)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-nnue:", err)
+			os.Exit(2)
+		}
+		evaluator = search.NNUE{Network: network}
+	}
+	if *algo != "alphabeta" && *algo != "mcts" {
+		fmt.Fprintln(os.Stderr, "-search must be alphabeta or mcts")
+		os.Exit(2)
+	}
+	if *syzygy != "" && *dtm != "" {
+		fmt.Fprintln(os.Stderr, "-syzygy and -dtm cannot be used together")
+		os.Exit(2)
+	}
+	if *syzygy != "" {
+		tb, err := search.LoadSyzygy(*syzygy)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-syzygy:", err)
+			os.Exit(2)
+		}
+		tablebase = tb
+	}
+	if *dtm != "" {
+		tables, err := search.LoadDTM(*dtm)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "-dtm:", err)
+			os.Exit(2)
+		}
+		tablebase = tables
+	}
+	if flag.Arg(0) == "export" {
+		if err := export(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "mate" {
+		if err := mate(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "tb" {
+		if err := tb(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "tune" {
+		if err := tune(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "eval" {
+		board, err := engine.FromFen(strings.Join(flag.Args()[1:], " "))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(search.TraceEval(board, weights))
+		return
+	}
 	go game()
 	r := mux.NewRouter()
 	r.HandleFunc("/", indexHandler)
 	r.HandleFunc("/move", chessHandler)
+	r.HandleFunc("/stop", stopHandler)
+	r.HandleFunc("/new", newGameHandler)
+	r.HandleFunc("/analyze", analyzeHandler)
+	r.HandleFunc("/eval", evalHandler)
 	http.Handle("/", r)
 
 	http.ListenAndServe(PORT, nil)
@@ -3,134 +3,368 @@
 package search
 
 import (
-	"fmt"
+	"context"
+	"sync/atomic"
 
 	"github.com/jacobroberts/chess/engine"
 )
 
 const (
-	LOG = true
+	POLLINTERVAL = 64 // nodes searched between checks for cancellation, a few hundredths of a second
 )
 
+// The state of one search thread.
+// Threads may share a transposition table, but each needs a board of its own because moves are made in place.
+type thread struct {
+	id       int
+	ctx      context.Context
+	board    *engine.Board
+	table    *TranspositionTable // nil when searching without one
+	stop     *int32              // the thread aborts its search once this is set
+	limit    func() bool         // polled along with ctx, returns true when the search should end. May be nil.
+	nodes    uint64              // read by other threads, so only accessed atomically
+	seldepth int                 // deepest ply reached, including the quiescence search
+	excluded []*engine.Move      // root moves left out of the search, because they already have a line of their own
+
+	tablebase Tablebase      // nil when searching without one
+	tbhits    uint64         // successful tablebase probes, only accessed atomically
+	rootmoves []*engine.Move // the only root moves searched, as the tablebases allow, or nil for all of them
+
+	drawscore int       // white-relative score of a draw, see drawScore
+	keys      []uint64  // hashes of the positions played since the last capture or pawn move, including the search path
+	clocks    []int     // half-moves since the last capture or pawn move, for each position in keys
+	evaluator Evaluator // attached to the thread's board, see IncrementalEvaluator
+	detach    func()
+
+	path       []*engine.Move  // moves made from the root to the current position
+	budget     int             // extensions allowed on any one path, see extension
+	extensions [MAXPLY + 1]int // extensions used on the path to each ply
+
+	// Triangular principal variation table: pv[ply] holds the best line found from ply onwards,
+	// in pv[ply][ply:pvlength[ply]].
+	// See: https://www.chessprogramming.org/Triangular_PV-Table
+	pv       [MAXPLY + 1][MAXPLY + 1]*engine.Move
+	pvlength [MAXPLY + 1]int
+}
+
+// Makes a thread searching b, evaluating with evaluator or with Classical if it is nil.
+func newThread(ctx context.Context, b *engine.Board, table *TranspositionTable, evaluator Evaluator) *thread {
+	t := &thread{ctx: ctx, board: b, table: table, stop: new(int32)}
+	t.evaluator, t.detach = attachEvaluator(evaluator, b)
+	t.setHistory(nil, 0)
+	return t
+}
+
+// Moves the thread to a new board as newThread would make it, reusing the thread instead of allocating another.
+func (t *thread) reset(b *engine.Board, evaluator Evaluator) {
+	t.detach()
+	t.board, t.nodes, t.seldepth = b, 0, 0
+	t.evaluator, t.detach = attachEvaluator(evaluator, b)
+	t.setHistory(nil, 0)
+}
+
+// Detaches the evaluator from the thread's board, once it is done searching.
+func (t *thread) close() {
+	t.detach()
+}
+
+// Evaluates the thread's board.
+func (t *thread) evaluate() int {
+	return t.evaluator.Evaluate(t.board)
+}
+
+// Counts a node at the given ply, and every POLLINTERVAL nodes checks whether the search has been cancelled.
+func (t *thread) poll(ply int) {
+	if ply > t.seldepth {
+		t.seldepth = ply
+	}
+	if atomic.AddUint64(&t.nodes, 1)%POLLINTERVAL != 0 {
+		return
+	}
+	if t.ctx.Err() != nil || (t.limit != nil && t.limit()) {
+		atomic.StoreInt32(t.stop, 1)
+	}
+}
+
+// Returns whether the thread has been told to abort.
+func (t *thread) stopped() bool {
+	return atomic.LoadInt32(t.stop) != 0
+}
+
+// Makes move followed by the best line from the next ply the best line from ply.
+func (t *thread) updatePV(ply int, move *engine.Move) {
+	t.pv[ply][ply] = move
+	copy(t.pv[ply][ply+1:], t.pv[ply+1][ply+1:t.pvlength[ply+1]])
+	t.pvlength[ply] = t.pvlength[ply+1]
+}
+
+// Returns a copy of the best line found from the root.
+func (t *thread) principalVariation() []*engine.Move {
+	return append([]*engine.Move{}, t.pv[0][:t.pvlength[0]]...)
+}
+
+// Returns whether two moves are the same move, even if generated separately.
+func sameMove(a, b *engine.Move) bool {
+	return a.Begin == b.Begin && a.End == b.End && a.Promotion == b.Promotion
+}
+
+// Returns movelist without the moves the thread has been told to leave out at the root, keeping only the root
+// moves it has been restricted to, if any.
+func (t *thread) withoutExcluded(movelist []*engine.Move) []*engine.Move {
+	if len(t.excluded) == 0 && t.rootmoves == nil {
+		return movelist
+	}
+	included := make([]*engine.Move, 0, len(movelist))
+	for _, move := range movelist {
+		if !containsSameMove(t.excluded, move) && (t.rootmoves == nil || containsSameMove(t.rootmoves, move)) {
+			included = append(included, move)
+		}
+	}
+	return included
+}
+
+// Returns whether movelist holds the same move as m, even if generated separately.
+func containsSameMove(movelist []*engine.Move, m *engine.Move) bool {
+	for _, move := range movelist {
+		if sameMove(move, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Moves m to the front of movelist, if it is there.
+func moveToFront(movelist []*engine.Move, m *engine.Move) {
+	for i, move := range movelist {
+		if move == m {
+			copy(movelist[1:i+1], movelist[:i])
+			movelist[0] = m
+			return
+		}
+	}
+}
+
 // Reference: http://web.cs.swarthmore.edu/~meeden/cs63/f05/minimax.html
 
 // Standard minmax search with alpha beta pruning.
 // Initial call: alpha set to lowest value, beta set to highest.
 // Top level returns a move.
-func AlphaBeta(b *engine.Board, depth int, alpha, beta float64) *engine.Move {
+// If ctx is cancelled the best move found so far is returned, or nil if no move was searched completely.
+func AlphaBeta(ctx context.Context, b *engine.Board, depth int, alpha, beta int) *engine.Move {
+	t := newThread(ctx, b, nil, nil)
+	defer t.close()
+	return t.rootSearch(depth, alpha, beta)
+}
+
+// Top level of the search, returning the best move with its score.
+// Helper threads rotate the moves after the first, so that they do not all search the same lines.
+// An aborted search returns the best of the moves it finished searching, or nil.
+// Returns nil as well when every move has been excluded.
+func (t *thread) rootSearch(depth int, alpha, beta int) *engine.Move {
+	b := t.board
+	t.pvlength[0] = 0
 	if b.IsOver() != 0 || depth == 0 {
 		return nil
 	}
 	var bestmove *engine.Move = nil
-	var result float64
-	movelist := orderedMoves(b, false)
+	var result int
+	movelist, _ := t.orderedMoves()
+	movelist = t.withoutExcluded(movelist)
+	if len(movelist) == 0 {
+		return nil
+	}
+	t.budget, t.extensions[1] = depth, 0
+	var hash uint64
+	if t.table != nil {
+		hash = b.Hash()
+		if entry, ok := t.table.Probe(hash); ok {
+			moveToFront(movelist, entry.matchMove(movelist))
+		}
+	}
+	if t.id > 0 && len(movelist) > 2 {
+		rest := movelist[1:]
+		shift := t.id % len(rest)
+		rotated := append(append([]*engine.Move{}, rest[shift:]...), rest[:shift]...)
+		copy(rest, rotated)
+	}
 	if b.Turn == 1 {
 		for _, move := range movelist {
-			b.ForceMove(move)
-			if move.Capture != 0 || b.IsCheck(b.Turn) {
-				result = AlphaBetaChild(b, depth-1, alpha, beta, true)
-			} else {
-				result = AlphaBetaChild(b, depth-1, alpha, beta, false)
+			t.makeMove(move)
+			result = t.alphaBeta(depth-1, 1, alpha, beta)
+			t.undoMove(move)
+			if t.stopped() {
+				break
 			}
-			b.UndoMove(move)
 			if result > alpha {
 				alpha = result
 				bestmove = move
 				bestmove.Score = alpha
+				t.updatePV(0, move)
 			}
 			if alpha >= beta {
 				bestmove = move
 				bestmove.Score = alpha
-				return bestmove
+				break
 			}
 		}
-		if bestmove == nil {
-			return b.AllLegalMoves()[0]
-		}
-		return bestmove
 	} else {
 		for _, move := range movelist {
-			b.ForceMove(move)
-			if move.Capture != 0 || b.IsCheck(b.Turn) {
-				result = AlphaBetaChild(b, depth-1, alpha, beta, true)
-			} else {
-				result = AlphaBetaChild(b, depth-1, alpha, beta, false)
-			}
-			if LOG {
-				fmt.Println(move.ToString(), result)
+			t.makeMove(move)
+			result = t.alphaBeta(depth-1, 1, alpha, beta)
+			t.undoMove(move)
+			if t.stopped() {
+				break
 			}
-			b.UndoMove(move)
 			if result < beta {
 				beta = result
 				bestmove = move
 				bestmove.Score = beta
+				t.updatePV(0, move)
 			}
 			if beta <= alpha {
 				bestmove = move
 				bestmove.Score = beta
-				return bestmove
+				break
 			}
 		}
-		if bestmove == nil {
-			return b.AllLegalMoves()[0]
-		}
+	}
+	if t.stopped() {
 		return bestmove
 	}
 	if bestmove == nil {
-		return b.AllLegalMoves()[0]
+		bestmove = movelist[0]
+		t.pv[0][0], t.pvlength[0] = bestmove, 1
+		return bestmove
+	}
+	// the best move of a search with root moves left out is not the best move of the position
+	if t.table != nil && len(t.excluded) == 0 {
+		t.table.Store(hash, ttData{score: bestmove.Score, depth: depth, bound: EXACT, hasmove: true,
+			begin: bestmove.Begin, end: bestmove.End, promotion: bestmove.Promotion})
 	}
 	return bestmove
 }
 
-// Child level returns an evaluation
-func AlphaBetaChild(b *engine.Board, depth int, alpha, beta float64, volatile bool) float64 {
-	var movelist []*engine.Move
-	if b.IsOver() != 0 {
-		return EvalBoard(b)
-	} else if depth == 0 {
-		if !volatile {
-			return EvalBoard(b)
+// Child level returns an evaluation.
+// ply is the distance from the root, used to score nearer mates higher.
+// Once the nominal depth runs out, the quiescence search takes over.
+func (t *thread) alphaBeta(depth, ply int, alpha, beta int) int {
+	t.pvlength[ply] = ply
+	t.poll(ply)
+	if t.stopped() {
+		return 0
+	}
+	b := t.board
+	movelist := b.AllLegalMoves()
+	if len(movelist) == 0 {
+		return t.terminalScore(ply)
+	}
+	if t.isDraw() {
+		return t.drawscore
+	}
+	// mate distance pruning: no line from here can beat a mate found closer to the root
+	if mated := BLACKWIN + ply; alpha < mated {
+		alpha = mated
+	}
+	if mating := WHITEWIN - ply; beta > mating {
+		beta = mating
+	}
+	if alpha >= beta {
+		if b.Turn == 1 {
+			return alpha
+		}
+		return beta
+	}
+	// the tablebases know the result of a position just reached by a capture or a pawn move, before the fifty move
+	// rule comes into it
+	if t.clocks[len(t.clocks)-1] == 0 && t.canProbe() {
+		if wdl, ok := t.probeWDL(); ok {
+			return t.tablebaseScore(wdl)
+		}
+	}
+	if depth == 0 || ply >= MAXPLY {
+		return t.quiescence(alpha, beta, ply, 0)
+	}
+	var hash uint64
+	var entry ttData
+	var found bool
+	if t.table != nil {
+		hash = b.Hash()
+		if entry, found = t.table.Probe(hash); found && entry.depth >= depth {
+			score := scoreFromTT(entry.score, ply)
+			if entry.bound == EXACT || (entry.bound == LOWERBOUND && score >= beta) || (entry.bound == UPPERBOUND && score <= alpha) {
+				return score
+			}
 		}
-		depth += 1
-		movelist = orderedMoves(b, true)
-	} else {
-		movelist = orderedMoves(b, false)
 	}
-	var score float64
+	// the moves generated above to look for mate and stalemate, not generated again
+	movelist, checks := t.orderMoves(movelist)
+	checking := append([]*engine.Move{}, movelist[:checks]...)
+	var singularmove *engine.Move
+	if found {
+		ttmove := entry.matchMove(movelist)
+		moveToFront(movelist, ttmove)
+		if ttmove != nil && t.isSingular(depth, ply, entry, ttmove, movelist) {
+			singularmove = ttmove
+		}
+	}
+	alphaorig, betaorig := alpha, beta
+	var bestmove *engine.Move
+	var score int
 	if b.Turn == 1 {
 		for _, move := range movelist {
-			b.ForceMove(move)
-			if !volatile && (move.Capture != 0 || b.IsCheck(b.Turn)) {
-				score = AlphaBetaChild(b, depth-1, alpha, beta, true)
-			} else {
-				score = AlphaBetaChild(b, depth-1, alpha, beta, false)
-			}
-			b.UndoMove(move)
+			extension := t.extension(ply, move, len(movelist), move == singularmove || containsMove(checking, move))
+			t.makeMove(move)
+			score = t.alphaBeta(depth-1+extension, ply+1, alpha, beta)
+			t.undoMove(move)
 			if score > alpha {
 				alpha = score
+				bestmove = move
+				t.updatePV(ply, move)
 			}
 			if alpha >= beta {
+				t.store(hash, depth, ply, alpha, LOWERBOUND, bestmove)
 				return alpha
 			}
 		}
+		if alpha > alphaorig {
+			t.store(hash, depth, ply, alpha, EXACT, bestmove)
+		} else {
+			t.store(hash, depth, ply, alpha, UPPERBOUND, nil)
+		}
 		return alpha
 	} else {
 		for _, move := range movelist {
-			b.ForceMove(move)
-			if !volatile && (move.Capture != 0 || b.IsCheck(b.Turn)) {
-				score = AlphaBetaChild(b, depth-1, alpha, beta, true)
-			} else {
-				score = AlphaBetaChild(b, depth-1, alpha, beta, false)
-			}
-			b.UndoMove(move)
+			extension := t.extension(ply, move, len(movelist), move == singularmove || containsMove(checking, move))
+			t.makeMove(move)
+			score = t.alphaBeta(depth-1+extension, ply+1, alpha, beta)
+			t.undoMove(move)
 			if score < beta {
 				beta = score
+				bestmove = move
+				t.updatePV(ply, move)
 			}
 			if beta <= alpha {
+				t.store(hash, depth, ply, beta, UPPERBOUND, bestmove)
 				return beta
 			}
 		}
+		if beta < betaorig {
+			t.store(hash, depth, ply, beta, EXACT, bestmove)
+		} else {
+			t.store(hash, depth, ply, beta, LOWERBOUND, nil)
+		}
 		return beta
 	}
-	return 0
+}
+
+// Stores a search result in the transposition table, unless there is none or the search was aborted.
+func (t *thread) store(hash uint64, depth, ply int, score int, bound int, bestmove *engine.Move) {
+	if t.table == nil || t.stopped() {
+		return
+	}
+	d := ttData{score: scoreToTT(score, ply), depth: depth, bound: bound}
+	if bestmove != nil {
+		d.hasmove, d.begin, d.end, d.promotion = true, bestmove.Begin, bestmove.End, bestmove.Promotion
+	}
+	t.table.Store(hash, d)
 }
@@ -0,0 +1,72 @@
+package search
+
+import "github.com/jacobroberts/chess/engine"
+
+const (
+	FIFTYMOVES = 100 // half-moves without a capture or pawn move after which the game is drawn
+)
+
+// Draws are scored with contempt: a positive contempt makes the engine treat a draw as that many centipawns worse than
+// equal for itself, so that it plays on against weaker opponents, and a negative one makes it happy to draw.
+// The engine is the side to move at the root, so the white-relative draw score depends on who that is.
+
+// Returns the white-relative score of a draw, for an engine playing turn.
+func drawScore(contempt, turn int) int {
+	if turn == 1 {
+		return DRAW - contempt
+	}
+	return DRAW + contempt
+}
+
+// Sets up the thread to recognize draws by repetition and the fifty move rule.
+// history holds the hashes of the positions before the root since the last capture or pawn move, oldest first,
+// and clock is the number of half-moves played since then.
+func (t *thread) setHistory(history []uint64, clock int) {
+	t.keys = append(append(t.keys[:0], history...), t.board.Hash())
+	t.clocks = t.clocks[:0]
+	for range history {
+		t.clocks = append(t.clocks, 0)
+	}
+	t.clocks = append(t.clocks, clock)
+}
+
+// Makes a move on the thread's board, keeping track of the moves and positions played.
+func (t *thread) makeMove(move *engine.Move) {
+	t.board.ForceMove(move)
+	clock := 0
+	if move.Piece != 'p' && move.Capture == 0 && len(t.clocks) > 0 {
+		clock = t.clocks[len(t.clocks)-1] + 1
+	}
+	t.keys = append(t.keys, t.board.Hash())
+	t.clocks = append(t.clocks, clock)
+	t.path = append(t.path, move)
+}
+
+// Takes back a move made by makeMove.
+func (t *thread) undoMove(move *engine.Move) {
+	t.board.UndoMove(move)
+	t.keys = t.keys[:len(t.keys)-1]
+	t.clocks = t.clocks[:len(t.clocks)-1]
+	t.path = t.path[:len(t.path)-1]
+}
+
+// Checks if the current position is drawn by the fifty move rule, by repetition or for lack of material.
+// A position counts as repeated the first time it recurs, since whatever was best there the first time is
+// still best the second time, and then the game can be drawn by repeating it once more.
+// Stalemate is left to the caller, which knows whether there are legal moves.
+func (t *thread) isDraw() bool {
+	if len(t.keys) > 0 {
+		last := len(t.keys) - 1
+		clock := t.clocks[last]
+		if clock >= FIFTYMOVES {
+			return true
+		}
+		// only positions since the last capture or pawn move can repeat, and only with the same side to move
+		for i := last - 2; i >= 0 && i >= last-clock; i -= 2 {
+			if t.keys[i] == t.keys[last] {
+				return true
+			}
+		}
+	}
+	return t.board.InsufficientMaterial()
+}
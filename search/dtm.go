@@ -0,0 +1,853 @@
+package search
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Distance to mate tables for endgames of up to four pieces, made here by retrograde analysis: first every
+// checkmate is found, then every position one half-move away from one, and so on backwards by un-making moves,
+// until nothing changes. Captures and promotions lead into the tables of the material left, which are made first.
+// Positions are indexed by the square of every piece, a1 = 0, b1 = 1, ..., h8 = 63, and the side to move:
+//
+//	index = side to move (0 white, 1 black) + 2 × (white king + 32 × (square of piece 1 + 64 × ...))
+//
+// with the pieces in the order of the table's signature, such as "KRKN" for king and rook against king and
+// knight: white's pieces from the king down, then black's. The stronger side is always white in the signature;
+// positions with the colors the other way round are looked up upside down. The tables ignore castling, en passant
+// and the fifty move rule, so a position and its mirror image across the d/e file have the same value, pawns or
+// not, and only positions with the white king on files a-d are kept: the king's square is counted as
+// 4 × rank + file. A table holds a byte for each of 64^n positions of n pieces: 16 MB in memory for four pieces,
+// a quarter of a megabyte for three.
+// Reference: https://www.chessprogramming.org/Retrograde_Analysis
+const (
+	DTMMAXPIECES = 4   // the most pieces of a table that can be made
+	DTMMAXPLIES  = 253 // the longest distance to mate, in half-moves, a table can hold
+	dtmMagic     = "CDTM"
+	dtmVersion   = 2
+)
+
+// Values of a position in a table, for the side to move. A value of dtmMated + n is a result n half-moves from
+// mate: won when n is odd, lost when it is even.
+const (
+	dtmDraw    = 0 // also positions not yet known while the table is made
+	dtmInvalid = 1 // two pieces on a square, a pawn on the first or last rank, or the side not to move in check
+	dtmMated   = 2
+)
+
+// Material values for telling which side of a signature is the stronger.
+var dtmStrength = map[byte]int{'Q': 9, 'R': 5, 'B': 3, 'N': 3, 'P': 1}
+
+var (
+	dtmKingSteps   [64]uint64
+	dtmKnightJumps [64]uint64
+)
+
+var (
+	dtmRookDirections   = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	dtmBishopDirections = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	dtmQueenDirections  = append(append([][2]int{}, dtmRookDirections...), dtmBishopDirections...)
+	dtmPromotions       = []byte{'q', 'r', 'b', 'n'}
+)
+
+func init() {
+	for s := 0; s < 64; s++ {
+		for _, step := range kingSteps(s) {
+			dtmKingSteps[s] |= 1 << uint(step)
+		}
+		for _, jump := range [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}} {
+			if x, y := s%8+jump[0], s/8+jump[1]; x >= 0 && x < 8 && y >= 0 && y < 8 {
+				dtmKnightJumps[s] |= 1 << uint(y*8+x)
+			}
+		}
+	}
+}
+
+// One of the pieces a table is indexed by.
+type dtmSlot struct {
+	name byte // p, n, b, r, q or k
+	side int  // 0 for white, 1 for black
+}
+
+// A distance to mate table for one material signature.
+type DTMTable struct {
+	Signature string // such as "KRKN", see CanonicalSignature
+	slots     []dtmSlot
+	values    []byte
+}
+
+// Returns the signature of the table that holds a set of material, with the stronger side first as white.
+// A signature lists white's pieces from the king down, then black's: "KQK", "KRKN", "KPKP".
+func CanonicalSignature(signature string) (string, error) {
+	if !strings.HasPrefix(signature, "K") || strings.Count(signature, "K") != 2 {
+		return "", fmt.Errorf("bad signature %q: expected two kings", signature)
+	}
+	second := strings.IndexByte(signature[1:], 'K') + 1
+	white, black := signature[:second], signature[second:]
+	if len(signature) > DTMMAXPIECES || strings.Trim(white[1:]+black[1:], "QRBNP") != "" {
+		return "", fmt.Errorf("bad signature %q: expected up to %d pieces", signature, DTMMAXPIECES)
+	}
+	white, black = syzygyOrder([]byte(white)), syzygyOrder([]byte(black))
+	strength := func(side string) int {
+		n := 0
+		for i := 1; i < len(side); i++ {
+			n += dtmStrength[side[i]]
+		}
+		return n
+	}
+	if s, t := strength(white), strength(black); t > s || (t == s && black > white) {
+		white, black = black, white
+	}
+	return white + black, nil
+}
+
+// Makes an empty table for a canonical signature.
+func newDTMTable(signature string) *DTMTable {
+	t := &DTMTable{Signature: signature}
+	side := 0
+	for i := 0; i < len(signature); i++ {
+		if signature[i] == 'K' && i > 0 {
+			side = 1
+		}
+		t.slots = append(t.slots, dtmSlot{signature[i] - 'A' + 'a', side})
+	}
+	t.values = make([]byte, 1<<uint(6*len(t.slots)))
+	return t
+}
+
+// Returns the index of the slot of the black king.
+func (t *DTMTable) blackKing() int {
+	for i, slot := range t.slots {
+		if slot.side == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the longest distance to mate in the table, in half-moves.
+func (t *DTMTable) LongestMate() int {
+	longest := 0
+	for _, v := range t.values {
+		if v >= dtmMated && int(v-dtmMated) > longest {
+			longest = int(v - dtmMated)
+		}
+	}
+	return longest
+}
+
+// Returns the index of a position, with ok false if its material is not the table's.
+func (t *DTMTable) index(b *engine.Board) (int, bool) {
+	raw := strings.Replace(materialKey(b), "v", "", 1)
+	flip := raw != t.Signature
+	p := dtmPosition{table: t}
+	var used [DTMMAXPIECES]bool
+	n := 0
+	for _, piece := range b.Board {
+		if piece.Captured {
+			continue
+		}
+		n++
+		side, square := colorSide(piece.Color), (piece.Position.Y-1)*8+piece.Position.X-1
+		if flip {
+			side, square = 1-side, square^56
+		}
+		found := false
+		for i, slot := range t.slots {
+			if !used[i] && slot.name == piece.Name && slot.side == side {
+				used[i], found = true, true
+				p.squares[i] = square
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	if n != len(t.slots) {
+		return 0, false
+	}
+	if (b.Turn == -1) != flip {
+		p.stm = 1
+	}
+	return p.index(), true
+}
+
+// Looks up a position: its result for the side to move, from TBLOSS to TBWON with no cursed wins or blessed
+// losses, and how many half-moves it is from mate when it is not a draw. ok is false if the position is not in the
+// table. Castling rights and en passant are not taken into account.
+func (t *DTMTable) Probe(b *engine.Board) (wdl, plies int, ok bool) {
+	idx, ok := t.index(b)
+	if !ok {
+		return 0, 0, false
+	}
+	switch v := t.values[idx]; {
+	case v == dtmDraw:
+		return TBDRAW, 0, true
+	case v == dtmInvalid:
+		return 0, 0, false
+	case (v-dtmMated)%2 == 1:
+		return TBWON, int(v - dtmMated), true
+	default:
+		return TBLOSS, int(v - dtmMated), true
+	}
+}
+
+// A position while a table is made: the squares of its pieces, in the order of the table's slots.
+type dtmPosition struct {
+	table   *DTMTable
+	squares [DTMMAXPIECES]int
+	stm     int
+}
+
+// Decodes an index. The white king is always on files a-d.
+func (t *DTMTable) position(idx int) dtmPosition {
+	p := dtmPosition{table: t, stm: idx & 1}
+	king := idx >> 1 & 31
+	p.squares[0] = king/4*8 + king%4
+	for i := 1; i < len(t.slots); i++ {
+		p.squares[i] = idx >> uint(6*i) & 63
+	}
+	return p
+}
+
+// Returns the index of the position, or of its mirror image when the white king is on files e-h.
+func (p *dtmPosition) index() int {
+	mirror := 0
+	if p.squares[0]%8 > 3 {
+		mirror = 7
+	}
+	king := p.squares[0] ^ mirror
+	idx := p.stm | (king/8*4+king%8)<<1
+	for i := 1; i < len(p.table.slots); i++ {
+		idx |= (p.squares[i] ^ mirror) << uint(6*i)
+	}
+	return idx
+}
+
+// Returns the squares occupied, leaving out the piece in slot skip.
+func (p *dtmPosition) occupied(skip int) uint64 {
+	var occ uint64
+	for i := range p.table.slots {
+		if i != skip {
+			occ |= 1 << uint(p.squares[i])
+		}
+	}
+	return occ
+}
+
+// Returns whether a piece on from attacks to, with the squares in occ occupied.
+func dtmAttacks(slot dtmSlot, from, to int, occ uint64) bool {
+	switch slot.name {
+	case 'k':
+		return dtmKingSteps[from]&(1<<uint(to)) != 0
+	case 'n':
+		return dtmKnightJumps[from]&(1<<uint(to)) != 0
+	case 'p':
+		if slot.side == 0 {
+			return pawnAttacks(from, to)
+		}
+		return pawnAttacks(to, from)
+	}
+	dx, dy := to%8-from%8, to/8-from/8
+	straight, diagonal := dx == 0 || dy == 0, absInt(dx) == absInt(dy)
+	if from == to || (slot.name == 'r' && !straight) || (slot.name == 'b' && !diagonal) || (!straight && !diagonal) {
+		return false
+	}
+	step := sign(dy)*8 + sign(dx)
+	for s := from + step; s != to; s += step {
+		if occ&(1<<uint(s)) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns whether the king of side is attacked, with the piece in slot captured gone.
+func (p *dtmPosition) inCheck(side, captured int) bool {
+	king := 0
+	if side == 1 {
+		king = p.table.blackKing()
+	}
+	occ := p.occupied(captured)
+	for i, slot := range p.table.slots {
+		if slot.side != side && i != captured && dtmAttacks(slot, p.squares[i], p.squares[king], occ) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether a position can happen: every piece on a square of its own, no pawns on the first or last rank
+// and the side not to move not in check.
+func (p *dtmPosition) valid() bool {
+	var occ uint64
+	for i, slot := range p.table.slots {
+		s := p.squares[i]
+		if occ&(1<<uint(s)) != 0 || (slot.name == 'p' && (s < 8 || s >= 56)) {
+			return false
+		}
+		occ |= 1 << uint(s)
+	}
+	return !p.inCheck(1-p.stm, -1)
+}
+
+// A move while a table is made.
+type dtmMove struct {
+	slot, to  int
+	captured  int  // the slot of the piece taken, or -1
+	promotion byte // 0 if none
+}
+
+// Returns the squares a piece on from moves to, not counting pawn moves; with the squares in occ occupied.
+func dtmTargets(name byte, from int, occ uint64) uint64 {
+	switch name {
+	case 'k':
+		return dtmKingSteps[from]
+	case 'n':
+		return dtmKnightJumps[from]
+	}
+	directions := dtmQueenDirections
+	if name == 'r' {
+		directions = dtmRookDirections
+	} else if name == 'b' {
+		directions = dtmBishopDirections
+	}
+	var targets uint64
+	for _, d := range directions {
+		for x, y := from%8+d[0], from/8+d[1]; x >= 0 && x < 8 && y >= 0 && y < 8; x, y = x+d[0], y+d[1] {
+			targets |= 1 << uint(y*8+x)
+			if occ&(1<<uint(y*8+x)) != 0 {
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// Appends the legal moves of the side to move to moves.
+func (p *dtmPosition) moves(moves []dtmMove) []dtmMove {
+	t := p.table
+	occ := p.occupied(-1)
+	at := func(s int) int {
+		for i := range t.slots {
+			if p.squares[i] == s {
+				return i
+			}
+		}
+		return -1
+	}
+	add := func(m dtmMove) {
+		from := p.squares[m.slot]
+		p.squares[m.slot] = m.to
+		if !p.inCheck(p.stm, m.captured) {
+			moves = append(moves, m)
+		}
+		p.squares[m.slot] = from
+	}
+	for i, slot := range t.slots {
+		if slot.side != p.stm {
+			continue
+		}
+		from := p.squares[i]
+		if slot.name == 'p' {
+			forward, last, start := 8, 7, 1
+			if slot.side == 1 {
+				forward, last, start = -8, 0, 6
+			}
+			var targets []dtmMove
+			if to := from + forward; occ&(1<<uint(to)) == 0 {
+				targets = append(targets, dtmMove{slot: i, to: to, captured: -1})
+				if to2 := to + forward; from/8 == start && occ&(1<<uint(to2)) == 0 {
+					targets = append(targets, dtmMove{slot: i, to: to2, captured: -1})
+				}
+			}
+			for _, to := range []int{from + forward - 1, from + forward + 1} {
+				if absInt(to%8-from%8) == 1 {
+					if j := at(to); j >= 0 && t.slots[j].side != p.stm && t.slots[j].name != 'k' {
+						targets = append(targets, dtmMove{slot: i, to: to, captured: j})
+					}
+				}
+			}
+			for _, m := range targets {
+				if m.to/8 != last {
+					add(m)
+					continue
+				}
+				for _, promotion := range dtmPromotions {
+					m.promotion = promotion
+					add(m)
+				}
+			}
+			continue
+		}
+		targets := dtmTargets(slot.name, from, occ)
+		for to := 0; to < 64; to++ {
+			if targets&(1<<uint(to)) == 0 {
+				continue
+			}
+			j := at(to)
+			if j < 0 {
+				add(dtmMove{slot: i, to: to, captured: -1})
+			} else if t.slots[j].side != p.stm && t.slots[j].name != 'k' {
+				add(dtmMove{slot: i, to: to, captured: j})
+			}
+		}
+	}
+	return moves
+}
+
+// Calls f with the index of every position the side not to move could have moved from to reach this one, without
+// a capture or a promotion. Some of them may not be valid.
+func (p *dtmPosition) unmoves(f func(int)) {
+	t := p.table
+	occ := p.occupied(-1)
+	mover := 1 - p.stm
+	q := *p
+	q.stm = mover
+	for i, slot := range t.slots {
+		if slot.side != mover {
+			continue
+		}
+		to := p.squares[i]
+		var froms uint64
+		if slot.name == 'p' {
+			// pawns start on the second rank
+			back, lowest, highest, double := -8, 2, 6, 3
+			if slot.side == 1 {
+				back, lowest, highest, double = 8, 1, 5, 4
+			}
+			if from := to + back; to/8 >= lowest && to/8 <= highest && occ&(1<<uint(from)) == 0 {
+				froms |= 1 << uint(from)
+				if from2 := from + back; to/8 == double && occ&(1<<uint(from2)) == 0 {
+					froms |= 1 << uint(from2)
+				}
+			}
+		} else {
+			froms = dtmTargets(slot.name, to, occ) &^ occ
+		}
+		for from := 0; from < 64; from++ {
+			if froms&(1<<uint(from)) != 0 {
+				q.squares[i] = from
+				f(q.index())
+			}
+		}
+		q.squares[i] = to
+	}
+}
+
+// Makes a table and the tables it leads into, keeping each one made so that it is only made once.
+type dtmGenerator struct {
+	tables map[string]*DTMTable
+}
+
+// A table a capture or promotion leads into, with the slot each piece moves to in it.
+type dtmChild struct {
+	table *DTMTable
+	slots [DTMMAXPIECES]int // -1 for the piece taken
+	flip  bool
+}
+
+// Makes the distance to mate table of a signature, along with the tables of the endgames its captures and
+// promotions lead into. A four piece table takes about fifty megabytes, three times the size of the table, and
+// half a minute or so to make.
+func GenerateDTM(signature string) (*DTMTable, error) {
+	g := &dtmGenerator{tables: make(map[string]*DTMTable)}
+	return g.generate(signature)
+}
+
+// Returns the table a capture of slot captured and a promotion of slot promoted (-1 for none) lead into from t.
+func (g *dtmGenerator) child(t *DTMTable, captured, promoted int, promotion byte) (*dtmChild, error) {
+	var sides [2][]byte
+	var names [DTMMAXPIECES]byte
+	for i, slot := range t.slots {
+		names[i] = slot.name
+		if i == promoted {
+			names[i] = promotion
+		}
+		if i != captured {
+			sides[slot.side] = append(sides[slot.side], names[i]-'a'+'A')
+		}
+	}
+	raw := syzygyOrder(sides[0]) + syzygyOrder(sides[1])
+	signature, err := CanonicalSignature(raw)
+	if err != nil {
+		return nil, err
+	}
+	table, err := g.generate(signature)
+	if err != nil {
+		return nil, err
+	}
+	c := &dtmChild{table: table, flip: signature != raw}
+	var used [DTMMAXPIECES]bool
+	for i, slot := range t.slots {
+		c.slots[i] = -1
+		if i == captured {
+			continue
+		}
+		side := slot.side
+		if c.flip {
+			side = 1 - side
+		}
+		for j, s := range table.slots {
+			if !used[j] && s.name == names[i] && s.side == side {
+				used[j], c.slots[i] = true, j
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+// Returns the value of the position a move leads to in the child table, for the side to move there.
+func (c *dtmChild) value(p *dtmPosition, m dtmMove) byte {
+	q := dtmPosition{table: c.table, stm: 1 - p.stm}
+	if c.flip {
+		q.stm = p.stm
+	}
+	for i := range p.table.slots {
+		if j := c.slots[i]; j >= 0 {
+			s := p.squares[i]
+			if i == m.slot {
+				s = m.to
+			}
+			if c.flip {
+				s ^= 56
+			}
+			q.squares[j] = s
+		}
+	}
+	return c.table.values[q.index()]
+}
+
+// Ranks a value for the side to move: wins first, the sooner the better, then draws, then losses, the later
+// the better.
+func dtmRank(v byte) int {
+	switch {
+	case v < dtmMated:
+		return 0
+	case (v-dtmMated)%2 == 1:
+		return 1000 - int(v)
+	}
+	return -1000 + int(v)
+}
+
+func (g *dtmGenerator) generate(signature string) (*DTMTable, error) {
+	signature, err := CanonicalSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := g.tables[signature]; ok {
+		return t, nil
+	}
+	t := newDTMTable(signature)
+	n := len(t.slots)
+
+	// the tables captures and promotions lead into, by the slot taken and the slot promoted and its new piece
+	var children [DTMMAXPIECES + 1][DTMMAXPIECES + 1][5]*dtmChild
+	for captured := -1; captured < n; captured++ {
+		for promoted := -1; promoted < n; promoted++ {
+			for k, promotion := range append([]byte{0}, dtmPromotions...) {
+				if (captured >= 0 && t.slots[captured].name == 'k') || (captured == promoted && captured >= 0) ||
+					(promoted >= 0) != (promotion != 0) || (promoted >= 0 && t.slots[promoted].name != 'p') ||
+					(captured < 0 && promoted < 0) {
+					continue
+				}
+				if captured >= 0 && promoted >= 0 && t.slots[captured].side == t.slots[promoted].side {
+					continue
+				}
+				if children[captured+1][promoted+1][k], err = g.child(t, captured, promoted, promotion); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	promotionIndex := map[byte]int{0: 0, 'q': 1, 'r': 2, 'b': 3, 'n': 4}
+
+	// the quiet moves of each position not yet known to lose, and the best result of its captures and promotions:
+	// 0 if it has none, 1 for a draw, otherwise the value it leads to
+	counts := make([]byte, len(t.values))
+	conversions := make([]byte, len(t.values))
+	longest := 0
+	moves := make([]dtmMove, 0, 64)
+	for idx := range t.values {
+		p := t.position(idx)
+		if !p.valid() {
+			t.values[idx] = dtmInvalid
+			continue
+		}
+		moves = p.moves(moves[:0])
+		if len(moves) == 0 {
+			if p.inCheck(p.stm, -1) {
+				t.values[idx] = dtmMated
+			}
+			continue
+		}
+		var quiet int
+		var best byte
+		for _, m := range moves {
+			if m.captured < 0 && m.promotion == 0 {
+				quiet++
+				continue
+			}
+			v := byte(1)
+			if child := children[m.captured+1][promotedSlot(m)+1][promotionIndex[m.promotion]]; child != nil {
+				if cv := child.value(&p, m); cv >= dtmMated {
+					v = cv + 1
+				}
+			}
+			if best == 0 || dtmRank(v) > dtmRank(best) {
+				best = v
+			}
+		}
+		counts[idx], conversions[idx] = byte(quiet), best
+		if best >= dtmMated && int(best-dtmMated) > longest {
+			longest = int(best - dtmMated)
+		}
+		if quiet == 0 && best >= dtmMated {
+			t.values[idx] = best
+		}
+	}
+
+	// then back from the mates one half-move at a time: a position one move before a lost one is won, and a
+	// position whose every move leads to a won one is lost
+	for plies := 0; plies <= longest; plies++ {
+		if longest > DTMMAXPLIES {
+			return nil, fmt.Errorf("%s: mate in more than %d half-moves", signature, DTMMAXPLIES)
+		}
+		level := byte(dtmMated + plies)
+		for idx := range t.values {
+			if t.values[idx] == dtmDraw && plies%2 == 1 && conversions[idx] == level {
+				t.values[idx] = level
+			}
+			if t.values[idx] != level {
+				continue
+			}
+			p := t.position(idx)
+			p.unmoves(func(q int) {
+				if t.values[q] != dtmDraw {
+					return
+				}
+				if plies%2 == 0 {
+					t.values[q] = level + 1
+					if plies+1 > longest {
+						longest = plies + 1
+					}
+					return
+				}
+				counts[q]--
+				if c := conversions[q]; counts[q] == 0 && (c == 0 || dtmRank(c) < 0) {
+					// lost by the longest of its moves, this one or a capture or promotion
+					t.values[q] = level + 1
+					if c > level+1 {
+						t.values[q] = c
+					}
+					if int(t.values[q]-dtmMated) > longest {
+						longest = int(t.values[q] - dtmMated)
+					}
+				}
+			})
+		}
+	}
+	g.tables[signature] = t
+	return t, nil
+}
+
+// Returns the slot a move promotes, or -1.
+func promotedSlot(m dtmMove) int {
+	if m.promotion == 0 {
+		return -1
+	}
+	return m.slot
+}
+
+// Writes the table to a file in the format described at Write.
+func (t *DTMTable) Save(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := t.Write(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Writes the table compactly:
+//
+//	magic      4 bytes, "CDTM"
+//	version    uint32, little endian, 1
+//	signature  a length byte, then the signature
+//	values     a DEFLATE stream of one byte for every index: 0 for a draw, 1 for an impossible position, and
+//	           otherwise 2 plus the half-moves to mate, won by the side to move when they are odd
+func (t *DTMTable) Write(w io.Writer) error {
+	header := append([]byte(dtmMagic), 0, 0, 0, 0, byte(len(t.Signature)))
+	binary.LittleEndian.PutUint32(header[4:], dtmVersion)
+	if _, err := w.Write(append(header, t.Signature...)); err != nil {
+		return err
+	}
+	fw, err := flate.NewWriter(w, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(t.values); err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+// Reads a table from a file in the format described at Write.
+func LoadDTMTable(filename string) (*DTMTable, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	t, err := ReadDTMTable(file)
+	if err != nil {
+		return nil, fmt.Errorf("func LoadDTMTable: %s: %s", filename, err)
+	}
+	return t, nil
+}
+
+// Reads a table in the format described at Write.
+func ReadDTMTable(r io.Reader) (*DTMTable, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != dtmMagic {
+		return nil, errors.New("not a distance to mate table")
+	}
+	if version := binary.LittleEndian.Uint32(header[4:]); version != dtmVersion {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+	signature := make([]byte, header[8])
+	if _, err := io.ReadFull(br, signature); err != nil {
+		return nil, err
+	}
+	if canonical, err := CanonicalSignature(string(signature)); err != nil || canonical != string(signature) {
+		return nil, fmt.Errorf("bad signature %q", signature)
+	}
+	t := newDTMTable(string(signature))
+	fr := flate.NewReader(br)
+	if _, err := io.ReadFull(fr, t.values); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if _, err := fr.Read(make([]byte, 1)); err != io.EOF {
+		return nil, errors.New("trailing data")
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data")
+	}
+	return t, nil
+}
+
+// A set of distance to mate tables, used as a MateTablebase. The tables know nothing of the distance to zeroing,
+// and their results ignore the fifty move rule: a win that needs more than fifty moves without a capture or a
+// pawn move is still a win, never a cursed one.
+type DTMTablebase struct {
+	tables    map[string]*DTMTable
+	maxpieces int
+}
+
+// Makes a tablebase of the tables given.
+func NewDTMTablebase(tables ...*DTMTable) *DTMTablebase {
+	d := &DTMTablebase{tables: make(map[string]*DTMTable)}
+	for _, t := range tables {
+		d.tables[t.Signature] = t
+		if len(t.slots) > d.maxpieces {
+			d.maxpieces = len(t.slots)
+		}
+	}
+	return d
+}
+
+// Reads the tables (*.dtm) in a list of directories separated as in $PATH.
+// Every table is kept in memory uncompressed, 16 MB for each of four pieces. The tables hold no distance to
+// zeroing, so a search ranks its root moves by the distance to mate alone.
+func LoadDTM(path string) (*DTMTablebase, error) {
+	var tables []*DTMTable
+	for _, dir := range filepath.SplitList(path) {
+		filenames, err := filepath.Glob(filepath.Join(dir, "*.dtm"))
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range filenames {
+			t, err := LoadDTMTable(filename)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, t)
+		}
+	}
+	return NewDTMTablebase(tables...), nil
+}
+
+// Returns the table of a position's material, or nil.
+func (d *DTMTablebase) Table(b *engine.Board) *DTMTable {
+	signature, err := CanonicalSignature(strings.Replace(materialKey(b), "v", "", 1))
+	if err != nil {
+		return nil
+	}
+	return d.tables[signature]
+}
+
+// Looks up a position in the table of its material, see DTMTable.Probe. Positions with castling rights or a pawn
+// that can be taken en passant are not probed.
+func (d *DTMTablebase) Probe(b *engine.Board) (wdl, plies int, ok bool) {
+	if pieceCount(b) > d.maxpieces || castlingRights(b) {
+		return 0, 0, false
+	}
+	for _, p := range b.Board {
+		if p.Can_en_passant && !p.Captured {
+			return 0, 0, false
+		}
+	}
+	t := d.Table(b)
+	if t == nil {
+		return 0, 0, false
+	}
+	return t.Probe(b)
+}
+
+// Returns the most pieces of any table.
+func (d *DTMTablebase) MaxPieces() int {
+	return d.maxpieces
+}
+
+// See Tablebase.
+func (d *DTMTablebase) ProbeWDL(b *engine.Board) (int, bool) {
+	wdl, _, ok := d.Probe(b)
+	return wdl, ok
+}
+
+// Never finds a position, as the tables do not hold the distance to zeroing.
+func (d *DTMTablebase) ProbeDTZ(b *engine.Board) (int, bool) {
+	return 0, false
+}
+
+// See MateTablebase.
+func (d *DTMTablebase) ProbeDTM(b *engine.Board) (int, bool) {
+	wdl, plies, ok := d.Probe(b)
+	return plies * sign(wdl), ok
+}
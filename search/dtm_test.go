@@ -0,0 +1,199 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestCanonicalSignature(t *testing.T) {
+	tests := []struct {
+		signature, canonical string
+		ok                   bool
+	}{
+		{"KQK", "KQK", true},
+		{"KKQ", "KQK", true},
+		{"KNKR", "KRKN", true},
+		{"KPRK", "KRPK", true},
+		{"KBKN", "KNKB", true},
+		{"KK", "KK", true},
+		{"KQRBK", "", false},
+		{"KQ", "", false},
+		{"QKK", "", false},
+		{"KXK", "", false},
+	}
+	for _, test := range tests {
+		if canonical, err := CanonicalSignature(test.signature); canonical != test.canonical || (err == nil) != test.ok {
+			t.Errorf("Expected %s to give %q %v, got %q %v", test.signature, test.canonical, test.ok, canonical, err)
+		}
+	}
+}
+
+func TestGenerateDTM(t *testing.T) {
+	tests := []struct {
+		signature string
+		longest   int
+	}{
+		{"KQK", 20}, // mated in ten with black to move
+		{"KRK", 32}, // mated in sixteen
+		{"KBK", 0},
+	}
+	for _, test := range tests {
+		table, err := GenerateDTM(test.signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if longest := table.LongestMate(); longest != test.longest {
+			t.Errorf("Expected the longest mate in %s to take %d half-moves, got %d", test.signature, test.longest, longest)
+		}
+	}
+
+	table, err := GenerateDTM("KPK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.values) != 1<<18 {
+		t.Errorf("Expected KPK to keep only the white king on files a-d, in %d bytes, got %d", 1<<18, len(table.values))
+	}
+	square := func(s int) engine.Square {
+		return engine.Square{X: s%8 + 1, Y: s/8 + 1}
+	}
+	for idx, v := range table.values {
+		if v == dtmInvalid {
+			continue
+		}
+		p := table.position(idx)
+		won := v >= dtmMated && int(v-dtmMated)%2 == 1-p.stm
+		if wins := kpkWins(square(p.squares[0]), square(p.squares[2]), square(p.squares[1]), 1, 1-2*p.stm); won != wins {
+			t.Fatalf("Expected the table to agree with the bitbase on %v, got %d", p.squares, v)
+		}
+	}
+
+	kqk, _ := GenerateDTM("KQK")
+	tb := NewDTMTablebase(table, kqk)
+	probes := []struct {
+		fen        string
+		wdl, plies int
+		ok         bool
+	}{
+		{"8/8/8/8/8/4k3/4P3/4K3 w", TBDRAW, 0, true},
+		{"7k/8/6K1/8/8/8/8/1Q6 w", TBWON, 1, true},
+		{"k7/8/1K6/8/8/8/8/6Q1 w", TBWON, 1, true}, // mirrored across the d/e file
+		{"Q6k/8/6K1/8/8/8/8/8 b", TBLOSS, 0, true},
+		{"1q6/8/8/8/8/6k1/8/7K b", TBWON, 1, true}, // the colors the other way round
+		{"8/8/8/8/8/1k6/8/K6q w", TBLOSS, 0, true},
+		{"8/8/8/8/8/4k3/8/R3K3 w Q", 0, 0, false},
+		{"8/8/8/8/8/4k3/4R3/4K3 w", 0, 0, false},
+	}
+	for _, test := range probes {
+		board, _ := engine.FromFen(test.fen)
+		if wdl, plies, ok := tb.Probe(board); wdl != test.wdl || plies != test.plies || ok != test.ok {
+			t.Errorf("Expected %d %d %v for %s, got %d %d %v", test.wdl, test.plies, test.ok, test.fen, wdl, plies, ok)
+		}
+		if dtm, ok := tb.ProbeDTM(board); dtm != test.plies*sign(test.wdl) || ok != test.ok {
+			t.Errorf("Expected DTM %d %v for %s, got %d %v", test.plies*sign(test.wdl), test.ok, test.fen, dtm, ok)
+		}
+		if _, ok := tb.ProbeDTZ(board); ok {
+			t.Errorf("Expected no distance to zeroing for %s", test.fen)
+		}
+	}
+}
+
+func TestDTMTableFile(t *testing.T) {
+	table, err := GenerateDTM("KRK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := table.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= len(table.values)/4 {
+		t.Errorf("Expected the table to compress, got %d bytes for %d positions", buf.Len(), len(table.values))
+	}
+	read, err := ReadDTMTable(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Signature != "KRK" || !bytes.Equal(read.values, table.values) {
+		t.Error("Expected the table read back to be the one written")
+	}
+	data := buf.Bytes()
+	for _, bad := range [][]byte{data[:len(data)-5], append(append([]byte{}, data...), 0), append([]byte("XDTM"), data[4:]...)} {
+		if _, err := ReadDTMTable(bytes.NewReader(bad)); err == nil {
+			t.Error("Expected an error for a damaged table")
+		}
+	}
+
+	dir := t.TempDir()
+	if err := table.Save(filepath.Join(dir, "KRK.dtm")); err != nil {
+		t.Fatal(err)
+	}
+	tb, err := LoadDTM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a shallow search sees no mate, but the tables keep it to the moves that mate soonest
+	board, _ := engine.FromFen("8/8/8/8/8/2k5/8/R3K3 w")
+	_, plies, _ := tb.Probe(board)
+	result := Search(context.Background(), board, Options{Depth: 2, Tablebase: tb})
+	board.ForceMove(result.Move)
+	if wdl, after, _ := tb.Probe(board); wdl != TBLOSS || after != plies-1 || result.TBHits == 0 {
+		t.Errorf("Expected a move to a loss in %d half-moves, got %s to %d %d", plies-1, result.Move.ToString(), wdl, after)
+	}
+	// the distance to mate is not a distance to zeroing, so a long mate late in the fifty moves is still a win
+	board.UndoMove(result.Move)
+	th := newThread(context.Background(), board.Copy(), nil, nil)
+	defer th.close()
+	th.tablebase = tb
+	th.setHistory(nil, 90)
+	th.makeMove(result.Move)
+	if rank, ok := th.rootRank(); rank != 1000*TBWON-plies || !ok {
+		t.Errorf("Expected a win in %d half-moves to rank %d with the fifty moves nearly up, got %d", plies, 1000*TBWON-plies, rank)
+	}
+}
+
+func TestGenerateDTMFourPieces(t *testing.T) {
+	if testing.Short() {
+		t.Skip("making a four piece table takes a while")
+	}
+	table, err := GenerateDTM("KRKN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if longest := table.LongestMate(); longest != 80 {
+		t.Errorf("Expected the longest mate in KRKN to take 80 half-moves, got %d", longest) // mated in forty
+	}
+	tb := NewDTMTablebase(table)
+	probes := []struct {
+		fen        string
+		wdl, plies int
+	}{
+		{"k7/8/K7/8/4n3/8/8/7R w", TBWON, 1},
+		{"R6k/8/6K1/8/8/8/8/n7 b", TBLOSS, 0},
+		{"r6K/8/6k1/8/8/8/8/N7 w", TBLOSS, 0}, // the colors the other way round
+		{"4k3/8/8/8/8/1n6/8/R3K3 b", TBDRAW, 0},
+		{"r3k3/8/1N6/8/8/8/8/4K3 w", TBDRAW, 0},
+	}
+	for _, test := range probes {
+		board, _ := engine.FromFen(test.fen)
+		if wdl, plies, ok := tb.Probe(board); wdl != test.wdl || plies != test.plies || !ok {
+			t.Errorf("Expected %d %d for %s, got %d %d %v", test.wdl, test.plies, test.fen, wdl, plies, ok)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := table.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadDTMTable(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Signature != "KRKN" || !bytes.Equal(read.values, table.values) {
+		t.Error("Expected the table read back to be the one written")
+	}
+}
@@ -0,0 +1,201 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Endgames the general evaluation gets wrong are recognized by their material. Some are scored by evaluators of
+// their own, which know how the win is forced, and in others the score is scaled down towards a draw.
+// Reference: https://www.chessprogramming.org/Endgame
+const (
+	KNOWNWIN    = 10000 // added to the score of an endgame known to be won, above any score of the general evaluation
+	SCALENORMAL = 64    // the scale factor of a position no endgame knowledge applies to
+	SCALEOCB    = 32    // opposite-coloured bishops with pawns on both sides or more than one pawn between them
+	SCALEOCBONE = 16    // opposite-coloured bishops where one side is at most a pawn ahead
+	PUSHTOEDGE  = 20    // per step the weak king is from the centre, to mate it on the edge
+	PUSHCLOSE   = 20    // per step the kings are closer than the furthest they can be, to help the mate
+	PUSHCORNER  = 200   // per step the weak king is towards a corner the bishop covers, against king, bishop and knight
+)
+
+// What the evaluation knows about the endgame on a board.
+type endgameInfo struct {
+	name  string // the endgame recognized, "" if none
+	known bool   // whether score replaces the general evaluation
+	score int    // the white-relative score, when known
+	scale int    // how much of the general evaluation is kept, out of SCALENORMAL
+}
+
+// The pieces of one side.
+type sideMaterial struct {
+	king   engine.Square
+	pawns  []engine.Square
+	pieces []*engine.Piece // every piece but the king and the pawns
+	counts [6]int          // by materialIndex
+}
+
+// Returns the place of a piece in the counts of sideMaterial.
+func materialIndex(name byte) int {
+	return strings.IndexByte("pnbrqk", name)
+}
+
+func (m *sideMaterial) count(name byte) int {
+	return m.counts[materialIndex(name)]
+}
+
+func (m *sideMaterial) only(name byte) bool {
+	return len(m.pieces) == m.count(name)
+}
+
+// Returns whether a side has only its king.
+func (m *sideMaterial) bare() bool {
+	return m.counts == [6]int{5: 1}
+}
+
+// Recognizes the endgames the evaluation has knowledge of.
+// Each of them has a bare king on one side or a single bishop on each, so the material is counted first and any
+// other position is left before the pieces are listed.
+func probeEndgame(b *engine.Board) endgameInfo {
+	var sides [2]sideMaterial
+	for _, p := range b.Board {
+		if !p.Captured {
+			sides[colorSide(p.Color)].counts[materialIndex(p.Name)]++
+		}
+	}
+	white, black := &sides[0], &sides[1]
+	pieces := func(m *sideMaterial) int { return m.count('n') + m.count('b') + m.count('r') + m.count('q') }
+	lonebishops := pieces(white) == 1 && pieces(black) == 1 && white.count('b') == 1 && black.count('b') == 1
+	if !white.bare() && !black.bare() && !lonebishops {
+		return endgameInfo{scale: SCALENORMAL}
+	}
+	for _, p := range b.Board {
+		if p.Captured {
+			continue
+		}
+		m := &sides[colorSide(p.Color)]
+		switch p.Name {
+		case 'k':
+			m.king = p.Position
+		case 'p':
+			m.pawns = append(m.pawns, p.Position)
+		default:
+			m.pieces = append(m.pieces, p)
+		}
+	}
+	info := endgameInfo{scale: SCALENORMAL}
+	for side, color := range []int{1, -1} {
+		strong, weak := &sides[side], &sides[1-side]
+		if len(weak.pieces) > 0 || len(weak.pawns) > 0 {
+			continue
+		}
+		switch {
+		case len(strong.pieces) == 0 && len(strong.pawns) == 1:
+			info.name, info.known = "KPK", true
+			if kpkWins(strong.king, weak.king, strong.pawns[0], color, b.Turn) {
+				info.score = KNOWNWIN + VALUES['p'] + 10*relativeRank(strong.pawns[0], color)
+			}
+		case len(strong.pawns) == 0 && len(strong.pieces) == 2 && strong.count('b') == 1 && strong.count('n') == 1:
+			info.name, info.known = "KBNK", true
+			info.score = KNOWNWIN + VALUES['b'] + VALUES['n'] + kbnkScore(strong, weak)
+		case strong.count('q') > 0 || strong.count('r') > 0:
+			info.name, info.known = "KXK", true
+			if len(strong.pieces) == 1 && len(strong.pawns) == 0 {
+				info.name = map[byte]string{'q': "KQK", 'r': "KRK"}[strong.pieces[0].Name]
+			}
+			info.score = KNOWNWIN + kxkScore(strong, weak)
+		case wrongRookPawn(strong, weak, color):
+			info.name, info.scale = "wrong rook pawn", 0
+		}
+		info.score *= color
+		if info.name != "" {
+			return info
+		}
+	}
+	if len(white.pieces) == 1 && len(black.pieces) == 1 && white.only('b') && black.only('b') &&
+		squareColor(white.pieces[0].Position) != squareColor(black.pieces[0].Position) {
+		info.name, info.scale = "opposite bishops", SCALEOCB
+		if absInt(len(white.pawns)-len(black.pawns)) <= 1 {
+			info.scale = SCALEOCBONE
+		}
+	}
+	return info
+}
+
+// Returns 0 for a dark square and 1 for a light one.
+func squareColor(s engine.Square) int {
+	return (s.X + s.Y) % 2
+}
+
+func chebyshev(a, b engine.Square) int {
+	dx, dy := absInt(a.X-b.X), absInt(a.Y-b.Y)
+	if dx > dy {
+		return dx
+	}
+	return dy
+}
+
+// Returns how many steps a square is from the four centre squares, horizontally plus vertically.
+func centreDistance(s engine.Square) int {
+	dx, dy := s.X-5, s.Y-5
+	if s.X <= 4 {
+		dx = 4 - s.X
+	}
+	if s.Y <= 4 {
+		dy = 4 - s.Y
+	}
+	return dx + dy
+}
+
+// Scores the strong side's material, driving the weak king to the edge with the strong king close by.
+func kxkScore(strong, weak *sideMaterial) int {
+	score := 0
+	for _, p := range strong.pieces {
+		score += VALUES[p.Name]
+	}
+	score += len(strong.pawns) * VALUES['p']
+	return score + PUSHTOEDGE*centreDistance(weak.king) + PUSHCLOSE*(7-chebyshev(strong.king, weak.king))
+}
+
+// King, bishop and knight can only mate in a corner the bishop covers, so the weak king is driven away from the
+// long diagonal of the other color towards those corners. The drive outweighs everything else, or the weak king
+// settles in a corner where it cannot be mated.
+func kbnkScore(strong, weak *sideMaterial) int {
+	var bishop engine.Square
+	for _, p := range strong.pieces {
+		if p.Name == 'b' {
+			bishop = p.Position
+		}
+	}
+	// a dark bishop mates in a1 and h8, furthest from the light diagonal a8-h1
+	distance := absInt(9 - weak.king.X - weak.king.Y)
+	if squareColor(bishop) == 1 {
+		distance = absInt(weak.king.X - weak.king.Y)
+	}
+	return PUSHCORNER*distance + PUSHCLOSE*(7-chebyshev(strong.king, weak.king))
+}
+
+// Pawns all on a rook's file cannot win, with at most a bishop that does not cover the promotion square, once the
+// weak king stands in front of them.
+func wrongRookPawn(strong, weak *sideMaterial, color int) bool {
+	if len(strong.pawns) == 0 || len(strong.pieces) > 1 || (len(strong.pieces) == 1 && !strong.only('b')) {
+		return false
+	}
+	file := strong.pawns[0].X
+	if file != 1 && file != 8 {
+		return false
+	}
+	for _, p := range strong.pawns {
+		if p.X != file {
+			return false
+		}
+	}
+	promotion := engine.Square{X: file, Y: 8}
+	if color == -1 {
+		promotion.Y = 1
+	}
+	if len(strong.pieces) == 1 && squareColor(strong.pieces[0].Position) == squareColor(promotion) {
+		return false
+	}
+	return chebyshev(weak.king, promotion) <= 1
+}
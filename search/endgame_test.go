@@ -0,0 +1,115 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Plays a position out with the engine on both sides at the given depth, and returns the result as
+// engine.Board.IsOver does, or 1 for a draw by repetition, the fifty move rule or lack of material.
+// Returns 0 if the game is still going after maxplies half-moves.
+func playOut(t *testing.T, fen string, depth, maxplies int) int {
+	board, err := engine.FromFen(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := []uint64{board.Hash()}
+	table := NewTranspositionTable(16)
+	for ply := 0; ply < maxplies; ply++ {
+		if over := board.IsOver(); over != 0 {
+			return over
+		}
+		if board.InsufficientMaterial() || repetitions(history) >= 3 || len(history) > FIFTYMOVES {
+			return 1
+		}
+		result := Search(context.Background(), board, Options{Depth: depth, Table: table, History: history[:len(history)-1], HalfmoveClock: len(history) - 1})
+		board.ForceMove(result.Move)
+		if result.Move.Piece == 'p' || result.Move.Capture != 0 {
+			history = history[:0]
+		}
+		history = append(history, board.Hash())
+	}
+	return 0
+}
+
+func TestKPK(t *testing.T) {
+	tests := []struct {
+		strongking, weakking, pawn string
+		strong, turn               int
+		win                        bool
+	}{
+		{"e6", "e8", "e5", 1, 1, true}, // the king in front of the pawn on the sixth rank
+		{"e6", "e8", "e5", 1, -1, true},
+		{"e3", "e5", "e2", 1, 1, false}, // the defender has the opposition
+		{"e3", "e5", "e2", 1, -1, true},
+		{"e6", "e4", "e7", -1, -1, false}, // the same, with black's pawn
+		{"e6", "e4", "e7", -1, 1, true},
+		{"d3", "d5", "d2", 1, 1, false}, // the same, on the other half of the board
+		{"a6", "a8", "a5", 1, 1, false}, // a rook pawn with the defender in the corner
+		{"g7", "a1", "h6", 1, -1, true},
+		{"a1", "h8", "d5", 1, -1, false}, // the pawn is caught
+		{"a1", "h8", "d5", 1, 1, true},
+		{"a1", "d7", "d5", 1, 1, false}, // the defender in front of the pawn, the attacking king too far away
+	}
+	for _, test := range tests {
+		at := squares(test.strongking, test.weakking, test.pawn)
+		if win := kpkWins(at[0], at[1], at[2], test.strong, test.turn); win != test.win {
+			t.Errorf("Expected K%s P%s against K%s with %d to move to be a win: %v, got %v", test.strongking, test.pawn, test.weakking, test.turn, test.win, win)
+		}
+	}
+}
+
+func TestEndgamePlayOut(t *testing.T) {
+	tests := []struct {
+		name, fen     string
+		depth, result int
+	}{
+		{"KQK", "8/8/8/3k4/8/8/8/4K2Q w", 3, 2},
+		{"KRK", "8/8/8/3k4/8/8/8/R3K3 w", 3, 2},
+		{"KRK for black", "r3k3/8/8/8/3K4/8/8/8 b", 3, -2},
+		// driving the king out of the wrong corner takes a few moves more than a shallow search sees
+		{"KBNK", "8/8/8/4k3/8/8/8/2B1KN2 w", 5, 2},
+		{"KPK won", "4k3/8/8/8/8/8/4P3/4K3 w", 3, 2},
+		{"KPK drawn", "8/8/8/4k3/8/4K3/4P3/8 w", 3, 1},
+		{"KPK rook pawn", "1k6/8/K7/P7/8/8/8/8 w", 3, 1},
+		{"wrong rook pawn", "k7/8/8/8/8/8/P7/2B1K3 w", 3, 1},
+		{"wrong rook pawn too far", "7k/8/8/8/8/8/P7/2B1K3 w", 3, 2},
+	}
+	for _, test := range tests {
+		if result := playOut(t, test.fen, test.depth, 200); result != test.result {
+			t.Errorf("Expected %s to end in %d, got %d", test.name, test.result, result)
+		}
+	}
+}
+
+func TestEndgameEvaluation(t *testing.T) {
+	eval := func(fen string) int {
+		board, err := engine.FromFen(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return EvalBoard(board)
+	}
+	if right, wrong := eval("7k/8/5K2/8/8/8/8/2B2N2 w"), eval("k7/8/2K5/8/8/8/8/2B2N2 w"); right <= wrong || wrong < KNOWNWIN {
+		t.Errorf("Expected KBNK to be won, and more so with the king in the bishop's corner, got %d and %d", right, wrong)
+	}
+	if edge, centre := eval("3k4/8/3K4/8/8/8/8/7R w"), eval("8/8/3k4/8/8/3K4/8/7R w"); edge <= centre || centre < KNOWNWIN {
+		t.Errorf("Expected KRK to be won, and more so with the king on the edge, got %d and %d", edge, centre)
+	}
+	if score := eval("8/8/8/8/4p3/4k3/8/4K3 w"); score > -KNOWNWIN {
+		t.Errorf("Expected black's KPK to be won, got %d", score)
+	}
+	if score := eval("k7/8/8/8/8/8/P7/2B1K3 w"); score != DRAW {
+		t.Errorf("Expected a wrong rook pawn to be a draw, got %d", score)
+	}
+	opposite, same := eval("4k3/8/3b4/8/8/3B4/4P3/4K3 w"), eval("4k3/8/4b3/8/8/3B4/4P3/4K3 w")
+	if opposite <= 0 || opposite*2 > same {
+		t.Errorf("Expected opposite-coloured bishops to scale the score down, got %d and %d", opposite, same)
+	}
+	board, _ := engine.FromFen("4k3/8/3b4/8/8/3B4/4P3/4K3 w")
+	if trace := TraceEval(board, nil); trace.Endgame != "opposite bishops" || trace.Scale != SCALEOCBONE {
+		t.Errorf("Expected the trace to show the scale factor, got %q %d", trace.Endgame, trace.Scale)
+	}
+}
@@ -3,30 +3,67 @@ package search
 import "github.com/jacobroberts/chess/engine"
 
 const (
-	WHITEWIN        float64 = 255
-	BLACKWIN        float64 = -255
-	DRAW            float64 = 0
-	HUNGPIECE               = 0
-	ADVANCEDPAWN            = .075 // how far a pawn is from its starting rank
-	LONGPAWNCHAIN           = .03  // per pawn
-	ISOLATEDPAWN            = -.3
-	DOUBLEDPAWN             = -.4  // increases for tripled, etc. pawns
-	KINGINCORNER            = .15  // king in a castled position
-	KINGONOPENFILE          = -.3  // king not protected by a pawn
-	KINGPROTECTED           = .1   // king protected by a pawn, applies to pawns on files near king
-	PASSEDPAWN              = .75  // pawn has no opposing pawns blocking it from promoting
-	CENTRALKNIGHT           = .5   // knight close to center of board
-	BISHOPSQUARES           = .125 // per square a bishop attacks
-	ROOKONSEVENTH           = .8   // rook is on the second to last rank relative to color
-	CONNECTEDROOKS          = .5   // both rooks share the same rank or file
-	IMPORTANTSQUARE         = .28  // the central squares
-	WEAKSQUARE              = .03  // outer squares
+	WHITEWIN = 30000
+	BLACKWIN = -30000
+	DRAW     = 0
+
+	MAXPHASE = 24 // game phase with every piece on the board, see gamePhase
 )
 
+// A score in centipawns, with one weight for the middlegame and another for the endgame.
+// Evaluation terms are summed as Scores and blended by the game phase at the end, see taper.
+type Score struct {
+	MG int `json:"mg"`
+	EG int `json:"eg"`
+}
+
 var (
-	VALUES = map[byte]int{'p': 1, 'n': 3, 'b': 3, 'r': 5, 'q': 9}
+	HUNGPIECE       = Score{0, 0}
+	ADVANCEDPAWN    = Score{5, 12} // how far a pawn is from its starting rank
+	LONGPAWNCHAIN   = Score{3, 3}  // per pawn
+	ISOLATEDPAWN    = Score{-30, -25}
+	DOUBLEDPAWN     = Score{-40, -40} // increases for tripled, etc. pawns
+	CONNECTEDROOKS  = Score{50, 20}   // both rooks share the same rank or file
+	IMPORTANTSQUARE = Score{28, 10}   // the central squares
+	WEAKSQUARE      = Score{3, 3}     // outer squares
+
+	VALUES   = map[byte]int{'p': 100, 'n': 300, 'b': 300, 'r': 500, 'q': 900} // for exchanges and move ordering
+	MATERIAL = map[byte]Score{'p': {90, 120}, 'n': {310, 290}, 'b': {320, 310}, 'r': {480, 540}, 'q': {950, 960}}
+	PHASE    = map[byte]int{'n': 1, 'b': 1, 'r': 2, 'q': 4} // how much each piece counts towards the middlegame
 )
 
+func (s Score) plus(o Score) Score {
+	return Score{s.MG + o.MG, s.EG + o.EG}
+}
+
+func (s Score) minus(o Score) Score {
+	return Score{s.MG - o.MG, s.EG - o.EG}
+}
+
+func (s Score) times(n int) Score {
+	return Score{s.MG * n, s.EG * n}
+}
+
+// Returns how far the game is from the endgame, from MAXPHASE with all pieces on the board down to 0 with only
+// kings and pawns.
+func gamePhase(b *engine.Board) int {
+	phase := 0
+	for _, p := range b.Board {
+		if !p.Captured {
+			phase += PHASE[p.Name]
+		}
+	}
+	if phase > MAXPHASE {
+		return MAXPHASE
+	}
+	return phase
+}
+
+// Blends the middlegame and endgame weights of a score by the game phase.
+func taper(s Score, phase int) int {
+	return (s.MG*phase + s.EG*(MAXPHASE-phase)) / MAXPHASE
+}
+
 // default math package uses float64
 func absInt(i int) int {
 	if i > 0 {
@@ -94,28 +131,53 @@ func AttackRay(p *engine.Piece, b *engine.Board, dir [2]int) int {
 	return 7
 }
 
-// Returns the score from the point of view of the person whose turn it is.
-// Positive numbers indicate a stronger position.
-func EvalBoard(b *engine.Board) float64 {
+// Returns the score in centipawns from white's point of view.
+// Positive numbers indicate a stronger position for white, and a finished game scores WHITEWIN, BLACKWIN or DRAW.
+// Uses the default weights, see DefaultParams.
+func EvalBoard(b *engine.Board) int {
 	if over := b.IsOver(); over != 0 {
-		if over == 1 {
-			return DRAW
+		return gameOverScore(over)
+	}
+	return evaluate(b, defaultParams, boardPST(b, defaultParams.PST), nil)
+}
+
+// Evaluates a board with the given weights, or with an evaluator of its own for an endgame it recognizes, for a
+// caller that keeps track of the sum of its piece-square bonuses, pst. The pawn terms are looked up in pawns, which
+// may be nil. Checkmate and stalemate are left to the caller, which for the search has the moves at hand anyway.
+func evaluate(b *engine.Board, params *Params, pst Score, pawns *pawnTable) int {
+	endgame := probeEndgame(b)
+	if endgame.known {
+		return endgame.score
+	}
+	var terms evalTerms
+	evaluateTerms(b, params, pawns, &terms)
+	return taper(pst.plus(terms.sum()), gamePhase(b)) * endgame.scale / SCALENORMAL
+}
+
+// Returns the score of a finished game, given the result returned by engine.Board.IsOver.
+func gameOverScore(over int) int {
+	if over == 1 {
+		return DRAW
+	} else {
+		if over > 0 {
+			return WHITEWIN
 		} else {
-			if over > 0 {
-				return WHITEWIN
-			} else {
-				return BLACKWIN
-			}
+			return BLACKWIN
 		}
 	}
+}
+
+// Adds up every evaluation term but the piece-square bonuses, for each side.
+func evaluateTerms(b *engine.Board, params *Params, pawns *pawnTable, terms *evalTerms) {
 	attackarray := [8][8]int{}
 	whitepawns := []engine.Square{}
 	blackpawns := []engine.Square{}
-	var score float64
+	var maps boardMaps
 	for _, piece := range b.Board {
 		if !piece.Captured {
-			score += float64(VALUES[piece.Name] * piece.Color)
+			terms.add(termMaterial, piece.Color, params.Material[piece.Name])
 			updateAttackArray(b, piece, &attackarray)
+			maps.add(piece)
 			if piece.Name == 'p' {
 				if piece.Color == 1 {
 					whitepawns = append(whitepawns, piece.Position)
@@ -125,49 +187,30 @@ func EvalBoard(b *engine.Board) float64 {
 			}
 		}
 	}
-	score += pawnStructureAnalysis(whitepawns, 1)
-	score -= pawnStructureAnalysis(blackpawns, -1)
+	pawnentry := pawns.probe(b, params, whitepawns, blackpawns)
+	for side, color := range []int{1, -1} {
+		terms.add(termPawns, color, pawnentry.structure[side])
+		terms.add(termPassed, color, pawnentry.passedscore[side])
+	}
 	whiterooks := []engine.Square{}
 	blackrooks := []engine.Square{}
 	for _, piece := range b.Board {
 		if !piece.Captured {
 			if piece.Name != 'q' && piece.Name != 'k' {
 				if attackarray[piece.Position.X-1][piece.Position.Y-1]*piece.Color < 1 {
-					score += float64(piece.Color) * HUNGPIECE
+					terms.add(termSquares, piece.Color, params.HungPiece)
 				}
 			}
 			switch piece.Name {
 			case 'k':
 				if piece.Color == 1 {
-					score += checkKingSafety(piece.Position.X, whitepawns)
-				} else {
-					score -= checkKingSafety(piece.Position.X, blackpawns)
-				}
-			case 'p':
-				// reward passed pawns
-				if piece.Color == 1 {
-					if pawnIsPassed(piece, blackpawns) {
-						score += PASSEDPAWN
-					}
+					terms.add(termKing, 1, params.checkKingSafety(piece.Position, 1, whitepawns, blackpawns))
 				} else {
-					if pawnIsPassed(piece, whitepawns) {
-						score -= PASSEDPAWN
-					}
-				}
-			case 'n':
-				if piece.Position.X >= 3 && piece.Position.X <= 6 && piece.Position.Y >= 3 && piece.Position.Y <= 6 {
-					score += float64(piece.Color) * CENTRALKNIGHT
+					terms.add(termKing, -1, params.checkKingSafety(piece.Position, -1, blackpawns, whitepawns))
 				}
-			case 'b':
-				var numattacking int
-				for _, dir := range piece.Directions {
-					numattacking += AttackRay(piece, b, dir)
-				}
-				score += float64(piece.Color*numattacking) * BISHOPSQUARES
+				terms.add(termKing, piece.Color, maps.kingAttack(params, b, piece.Position, piece.Color))
+				terms.add(termPassed, -piece.Color, maps.unstoppable(params, b, pawnentry.passed[colorSide(-piece.Color)], -piece.Color, piece.Position))
 			case 'r':
-				if (piece.Color == -1 && piece.Position.Y == 2) || (piece.Color == 1 && piece.Position.Y == 7) {
-					score += float64(piece.Color) * ROOKONSEVENTH
-				}
 				if piece.Color == 1 {
 					whiterooks = append(whiterooks, piece.Position)
 				} else {
@@ -176,36 +219,37 @@ func EvalBoard(b *engine.Board) float64 {
 			}
 		}
 	}
-	score += rookAnalysis(whiterooks)
-	score -= rookAnalysis(blackrooks)
+	terms.add(termRooks, 1, params.rookAnalysis(whiterooks))
+	terms.add(termRooks, -1, params.rookAnalysis(blackrooks))
+	maps.pieceActivity(params, b, 1, blackpawns, terms)
+	maps.pieceActivity(params, b, -1, whitepawns, terms)
 	for x := 0; x < 8; x++ {
 		for y := 0; y < 8; y++ {
 			if attackarray[x][y] > 0 {
 				if x >= 2 && x <= 5 && y >= 2 && y <= 5 {
-					score += IMPORTANTSQUARE
+					terms.add(termSquares, 1, params.ImportantSquare)
 				} else {
-					score += WEAKSQUARE
+					terms.add(termSquares, 1, params.WeakSquare)
 				}
 			} else if attackarray[x][y] < 0 {
 				if x >= 2 && x <= 5 && y >= 2 && y <= 5 {
-					score -= IMPORTANTSQUARE
+					terms.add(termSquares, -1, params.ImportantSquare)
 				} else {
-					score -= WEAKSQUARE
+					terms.add(termSquares, -1, params.WeakSquare)
 				}
 			}
 		}
 	}
-	return score
 }
 
-func rookAnalysis(rooks []engine.Square) float64 {
+func (params *Params) rookAnalysis(rooks []engine.Square) Score {
 	if len(rooks) != 2 {
-		return 0
+		return Score{}
 	}
 	if rooks[0].X == rooks[1].X || rooks[0].Y == rooks[1].Y {
-		return CONNECTEDROOKS
+		return params.ConnectedRooks
 	}
-	return 0
+	return Score{}
 }
 
 // Returns whether a given pawn has no opposing pawns blocking its path in any of its adjacent files
@@ -221,64 +265,40 @@ func pawnIsPassed(pawn *engine.Piece, oppfullpawns []engine.Square) bool {
 }
 
 // Used in pawnStructureAnalysis to update a score given a discovered to be broken pawn chain
-func updatePawnChainScore(pawnchain int) float64 {
-	var score float64
+func (params *Params) updatePawnChainScore(pawnchain int) Score {
+	var score Score
 	if pawnchain > 2 {
-		score += float64(pawnchain) * LONGPAWNCHAIN
+		score = score.plus(params.LongPawnChain.times(pawnchain))
 	} else if pawnchain != 0 {
-		score += ISOLATEDPAWN / float64(pawnchain)
+		score = score.plus(Score{params.IsolatedPawn.MG / pawnchain, params.IsolatedPawn.EG / pawnchain})
 	}
 	return score
 }
 
 // Returns appropriate penalties for doubled and isolated pawns
-func pawnStructureAnalysis(pawns []engine.Square, color int) float64 {
+func (params *Params) pawnStructureAnalysis(pawns []engine.Square, color int) Score {
 	pawnarray := [8]int{}
-	var score float64
-	for _, p := range pawns {
-		pawnarray[p.X-1] += 1
+	var score Score
+	for _, pawn := range pawns {
+		pawnarray[pawn.X-1] += 1
 		if color == 1 {
-			score += float64((p.Y - 2)) * ADVANCEDPAWN
+			score = score.plus(params.AdvancedPawn.times(pawn.Y - 2))
 		} else {
-			score += float64((7 - p.Y)) * ADVANCEDPAWN
+			score = score.plus(params.AdvancedPawn.times(7 - pawn.Y))
 		}
 	}
 	var pawnchain int
 	for _, count := range pawnarray {
 		if count >= 2 {
-			score += float64(count) * DOUBLEDPAWN
+			score = score.plus(params.DoubledPawn.times(count))
 			pawnchain += 1
 		} else if count == 1 {
 			pawnchain += 1
 		} else if count == 0 {
-			score += updatePawnChainScore(pawnchain)
+			score = score.plus(params.updatePawnChainScore(pawnchain))
 			pawnchain = 0
 		}
 	}
-	score += updatePawnChainScore(pawnchain)
-	return score
-}
-
-// Rewards players for protecting their king with pawns and being in a corner
-func checkKingSafety(file int, pawns []engine.Square) float64 {
-	pawnarray := [8]int{}
-	for _, p := range pawns {
-		pawnarray[p.X-1] += 1
-	}
-	var score float64
-	for i := -1; i < 2; i++ {
-		if location := file + i; location > -1 && location < 8 {
-			if pawnarray[location] == 0 {
-				score += KINGONOPENFILE
-			} else {
-				score += KINGPROTECTED
-			}
-		}
-	}
-	if file == 1 || file == 2 || file == 7 || file == 8 {
-		score += KINGINCORNER
-	} else {
-		score -= KINGINCORNER
-	}
+	score = score.plus(params.updatePawnChainScore(pawnchain))
 	return score
 }
@@ -9,8 +9,8 @@ import (
 func TestEval(t *testing.T) {
 	board := &engine.Board{Turn: 1}
 	board.SetUpPieces()
-	if eval := EvalBoard(board); eval >= .01 || eval <= -.01 { // the exact value is expected to be -0.000000... which isn't 0
-		t.Errorf("Initial position has evaluation of %f, expecting %f", eval, DRAW)
+	if eval := EvalBoard(board); eval != DRAW {
+		t.Errorf("Initial position has evaluation of %d, expecting %d", eval, DRAW)
 	}
 }
 
@@ -55,20 +55,20 @@ func TestAttackArray(t *testing.T) {
 
 func TestPawnStructureAnalysis(t *testing.T) {
 	pawnarray := []engine.Square{}
-	if score := pawnStructureAnalysis(pawnarray, 1); score != 0 {
-		t.Errorf("Empty pawn array expected to give score 0, gave score %f", score)
+	if score := defaultParams.pawnStructureAnalysis(pawnarray, 1); score != (Score{}) {
+		t.Errorf("Empty pawn array expected to give score 0, gave score %v", score)
 	}
 	for i := 1; i <= 8; i++ {
 		pawnarray = append(pawnarray, engine.Square{X: i, Y: 2})
 	}
-	if score := pawnStructureAnalysis(pawnarray, 1); score != float64(8)*LONGPAWNCHAIN {
-		t.Errorf("Straight pawn chain expected to give score .4, gave score %f", score)
+	if score := defaultParams.pawnStructureAnalysis(pawnarray, 1); score != LONGPAWNCHAIN.times(8) {
+		t.Errorf("Straight pawn chain expected to give score %v, gave score %v", LONGPAWNCHAIN.times(8), score)
 	}
 }
 
 func TestPawnIsPassed(t *testing.T) {
 	oppfullpawns := []engine.Square{}
-	oppfullpawns = append(oppfullpawns, engine.Square{2, 5})
+	oppfullpawns = append(oppfullpawns, engine.Square{X: 2, Y: 5})
 	pawn := &engine.Piece{
 		Position: engine.Square{
 			X: 1,
@@ -87,7 +87,31 @@ func TestPawnIsPassed(t *testing.T) {
 }
 
 func TestCheckKingSafety(t *testing.T) {
-	if score := checkKingSafety(1, []engine.Square{}); score > 0 {
-		t.Errorf("Isolated king in corner gives positive score of %f", score)
+	if score := defaultParams.checkKingSafety(engine.Square{X: 1, Y: 1}, 1, []engine.Square{}, []engine.Square{}); score.MG > 0 {
+		t.Errorf("Isolated king in corner gives positive score of %v", score)
+	}
+}
+
+func TestTaper(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	if phase := gamePhase(board); phase != MAXPHASE {
+		t.Errorf("Expected the starting position to have phase %d, got %d", MAXPHASE, phase)
+	}
+	score := Score{100, 200}
+	if taper(score, MAXPHASE) != 100 || taper(score, 0) != 200 || taper(score, MAXPHASE/2) != 150 {
+		t.Error("Expected the middlegame weight with every piece on the board, the endgame weight with none, and a blend between")
+	}
+	// without queens or pieces a centralized king is worth more than one in the corner
+	central, err := engine.FromFen("8/pp6/k7/8/4K3/8/PP6/8 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corner, err := engine.FromFen("8/pp6/k7/8/8/8/PP6/7K w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gamePhase(central) != 0 || gamePhase(corner) != 0 || EvalBoard(central) <= EvalBoard(corner) {
+		t.Errorf("Expected the active king to be better in the endgame, got %d on e4 and %d on h1", EvalBoard(central), EvalBoard(corner))
 	}
 }
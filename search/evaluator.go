@@ -0,0 +1,75 @@
+package search
+
+import "github.com/jacobroberts/chess/engine"
+
+// Scores positions for the search, so that different evaluation functions can be compared under the same search.
+// Evaluate returns the score in centipawns from white's point of view, like EvalBoard, and must be safe to call
+// from several search threads at once.
+type Evaluator interface {
+	Evaluate(b *engine.Board) int
+}
+
+// An Evaluator that keeps state for each board it evaluates, for example to update its terms incrementally as
+// moves are made, with b.AddListener.
+// Every search thread attaches the evaluator to its own board before searching and evaluates that board with the
+// returned Evaluator only, then calls detach once it is done.
+type IncrementalEvaluator interface {
+	Evaluator
+	Attach(b *engine.Board) (evaluator Evaluator, detach func())
+}
+
+// The built-in hand-crafted evaluation, used when no other evaluator is given.
+// Attached to a board, it keeps the piece-square bonuses up to date as moves are made and caches the pawn terms.
+// Evaluate scores a finished game as EvalBoard does, but the attached evaluator leaves checkmate and stalemate to
+// the search, like NNUE.
+type Classical struct {
+	Params *Params // the weights to evaluate with, DefaultParams if nil. Must not change while in use.
+}
+
+func (c Classical) Evaluate(b *engine.Board) int {
+	if over := b.IsOver(); over != 0 {
+		return gameOverScore(over)
+	}
+	params := c.params()
+	return evaluate(b, params, boardPST(b, params.PST), nil)
+}
+
+func (c Classical) Attach(b *engine.Board) (Evaluator, func()) {
+	return c.attach(b, newPawnTable())
+}
+
+// Attaches the evaluation to b, caching the pawn terms in pawns.
+func (c Classical) attach(b *engine.Board, pawns *pawnTable) (Evaluator, func()) {
+	params := c.params()
+	e := &classicalBoard{params: params, pst: trackPST(b, params.PST), pawns: pawns}
+	return e, func() { b.RemoveListener(e.pst) }
+}
+
+func (c Classical) params() *Params {
+	if c.Params == nil {
+		return defaultParams
+	}
+	return c.Params
+}
+
+// The state of the built-in evaluation for one board.
+type classicalBoard struct {
+	params *Params
+	pst    *pstTracker
+	pawns  *pawnTable
+}
+
+func (e *classicalBoard) Evaluate(b *engine.Board) int {
+	return evaluate(b, e.params, e.pst.score, e.pawns)
+}
+
+// Returns the evaluator a thread searching b uses, and the function to detach it.
+func attachEvaluator(evaluator Evaluator, b *engine.Board) (Evaluator, func()) {
+	if evaluator == nil {
+		evaluator = Classical{}
+	}
+	if incremental, ok := evaluator.(IncrementalEvaluator); ok {
+		return incremental.Attach(b)
+	}
+	return evaluator, func() {}
+}
@@ -0,0 +1,51 @@
+package search
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Scores material the wrong way round, so that the search tries to give it away.
+type generous struct{}
+
+func (generous) Evaluate(b *engine.Board) int {
+	return -EvalBoard(b)
+}
+
+// Counts how often it is attached to and detached from a board.
+type counting struct {
+	attached, detached int32
+}
+
+func (c *counting) Evaluate(b *engine.Board) int {
+	return EvalBoard(b)
+}
+
+func (c *counting) Attach(b *engine.Board) (Evaluator, func()) {
+	atomic.AddInt32(&c.attached, 1)
+	return c, func() { atomic.AddInt32(&c.detached, 1) }
+}
+
+func TestEvaluator(t *testing.T) {
+	board, err := engine.FromFen("4k3/8/8/8/3r4/8/8/3QK3 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := Search(context.Background(), board, Options{Depth: 1}); result.Move.End.X != 4 || result.Move.End.Y != 4 {
+		t.Errorf("Expected the queen to take the rook, got %s", result.Move.ToString())
+	}
+	if result := Search(context.Background(), board, Options{Depth: 1, Evaluator: generous{}}); result.Move.End.X == 4 && result.Move.End.Y == 4 {
+		t.Error("Expected the search to follow its evaluator and leave the rook alone")
+	}
+	c := &counting{}
+	Search(context.Background(), board, Options{Depth: 1, Threads: 2, Evaluator: c})
+	if c.attached != 2 || c.detached != 2 {
+		t.Errorf("Expected each of the two threads to attach and detach the evaluator, got %d and %d", c.attached, c.detached)
+	}
+	if eval := (Classical{}).Evaluate(board); eval != EvalBoard(board) {
+		t.Errorf("Expected the default evaluator to be EvalBoard, got %d", eval)
+	}
+}
@@ -0,0 +1,107 @@
+package search
+
+import "github.com/jacobroberts/chess/engine"
+
+const (
+	SINGULARDEPTH  = 4  // shallowest depth at which singular extensions are tried
+	SINGULARMARGIN = 50 // how much better than every other move a move must be to be singular
+)
+
+// Reference: https://www.chessprogramming.org/Extensions
+
+// Returns how many plies deeper than usual to search a move, 0 or 1.
+// Moves are extended when they give check or are singular (extend says which), when they are the only legal
+// move, when they recapture on the square of the last capture and when they push a pawn to the seventh rank.
+// Every path may only be extended as many times as the depth of the iteration, so that it is at most twice
+// as long as usual and the search cannot explode.
+func (t *thread) extension(ply int, move *engine.Move, moves int, extend bool) int {
+	extension := 0
+	if t.extensions[ply] < t.budget {
+		if extend || moves == 1 || isRecapture(t.path, move) || isPawnToSeventh(move) {
+			extension = 1
+		}
+	}
+	t.extensions[ply+1] = t.extensions[ply] + extension
+	return extension
+}
+
+// Returns whether a move is in movelist.
+func containsMove(movelist []*engine.Move, move *engine.Move) bool {
+	for _, m := range movelist {
+		if m == move {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether a move captures back on the square where the previous move captured.
+func isRecapture(path []*engine.Move, move *engine.Move) bool {
+	if move.Capture == 0 || len(path) == 0 {
+		return false
+	}
+	last := path[len(path)-1]
+	return last.Capture != 0 && last.End == move.End
+}
+
+// Returns whether a move pushes a pawn to the rank before promotion.
+func isPawnToSeventh(move *engine.Move) bool {
+	if move.Piece != 'p' {
+		return false
+	}
+	return (move.End.Y == 7 && move.Begin.Y < 7) || (move.End.Y == 2 && move.Begin.Y > 2)
+}
+
+// Checks if the move from the transposition table is singular: much better than every other move, so that the
+// position depends on it and it deserves a deeper look.
+// Every other move is searched to half the depth with a null window SINGULARMARGIN below the stored score, and
+// the move is singular if they all fail low.
+// Only tried when the stored score is at least (for black, at most) the true score and was searched nearly as
+// deep as the current node.
+// Reference: https://www.chessprogramming.org/Singular_Extensions
+func (t *thread) isSingular(depth, ply int, entry ttData, ttmove *engine.Move, movelist []*engine.Move) bool {
+	if depth < SINGULARDEPTH || entry.depth < depth-3 || len(movelist) < 2 || t.extensions[ply] >= t.budget {
+		return false
+	}
+	score := scoreFromTT(entry.score, ply)
+	if IsMate(score) {
+		return false
+	}
+	b := t.board
+	if b.Turn == 1 {
+		if entry.bound == UPPERBOUND {
+			return false
+		}
+		singularbeta := score - SINGULARMARGIN
+		for _, move := range movelist {
+			if move == ttmove {
+				continue
+			}
+			t.extensions[ply+1] = t.extensions[ply]
+			t.makeMove(move)
+			result := t.alphaBeta(depth/2-1, ply+1, singularbeta-1, singularbeta)
+			t.undoMove(move)
+			if result >= singularbeta || t.stopped() {
+				return false
+			}
+		}
+	} else {
+		if entry.bound == LOWERBOUND {
+			return false
+		}
+		singularalpha := score + SINGULARMARGIN
+		for _, move := range movelist {
+			if move == ttmove {
+				continue
+			}
+			t.extensions[ply+1] = t.extensions[ply]
+			t.makeMove(move)
+			result := t.alphaBeta(depth/2-1, ply+1, singularalpha, singularalpha+1)
+			t.undoMove(move)
+			if result <= singularalpha || t.stopped() {
+				return false
+			}
+		}
+	}
+	return true
+}
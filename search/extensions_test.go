@@ -0,0 +1,49 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestExtension(t *testing.T) {
+	board, err := engine.FromFen("4k3/8/8/3p4/8/3R4/1P6/4K3 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	th := newThread(context.Background(), board, nil, nil)
+	th.budget = 1
+	capture := &engine.Move{Piece: 'r', Begin: engine.Square{X: 4, Y: 3}, End: engine.Square{X: 4, Y: 5}, Capture: 'p'}
+	recapture := &engine.Move{Piece: 'k', Begin: engine.Square{X: 5, Y: 6}, End: engine.Square{X: 4, Y: 5}, Capture: 'r'}
+	push := &engine.Move{Piece: 'p', Begin: engine.Square{X: 2, Y: 6}, End: engine.Square{X: 2, Y: 7}}
+	quiet := &engine.Move{Piece: 'r', Begin: engine.Square{X: 4, Y: 3}, End: engine.Square{X: 4, Y: 4}}
+	if !isRecapture([]*engine.Move{capture}, recapture) || isRecapture([]*engine.Move{quiet}, recapture) {
+		t.Error("Expected a capture on the square of the last capture, and only that, to be a recapture")
+	}
+	if !isPawnToSeventh(push) || isPawnToSeventh(quiet) {
+		t.Error("Expected only the pawn push to the seventh rank to count")
+	}
+	if th.extension(0, quiet, 20, false) != 0 {
+		t.Error("Expected a quiet move not to be extended")
+	}
+	if th.extension(0, push, 20, false) != 1 || th.extensions[1] != 1 {
+		t.Error("Expected a pawn push to the seventh rank to be extended")
+	}
+	if th.extension(1, push, 20, true) != 0 {
+		t.Error("Expected no extension once the budget is used up")
+	}
+}
+
+func TestCheckExtension(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 8, 8)
+	board.PlacePiece('k', -1, 2, 1)
+	board.PlacePiece('r', 1, 3, 7)
+	board.PlacePiece('r', 1, 4, 8)
+	// a mate in 2 takes three plies, but the checks along the way are extended
+	result := Search(context.Background(), board, Options{Depth: 2})
+	if result.Mate != 2 {
+		t.Errorf("Expected check extensions to find mate in 2 at depth 2, got score %d", result.Score)
+	}
+}
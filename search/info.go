@@ -0,0 +1,41 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Progress of a search, reported through Options.Info for every line each time the main thread finishes a depth.
+// Score and Mate follow the conventions of Result.
+type Info struct {
+	Depth    int
+	SelDepth int // deepest ply reached, including the quiescence search
+	MultiPV  int // which of the lines asked for by Options.MultiPV this is, starting at 1
+	Score    int
+	Mate     int
+	Nodes    uint64 // positions searched by all threads
+	NPS      uint64 // nodes per second
+	Time     time.Duration
+	Hashfull int            // transposition table usage in permille
+	TBHits   uint64         // successful tablebase probes by all threads
+	PV       []*engine.Move // principal variation, the line the engine expects to be played
+}
+
+// Formats the info in the style of a UCI "info" line, with moves written as "pe2-e4".
+// The score is in centipawns from white's point of view.
+func (info Info) String() string {
+	score := fmt.Sprintf("cp %d", info.Score)
+	if info.Mate != 0 {
+		score = fmt.Sprintf("mate %d", info.Mate)
+	}
+	moves := make([]string, len(info.PV))
+	for i, m := range info.PV {
+		moves[i] = m.ToString()
+	}
+	return fmt.Sprintf("info depth %d seldepth %d multipv %d score %s nodes %d nps %d time %d hashfull %d tbhits %d pv %s",
+		info.Depth, info.SelDepth, info.MultiPV, score, info.Nodes, info.NPS, info.Time.Milliseconds(), info.Hashfull,
+		info.TBHits, strings.Join(moves, " "))
+}
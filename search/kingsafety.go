@@ -0,0 +1,123 @@
+package search
+
+import "github.com/jacobroberts/chess/engine"
+
+var (
+	KINGOPENFILE     = Score{-25, 0} // no pawns on a file next to or at the king
+	KINGHALFOPENFILE = Score{-15, 0} // only enemy pawns on a file next to or at the king
+
+	// Own pawns in front of the king, by how many ranks ahead the nearest is on each of the king's files;
+	// the first entry is for a file without one.
+	SHELTER = [4]Score{{-30, 0}, {20, 0}, {10, 0}, {0, 0}}
+	// Enemy pawns storming the king, by how many ranks ahead of it the nearest is on each of its files.
+	// A pawn one rank ahead is usually blocked, so it is less dangerous than one two ranks ahead.
+	STORM = [5]Score{{0, 0}, {-10, 0}, {-25, 0}, {-15, 0}, {-5, 0}}
+
+	// Attack units for each square of the king zone that a piece attacks.
+	ATTACKUNITS = map[byte]int{'n': 2, 'b': 2, 'r': 3, 'q': 5}
+	// Middlegame penalty by the number of attack units on the king zone. It grows slowly for a few units and
+	// steeply once several pieces join the attack.
+	// Reference: https://www.chessprogramming.org/King_Safety#Attack_Units
+	SAFETYTABLE = [100]int{
+		0, 0, 1, 2, 3, 5, 7, 9, 12, 15,
+		18, 22, 26, 30, 35, 39, 44, 50, 56, 62,
+		68, 75, 82, 85, 89, 97, 105, 113, 122, 131,
+		140, 150, 169, 180, 191, 202, 213, 225, 237, 248,
+		260, 272, 283, 295, 307, 319, 330, 342, 354, 366,
+		377, 389, 401, 412, 424, 436, 448, 459, 471, 483,
+		494, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+	}
+)
+
+// Returns whether a square is in the zone around a king of the given color: the squares next to it and the
+// three squares two ranks in front of it.
+func inKingZone(king engine.Square, color, x, y int) bool {
+	dx, dy := absInt(x-king.X), (y-king.Y)*color
+	return dx <= 1 && dy >= -1 && dy <= 2 && !(dx == 0 && dy == 0)
+}
+
+// Scores how safe a king is from the pieces of the other side, from the king's side's point of view.
+// Every enemy knight, bishop, rook and queen that attacks the king zone adds attack units for each zone square
+// it attacks, and once at least two pieces take part the units are looked up in the safety table.
+func (m *boardMaps) kingAttack(params *Params, b *engine.Board, king engine.Square, color int) Score {
+	var attackers, units int
+	for _, p := range b.Board {
+		if p.Captured || p.Color == color || params.AttackUnits[p.Name] == 0 {
+			continue
+		}
+		squares := 0
+		for _, dir := range p.Directions {
+			for n := 1; n < 8; n++ {
+				x, y := p.Position.X+dir[0]*n, p.Position.Y+dir[1]*n
+				if x < 1 || x > 8 || y < 1 || y > 8 {
+					break
+				}
+				if inKingZone(king, color, x, y) {
+					squares++
+				}
+				if m.occupied[x-1][y-1] != 0 || !p.Infinite_direction {
+					break
+				}
+			}
+		}
+		if squares > 0 {
+			attackers++
+			units += params.AttackUnits[p.Name] * squares
+		}
+	}
+	if attackers < 2 {
+		return Score{}
+	}
+	if units >= len(params.SafetyTable) {
+		units = len(params.SafetyTable) - 1
+	}
+	return Score{-params.SafetyTable[units], 0}
+}
+
+// Scores the pawns around a king of the given color, from the king's side's point of view: the shelter of
+// its own pawns in front of it, enemy pawns storming towards it and open files on which it can be attacked.
+func (params *Params) checkKingSafety(king engine.Square, color int, ownpawns, enemypawns []engine.Square) Score {
+	var score Score
+	for file := king.X - 1; file <= king.X+1; file++ {
+		if file < 1 || file > 8 {
+			continue
+		}
+		// nearest pawns in front of the king on this file, by ranks ahead, 0 if there are none
+		shelter, storm := 0, 0
+		ownonfile, enemyonfile := false, false
+		for _, p := range ownpawns {
+			if p.X == file {
+				ownonfile = true
+				if ahead := (p.Y - king.Y) * color; ahead > 0 && (shelter == 0 || ahead < shelter) {
+					shelter = ahead
+				}
+			}
+		}
+		for _, p := range enemypawns {
+			if p.X == file {
+				enemyonfile = true
+				if ahead := (p.Y - king.Y) * color; ahead > 0 && (storm == 0 || ahead < storm) {
+					storm = ahead
+				}
+			}
+		}
+		if shelter >= len(params.Shelter) {
+			shelter = len(params.Shelter) - 1
+		}
+		score = score.plus(params.Shelter[shelter])
+		if storm < len(params.Storm) {
+			score = score.plus(params.Storm[storm])
+		}
+		if !ownonfile {
+			if enemyonfile {
+				score = score.plus(params.KingHalfOpenFile)
+			} else {
+				score = score.plus(params.KingOpenFile)
+			}
+		}
+	}
+	return score
+}
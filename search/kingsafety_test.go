@@ -0,0 +1,76 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func squares(names ...string) []engine.Square {
+	result := make([]engine.Square, len(names))
+	for i, name := range names {
+		result[i] = engine.Square{X: int(name[0]-'a') + 1, Y: int(name[1] - '0')}
+	}
+	return result
+}
+
+func TestKingShelter(t *testing.T) {
+	g1 := engine.Square{X: 7, Y: 1}
+	sheltered := defaultParams.checkKingSafety(g1, 1, squares("f2", "g2", "h2"), nil)
+	if sheltered != SHELTER[1].times(3) {
+		t.Errorf("Expected three pawns right in front of the king to give %v, got %v", SHELTER[1].times(3), sheltered)
+	}
+	if bare := defaultParams.checkKingSafety(g1, 1, nil, nil); bare.MG >= sheltered.MG {
+		t.Errorf("Expected a king without pawns to be less safe, got %v against %v", bare, sheltered)
+	}
+	// files are 1-based: a king on the h-file looks at the g- and h-files only
+	if score := defaultParams.checkKingSafety(engine.Square{X: 8, Y: 1}, 1, squares("g2", "h2"), nil); score != SHELTER[1].times(2) {
+		t.Errorf("Expected a king on h1 behind g2 and h2 to be fully sheltered, got %v", score)
+	}
+	if score := defaultParams.checkKingSafety(engine.Square{X: 1, Y: 1}, 1, squares("a2", "b2"), nil); score != SHELTER[1].times(2) {
+		t.Errorf("Expected a king on a1 behind a2 and b2 to be fully sheltered, got %v", score)
+	}
+	advanced := defaultParams.checkKingSafety(g1, 1, squares("f2", "g3", "h2"), nil)
+	if advanced.MG >= sheltered.MG {
+		t.Error("Expected an advanced shelter pawn to protect less")
+	}
+	// the same for black
+	if score := defaultParams.checkKingSafety(engine.Square{X: 7, Y: 8}, -1, squares("f7", "g7", "h7"), nil); score != sheltered {
+		t.Errorf("Expected black's shelter to mirror white's, got %v", score)
+	}
+}
+
+func TestPawnStorm(t *testing.T) {
+	g1 := engine.Square{X: 7, Y: 1}
+	quiet := defaultParams.checkKingSafety(g1, 1, squares("f2", "g2", "h2"), squares("g7"))
+	storm := defaultParams.checkKingSafety(g1, 1, squares("f2", "g2", "h2"), squares("g4"))
+	if storm.MG >= quiet.MG {
+		t.Errorf("Expected a pawn storming the king to be dangerous, got %v against %v", storm, quiet)
+	}
+	open := defaultParams.checkKingSafety(g1, 1, squares("f2", "h2"), nil)
+	halfopen := defaultParams.checkKingSafety(g1, 1, squares("f2", "h2"), squares("g7"))
+	if open.MG >= halfopen.MG {
+		t.Errorf("Expected an open file at the king to be worse than a half-open one, got %v against %v", open, halfopen)
+	}
+}
+
+func TestKingAttack(t *testing.T) {
+	// the black queen alone bears down on the white king's zone, then a rook and a knight join in
+	board, maps, _ := mapsFromFen(t, "4k3/8/8/8/8/6q1/5PPP/5RK1 w")
+	single := maps.kingAttack(defaultParams, board, engine.Square{X: 7, Y: 1}, 1)
+	if single != (Score{}) {
+		t.Errorf("Expected a lone attacker not to count, got %v", single)
+	}
+	board, maps, _ = mapsFromFen(t, "4k3/8/8/8/7r/6q1/5PPP/5RK1 w")
+	double := maps.kingAttack(defaultParams, board, engine.Square{X: 7, Y: 1}, 1)
+	if double.MG >= 0 || double.EG != 0 {
+		t.Errorf("Expected two attackers to be a middlegame danger, got %v", double)
+	}
+	board, maps, _ = mapsFromFen(t, "4k3/8/8/8/7r/4n1q1/5PPP/5RK1 w")
+	if triple := maps.kingAttack(defaultParams, board, engine.Square{X: 7, Y: 1}, 1); triple.MG >= double.MG {
+		t.Errorf("Expected a third attacker to add more than the units it brings, got %v against %v", triple, double)
+	}
+	if !inKingZone(engine.Square{X: 7, Y: 1}, 1, 7, 3) || inKingZone(engine.Square{X: 7, Y: 1}, 1, 7, 1) || inKingZone(engine.Square{X: 7, Y: 8}, -1, 7, 5) {
+		t.Error("King zone is the squares around the king and two ranks in front")
+	}
+}
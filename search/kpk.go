@@ -0,0 +1,213 @@
+package search
+
+import (
+	"sync"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// A bitbase for king and pawn against king: one bit for every position, set when the side with the pawn wins.
+// It is made the first time it is needed by retrograde analysis, which takes a fraction of a second.
+// Positions are stored with the pawn on files a to d and the side with the pawn playing up the board as white;
+// the others are mirrored into these.
+// Reference: https://www.chessprogramming.org/KPK
+const kpkSize = 2 * 64 * 64 * 24 // side to move, white king, black king, pawn on files a-d and ranks 2-7
+
+// Results of positions while the bitbase is made.
+const (
+	kpkInvalid = iota
+	kpkUnknown
+	kpkDraw
+	kpkWin
+)
+
+var (
+	kpkOnce sync.Once
+	kpkBits []uint64
+)
+
+// Returns the index of a position, with squares numbered a1 = 0, b1 = 1, ..., h8 = 63.
+// stm is 0 with white, the side with the pawn, to move and 1 with black to move.
+func kpkIndex(stm, wk, bk, pawn int) int {
+	return stm + 2*(bk+64*(wk+64*(pawn%8+4*(pawn/8-1))))
+}
+
+func squareDistance(a, b int) int {
+	dx, dy := absInt(a%8-b%8), absInt(a/8-b/8)
+	if dx > dy {
+		return dx
+	}
+	return dy
+}
+
+// Returns whether a white pawn on pawn attacks s.
+func pawnAttacks(pawn, s int) bool {
+	return (s == pawn+7 && pawn%8 > 0) || (s == pawn+9 && pawn%8 < 7)
+}
+
+// Returns the squares a king on s can step to.
+func kingSteps(s int) []int {
+	steps := make([]int, 0, 8)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			x, y := s%8+dx, s/8+dy
+			if (dx != 0 || dy != 0) && x >= 0 && x < 8 && y >= 0 && y < 8 {
+				steps = append(steps, y*8+x)
+			}
+		}
+	}
+	return steps
+}
+
+// Returns the squares black's king can move to.
+func kpkBlackMoves(wk, bk, pawn int) []int {
+	moves := make([]int, 0, 8)
+	for _, s := range kingSteps(bk) {
+		if squareDistance(s, wk) > 1 && !pawnAttacks(pawn, s) && s != pawn {
+			moves = append(moves, s)
+		}
+	}
+	return moves
+}
+
+// Classifies a position before any moves are looked at: whether it cannot happen, and whether it is won or drawn
+// at once because the pawn promotes safely, black is mated or stalemated or black takes the pawn.
+func kpkClassify(stm, wk, bk, pawn int) int {
+	if wk == bk || wk == pawn || bk == pawn || squareDistance(wk, bk) <= 1 {
+		return kpkInvalid
+	}
+	if stm == 0 {
+		if pawnAttacks(pawn, bk) {
+			return kpkInvalid
+		}
+		promotion := pawn + 8
+		if pawn/8 == 6 && wk != promotion && bk != promotion && (squareDistance(bk, promotion) > 1 || squareDistance(wk, promotion) == 1) {
+			return kpkWin
+		}
+		return kpkUnknown
+	}
+	if len(kpkBlackMoves(wk, bk, pawn)) == 0 {
+		if pawnAttacks(pawn, bk) {
+			return kpkWin
+		}
+		return kpkDraw
+	}
+	if squareDistance(bk, pawn) == 1 && squareDistance(wk, pawn) > 1 {
+		return kpkDraw
+	}
+	return kpkUnknown
+}
+
+// Works out every position by retrograde analysis: a position with white to move is won if some move reaches a
+// won position and drawn if every move reaches a drawn one, and the other way round with black to move.
+// Positions still unknown once nothing changes are drawn, since white cannot force a win from them.
+func generateKPK() {
+	results := make([]uint8, kpkSize)
+	for pawn := 8; pawn < 56; pawn++ {
+		if pawn%8 > 3 {
+			continue
+		}
+		for wk := 0; wk < 64; wk++ {
+			for bk := 0; bk < 64; bk++ {
+				for stm := 0; stm < 2; stm++ {
+					results[kpkIndex(stm, wk, bk, pawn)] = uint8(kpkClassify(stm, wk, bk, pawn))
+				}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for pawn := 8; pawn < 56; pawn++ {
+			if pawn%8 > 3 {
+				continue
+			}
+			for wk := 0; wk < 64; wk++ {
+				for bk := 0; bk < 64; bk++ {
+					for stm := 0; stm < 2; stm++ {
+						i := kpkIndex(stm, wk, bk, pawn)
+						if results[i] != kpkUnknown {
+							continue
+						}
+						if result := kpkRetrograde(results, stm, wk, bk, pawn); result != kpkUnknown {
+							results[i] = uint8(result)
+							changed = true
+						}
+					}
+				}
+			}
+		}
+	}
+	kpkBits = make([]uint64, kpkSize/64)
+	for i, result := range results {
+		if result == kpkWin {
+			kpkBits[i/64] |= 1 << uint(i%64)
+		}
+	}
+}
+
+// Returns the result of a position from the results of the positions its moves reach, as far as they are known.
+func kpkRetrograde(results []uint8, stm, wk, bk, pawn int) int {
+	if stm == 1 {
+		allwon := true
+		for _, s := range kpkBlackMoves(wk, bk, pawn) {
+			switch results[kpkIndex(0, wk, s, pawn)] {
+			case kpkDraw:
+				return kpkDraw
+			case kpkUnknown:
+				allwon = false
+			}
+		}
+		if allwon {
+			return kpkWin
+		}
+		return kpkUnknown
+	}
+	children := make([]int, 0, 10)
+	for _, s := range kingSteps(wk) {
+		if squareDistance(s, bk) > 1 && s != pawn {
+			children = append(children, kpkIndex(1, s, bk, pawn))
+		}
+	}
+	// a pawn on the seventh rank only promotes when kpkClassify says it is safe to
+	if pawn/8 < 6 && wk != pawn+8 && bk != pawn+8 {
+		children = append(children, kpkIndex(1, wk, bk, pawn+8))
+		if pawn/8 == 1 && wk != pawn+16 && bk != pawn+16 {
+			children = append(children, kpkIndex(1, wk, bk, pawn+16))
+		}
+	}
+	alldrawn := true
+	for _, child := range children {
+		switch results[child] {
+		case kpkWin:
+			return kpkWin
+		case kpkUnknown:
+			alldrawn = false
+		}
+	}
+	if alldrawn {
+		return kpkDraw
+	}
+	return kpkUnknown
+}
+
+// Returns whether the side with the pawn wins, given the kings and the pawn, the color of the side with the pawn
+// and the side to move.
+func kpkWins(strongking, weakking, pawn engine.Square, strong, turn int) bool {
+	kpkOnce.Do(generateKPK)
+	index := func(s engine.Square) int {
+		x, y := s.X, s.Y
+		if strong == -1 {
+			y = 9 - y
+		}
+		if pawn.X > 4 {
+			x = 9 - x
+		}
+		return (y-1)*8 + x - 1
+	}
+	stm := 0
+	if turn != strong {
+		stm = 1
+	}
+	i := kpkIndex(stm, index(strongking), index(weakking), index(pawn))
+	return kpkBits[i/64]&(1<<uint(i%64)) != 0
+}
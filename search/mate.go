@@ -0,0 +1,71 @@
+package search
+
+const (
+	MAXPLY    = 64                // deepest ply the search can reach
+	MATEBOUND = WHITEWIN - MAXPLY // any score at least this far from zero is a forced mate
+)
+
+// Mate scores count down with the distance from the root, so that a mate in one is worth more than a mate in five.
+// A mate delivered at ply n scores WHITEWIN - n, or BLACKWIN + n when black mates.
+
+// Returns the score of a position with no legal moves, reached ply half-moves away from the root.
+// Stalemate scores as a draw with the thread's contempt.
+func (t *thread) terminalScore(ply int) int {
+	b := t.board
+	if b.IsCheck(b.Turn) {
+		if b.Turn == 1 {
+			return BLACKWIN + ply
+		}
+		return WHITEWIN - ply
+	}
+	return t.drawscore
+}
+
+// Converts the flat mate scores of EvalBoard to mate scores counted from the root.
+func mateAtPly(score int, ply int) int {
+	if score == WHITEWIN {
+		return WHITEWIN - ply
+	} else if score == BLACKWIN {
+		return BLACKWIN + ply
+	}
+	return score
+}
+
+// Returns whether a score is a forced mate for either side.
+func IsMate(score int) bool {
+	return score >= MATEBOUND || score <= -MATEBOUND
+}
+
+// Converts a score to the number of full moves until mate.
+// Positive when white mates, negative when black mates, and 0 when the score is not a mate.
+func MateIn(score int) int {
+	if score >= MATEBOUND {
+		return (int(WHITEWIN-score) + 1) / 2
+	} else if score <= -MATEBOUND {
+		return -(int(score-BLACKWIN) + 1) / 2
+	}
+	return 0
+}
+
+// Transposition table entries are shared by every path that reaches a position, so a mate score is stored
+// as the distance from the position itself rather than from the root, and converted back when it is read.
+
+// Converts a score found ply half-moves from the root into one relative to the current position.
+func scoreToTT(score int, ply int) int {
+	if score >= MATEBOUND {
+		return score + ply
+	} else if score <= -MATEBOUND {
+		return score - ply
+	}
+	return score
+}
+
+// Converts a stored score back into one relative to the root, for a position ply half-moves from it.
+func scoreFromTT(score int, ply int) int {
+	if score >= MATEBOUND {
+		return score - ply
+	} else if score <= -MATEBOUND {
+		return score + ply
+	}
+	return score
+}
@@ -0,0 +1,338 @@
+package search
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Monte Carlo tree search grows a tree of the positions after the root one playout at a time: from the root it
+// follows the most promising moves down to a position not yet in the tree, adds it, estimates how good it is and
+// backs the estimate up the path. Moves are chosen by PUCT, which weighs how well a move has done so far against a
+// prior guess at how good it is and how rarely it has been tried. The move played is the one tried most.
+// Reference: https://www.chessprogramming.org/Monte-Carlo_Tree_Search
+// Reference: https://www.chessprogramming.org/Christopher_D._Rosin#PUCT
+const (
+	MCTSCPUCT    = 1.5   // how much PUCT favors moves tried little over moves that have done well
+	MCTSPLAYOUTS = 10000 // playouts of a search given neither Nodes nor Clock
+
+	mctsInfoInterval = 1000 // playouts between reports of progress
+)
+
+// A Searcher using Monte Carlo tree search instead of alpha-beta, on a single thread.
+// Positions are estimated with Options.Evaluator, its score turned into an expected result as the tuner does.
+// The tree is kept between searches: when a search starts from a position the last one reached within two
+// half-moves, as it does in a game, the playouts that went through that position are kept.
+// Of the Options, Depth, Threads, Table and Ponderhit are not used; Nodes limits the number of playouts.
+// Only mates in one are reported as mates. An MCTS must not be used by two searches at once.
+type MCTS struct {
+	CPUCT   float64    // MCTSCPUCT if 0
+	Policy  bool       // guesses which moves are best by the move ordering of the alpha-beta search, instead of trying all alike
+	Rollout int        // random half-moves played from a new position before it is evaluated, 0 to evaluate it at once
+	Rand    *rand.Rand // chooses the rollout moves, seeded with 1 if nil
+
+	root *mctsNode // the tree of the last search
+}
+
+// A position in the tree.
+type mctsNode struct {
+	move     *engine.Move // the move played to reach the position, nil at the root
+	hash     uint64       // of the position, set when the node is expanded
+	prior    float64      // the policy's guess at how likely move is to be the best, the priors of a node's children adding up to 1
+	visits   int
+	total    float64     // sum of the results of the playouts through the node, for the side that played move
+	children []*mctsNode // nil until the node is expanded, empty if the game is over
+	mated    bool        // the side to move is checkmated
+}
+
+// Returns the average result of the playouts through the node, for the side that played its move.
+func (n *mctsNode) value() float64 {
+	return n.total / float64(n.visits)
+}
+
+// Returns the child tried most, or nil if there is none.
+func (n *mctsNode) best() *mctsNode {
+	var best *mctsNode
+	for _, child := range n.children {
+		if child.visits > 0 && (best == nil || child.visits > best.visits) {
+			best = child
+		}
+	}
+	return best
+}
+
+// Searches a position with playouts until Nodes, the Clock or MCTSPLAYOUTS says to stop or ctx is cancelled,
+// and reports the move tried most. Info is called every thousand playouts and at the end.
+func (m *MCTS) Search(ctx context.Context, b *engine.Board, opts Options) Result {
+	if b.IsOver() != 0 {
+		return Result{}
+	}
+	if m.Rand == nil {
+		m.Rand = rand.New(rand.NewSource(1))
+	}
+	t := newThread(ctx, b.Copy(), nil, opts.Evaluator)
+	defer t.close()
+	t.drawscore = drawScore(opts.Contempt, b.Turn)
+	t.setHistory(opts.History, opts.HalfmoveClock)
+	t.tablebase = opts.Tablebase
+
+	maxplayouts := opts.Nodes
+	multipv := opts.MultiPV
+	var timer *TimeManager
+	if opts.Clock != nil {
+		timer = NewTimeManager(*opts.Clock, b)
+	} else if maxplayouts == 0 {
+		maxplayouts = MCTSPLAYOUTS
+	}
+	if opts.Strength.weakens() {
+		if nodes := opts.Strength.nodes(); maxplayouts == 0 || nodes < maxplayouts {
+			maxplayouts = nodes
+		}
+		if multipv < 4 {
+			multipv = 4
+		}
+	}
+	if multipv < 1 {
+		multipv = 1
+	}
+	t.limit = func() bool {
+		return (maxplayouts != 0 && atomic.LoadUint64(&t.nodes) >= maxplayouts) || (timer != nil && timer.timeUp())
+	}
+
+	root := m.reuse(b)
+	start := time.Now()
+	var result Result
+	report := func() {
+		result.Lines = m.lines(root, multipv, b.Turn)
+		best := result.Lines[0]
+		result.Move, result.Score, result.Mate, result.PV = best.Move, best.Score, best.Mate, best.PV
+		result.Depth, result.Nodes, result.TBHits = len(best.PV), atomic.LoadUint64(&t.nodes), atomic.LoadUint64(&t.tbhits)
+		if opts.Info == nil {
+			return
+		}
+		elapsed := time.Since(start)
+		for i, line := range result.Lines {
+			info := Info{
+				Depth:    len(line.PV),
+				SelDepth: t.seldepth,
+				MultiPV:  i + 1,
+				Score:    line.Score,
+				Mate:     line.Mate,
+				Nodes:    result.Nodes,
+				Time:     elapsed,
+				TBHits:   result.TBHits,
+				PV:       line.PV,
+			}
+			if elapsed > 0 {
+				info.NPS = uint64(float64(info.Nodes) / elapsed.Seconds())
+			}
+			opts.Info(info)
+		}
+	}
+	for playouts := 1; ; playouts++ {
+		m.playout(t, root, 0)
+		if t.stopped() && root.best() != nil {
+			break
+		}
+		if playouts%mctsInfoInterval == 0 && opts.Info != nil {
+			report()
+		}
+	}
+	report()
+	if opts.Strength.weakens() {
+		line := opts.Strength.pick(result.Lines, b.Turn)
+		result.Move, result.Score, result.Mate, result.PV = line.Move, line.Score, line.Mate, line.PV
+	}
+	return result
+}
+
+// Returns the node of the last search's tree for b's position, if that search reached it within two half-moves of
+// its root, or a new tree otherwise.
+func (m *MCTS) reuse(b *engine.Board) *mctsNode {
+	hash := b.Hash()
+	if m.root != nil {
+		nodes := []*mctsNode{m.root}
+		for depth := 0; depth <= 2; depth++ {
+			var next []*mctsNode
+			for _, node := range nodes {
+				if node.children != nil && node.hash == hash {
+					node.move = nil
+					m.root = node
+					return node
+				}
+				next = append(next, node.children...)
+			}
+			nodes = next
+		}
+	}
+	m.root = &mctsNode{}
+	return m.root
+}
+
+// Plays out one path from node, the position on the thread's board ply half-moves from the root, and adds its
+// result to the statistics of the nodes on the way. Returns the result for the side to move, from 0 for a loss
+// to 1 for a win.
+func (m *MCTS) playout(t *thread, node *mctsNode, ply int) float64 {
+	var v float64
+	switch {
+	case ply > 0 && t.isDraw():
+		t.poll(ply)
+		v = t.mctsValue(t.drawscore)
+	case node.children == nil:
+		t.poll(ply)
+		v = m.expand(t, node)
+	case len(node.children) == 0:
+		t.poll(ply)
+		v = node.terminalValue(t)
+	default:
+		child := m.choose(node)
+		t.makeMove(child.move)
+		v = 1 - m.playout(t, child, ply+1)
+		t.undoMove(child.move)
+	}
+	node.visits++
+	node.total += 1 - v
+	return v
+}
+
+// Adds the children of node, the position on the thread's board, to the tree and returns the estimated result of
+// the position for the side to move.
+func (m *MCTS) expand(t *thread, node *mctsNode) float64 {
+	b := t.board
+	node.hash = b.Hash()
+	var movelist []*engine.Move
+	if m.Policy {
+		movelist, _ = t.orderedMoves()
+	} else {
+		movelist = b.AllLegalMoves()
+	}
+	node.children = make([]*mctsNode, len(movelist))
+	var sum float64
+	for i, move := range movelist {
+		// the earlier the move ordering puts a move, the likelier it is to be the best
+		prior := 1.0
+		if m.Policy {
+			prior = 1 / float64(i+1)
+		}
+		node.children[i] = &mctsNode{move: move, prior: prior}
+		sum += prior
+	}
+	for _, child := range node.children {
+		child.prior /= sum
+	}
+	if len(movelist) == 0 {
+		node.mated = b.IsCheck(b.Turn)
+		return node.terminalValue(t)
+	}
+	if t.canProbe() {
+		if wdl, ok := t.probeWDL(); ok {
+			return t.mctsValue(t.tablebaseScore(wdl))
+		}
+	}
+	return m.rollout(t)
+}
+
+// Returns the result of a position with no legal moves for the side to move, on the thread's board.
+func (n *mctsNode) terminalValue(t *thread) float64 {
+	if n.mated {
+		return 0
+	}
+	return t.mctsValue(t.drawscore)
+}
+
+// Estimates the result of the thread's board for the side to move, by evaluating the position reached after
+// m.Rollout random half-moves, or the end of the game if it comes first.
+func (m *MCTS) rollout(t *thread) float64 {
+	played := make([]*engine.Move, 0, m.Rollout)
+	var score int
+	for {
+		if t.isDraw() {
+			score = t.drawscore
+			break
+		}
+		movelist := t.board.AllLegalMoves()
+		if len(movelist) == 0 {
+			score = t.terminalScore(len(played))
+			break
+		}
+		if len(played) == m.Rollout {
+			score = t.evaluate()
+			break
+		}
+		move := movelist[m.Rand.Intn(len(movelist))]
+		t.makeMove(move)
+		played = append(played, move)
+	}
+	for i := len(played) - 1; i >= 0; i-- {
+		t.undoMove(played[i])
+	}
+	return t.mctsValue(score)
+}
+
+// Chooses the child of node to play out next by PUCT. Children not tried yet are taken to be as good as node.
+func (m *MCTS) choose(node *mctsNode) *mctsNode {
+	cpuct := m.CPUCT
+	if cpuct == 0 {
+		cpuct = MCTSCPUCT
+	}
+	explore := cpuct * math.Sqrt(float64(node.visits))
+	untried := 1 - node.value()
+	var best *mctsNode
+	bestscore := math.Inf(-1)
+	for _, child := range node.children {
+		q := untried
+		if child.visits > 0 {
+			q = child.value()
+		}
+		if score := q + explore*child.prior/float64(1+child.visits); score > bestscore {
+			best, bestscore = child, score
+		}
+	}
+	return best
+}
+
+// Converts a white-relative score to the expected result for the side to move on the thread's board.
+func (t *thread) mctsValue(score int) float64 {
+	return sigmoid(score*t.board.Turn, 1)
+}
+
+// Converts the average result of a root move for the side to move, turn, to a white-relative score.
+func mctsScore(value float64, turn int) int {
+	value = math.Max(0.001, math.Min(0.999, value))
+	return int(math.Round(400*math.Log10(value/(1-value)))) * turn
+}
+
+// Returns up to n lines for the root moves tried most, most first.
+func (m *MCTS) lines(root *mctsNode, n, turn int) []Line {
+	children := make([]*mctsNode, 0, len(root.children))
+	for _, child := range root.children {
+		if child.visits > 0 {
+			children = append(children, child)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool { return children[i].visits > children[j].visits })
+	if len(children) > n {
+		children = children[:n]
+	}
+	lines := make([]Line, len(children))
+	for i, child := range children {
+		line := Line{Move: child.move, Score: mctsScore(child.value(), turn)}
+		if child.mated {
+			line.Score = WHITEWIN - 1
+			if turn == -1 {
+				line.Score = BLACKWIN + 1
+			}
+			line.Mate = MateIn(line.Score)
+		}
+		for node := child; node != nil; node = node.best() {
+			line.PV = append(line.PV, node.move)
+		}
+		lines[i] = line
+	}
+	return lines
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+var _ Searcher = AlphaBetaSearcher{}
+var _ Searcher = &MCTS{}
+
+func TestMCTSSearch(t *testing.T) {
+	tests := []struct {
+		fen, move string
+		mate      int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w", "ra1-a8", 1},
+		{"r5k1/5ppp/8/8/8/8/5PPP/6K1 b", "ra8-a1", -1},
+		{"4k3/8/8/3q4/8/8/8/3RK3 w", "rd1-d5", 0}, // a queen left hanging
+	}
+	for _, test := range tests {
+		for _, m := range []*MCTS{{}, {Policy: true}, {Rollout: 2}} {
+			board, _ := engine.FromFen(test.fen)
+			result := m.Search(context.Background(), board, Options{Nodes: 2000})
+			if result.Move.ToString() != test.move || result.Mate != test.mate {
+				t.Errorf("Expected %s with mate %d in %s, got %s with mate %d (policy %v, rollout %d)",
+					test.move, test.mate, test.fen, result.Move.ToString(), result.Mate, m.Policy, m.Rollout)
+			}
+			if result.Nodes < 2000 || result.Nodes > 2000+POLLINTERVAL {
+				t.Errorf("Expected about 2000 playouts, got %d", result.Nodes)
+			}
+		}
+	}
+}
+
+func TestMCTSPriors(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	for _, policy := range []bool{false, true} {
+		m := &MCTS{Policy: policy}
+		m.Search(context.Background(), board, Options{Nodes: 100})
+		var sum float64
+		for _, child := range m.root.children {
+			sum += child.prior
+		}
+		if len(m.root.children) != 20 || math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Expected 20 priors adding up to 1, got %d adding up to %f", len(m.root.children), sum)
+		}
+		if first, last := m.root.children[0].prior, m.root.children[19].prior; policy != (first > last) {
+			t.Errorf("Expected priors from the move ordering only with a policy, got %f and %f", first, last)
+		}
+	}
+}
+
+func TestMCTSReuse(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	m := &MCTS{}
+	var infos []Info
+	result := m.Search(context.Background(), board, Options{Nodes: 3000, MultiPV: 2, Info: func(info Info) {
+		infos = append(infos, info)
+	}})
+	if len(infos) != 8 || len(result.Lines) != 2 || infos[len(infos)-1].Nodes != result.Nodes {
+		t.Errorf("Expected two lines reported four times, got %d reports and %d lines", len(infos), len(result.Lines))
+	}
+	// the reply the search expected, which it has played out the most
+	reply := m.root.best().best()
+	board.ForceMove(result.Move)
+	board.ForceMove(reply.move)
+	kept := reply.visits
+	m.Search(context.Background(), board, Options{Nodes: 100})
+	if m.root != reply || m.root.visits < kept+100 {
+		t.Errorf("Expected the tree to be kept after the expected reply, with %d visits more than %d", 100, kept)
+	}
+	board, _ = engine.FromFen("4k3/8/8/3q4/8/8/8/3RK3 w")
+	m.Search(context.Background(), board, Options{Nodes: 100})
+	if m.root == reply {
+		t.Error("Expected a new tree for an unrelated position")
+	}
+}
+
+func TestMCTSCancel(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := (&MCTS{}).Search(ctx, board, Options{})
+	if result.Move == nil || result.Nodes > POLLINTERVAL+1 {
+		t.Errorf("Expected a move soon after cancelling, got %v after %d playouts", result.Move, result.Nodes)
+	}
+}
@@ -25,20 +25,26 @@ func (s ByScore) Less(i, j int) bool {
 // Roughly orders moves in order of most likely to be good to least.
 // Examines all checks first, followed by captures, followed by good moves.
 // "Good moves" are sorted by their board evaluation after they are played.
-// If quiescence is set to true, then only checks and captures are returned.
-func orderedMoves(b *engine.Board, quiescence bool) []*engine.Move {
+// Also returns the number of checks, which are the moves at the front.
+func (t *thread) orderedMoves() ([]*engine.Move, int) {
+	return t.orderMoves(t.board.AllLegalMoves())
+}
+
+// Orders moves already generated for the thread's board as orderedMoves does.
+func (t *thread) orderMoves(moves []*engine.Move) ([]*engine.Move, int) {
+	b := t.board
 	checks := make([]*engine.Move, 0)
 	captures := make([]*engine.Move, 0)
 	rest := make([]*engine.Move, 0)
 	// parentscore := EvalBoard(b)
-	for _, move := range b.AllLegalMoves() {
+	for _, move := range moves {
 		b.ForceMove(move)
 		if b.IsCheck(b.Turn) {
 			checks = append(checks, move)
 		} else if move.Capture != 0 {
 			captures = append(captures, move)
-		} else if !quiescence {
-			childscore := EvalBoard(b) * float64(b.Turn*-1)
+		} else {
+			childscore := t.evaluate() * (b.Turn * -1)
 			// if (b.Turn == -1 && childscore > parentscore) || (b.Turn == 1 && childscore < parentscore) {
 			move.Score = childscore
 			rest = append(rest, move)
@@ -46,9 +52,7 @@ func orderedMoves(b *engine.Board, quiescence bool) []*engine.Move {
 		}
 		b.UndoMove(move)
 	}
-	if !quiescence {
-		sort.Sort(sort.Reverse(ByScore(rest)))
-	}
+	sort.Sort(sort.Reverse(ByScore(rest)))
 	orderedmoves := make([]*engine.Move, len(checks)+len(captures)+len(rest))
 	index := 0
 	for _, l := range [][]*engine.Move{checks, captures, rest} {
@@ -58,5 +62,5 @@ func orderedMoves(b *engine.Board, quiescence bool) []*engine.Move {
 			index++
 		}
 	}
-	return orderedmoves
+	return orderedmoves, len(checks)
 }
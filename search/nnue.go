@@ -0,0 +1,364 @@
+package search
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// An efficiently updatable neural network: every piece on a square is an input, and the inputs feed a single
+// hidden layer whose sums, the accumulator, are kept up to date as moves are made instead of being added up again
+// for every position. There is an accumulator for each side, seeing the board from that side's point of view,
+// so that the network scores positions for the side to move whichever side that is.
+// Reference: https://www.chessprogramming.org/NNUE
+const (
+	NNUEINPUTS = 768 // 2 colors × 6 pieces × 64 squares
+	NNUEQA     = 255 // scale of the feature weights and biases; hidden values are clipped to 0..NNUEQA
+	NNUEQB     = 64  // scale of the output weights
+	NNUESCALE  = 400 // centipawns for an output of 1.0
+
+	nnueMagic     = "CNUE"
+	nnueVersion   = 1
+	nnueReadChunk = 1 << 16 // weights read at a time
+)
+
+var nnuePieces = map[byte]int{'p': 0, 'n': 1, 'b': 2, 'r': 3, 'q': 4, 'k': 5}
+
+// The weights of a network, quantized to integers.
+//
+// The file format is little endian throughout:
+//
+//	magic            4 bytes, "CNUE"
+//	version          uint32, 1
+//	hidden           uint32, the size of the hidden layer, H
+//	feature weights  int16 × 768 × H, the H weights of input 0, then those of input 1, and so on
+//	feature biases   int16 × H
+//	output weights   int16 × 2H, first for the side to move's hidden layer, then for the other side's
+//	output bias      int32
+//
+// The hidden layer is kept in 16 bits, so a network whose hidden units could add up to more than that in some
+// position is rejected.
+//
+// Input (side*6 + piece)*64 + square is a piece on a square, seen from one side's point of view: side is 0 for
+// that side's own pieces and 1 for the enemy's, piece counts pawn, knight, bishop, rook, queen, king from 0, and
+// square is a1 = 0, b1 = 1, ..., h8 = 63, with the board flipped top to bottom for black.
+//
+// A trainer working in floating point should multiply the feature weights and biases by NNUEQA, the output
+// weights by NNUEQB and the output bias by NNUEQA×NNUEQB, then round. The output of the network is then
+//
+//	(sum of clip(hidden, 0, NNUEQA) × output weight + output bias) × NNUESCALE / (NNUEQA × NNUEQB)
+//
+// in centipawns for the side to move.
+type Network struct {
+	Hidden         int
+	FeatureWeights []int16 // NNUEINPUTS × Hidden
+	FeatureBiases  []int16 // Hidden
+	OutputWeights  []int16 // 2 × Hidden
+	OutputBias     int32
+}
+
+// Makes a network of the given size with every weight 0.
+func NewNetwork(hidden int) *Network {
+	return &Network{
+		Hidden:         hidden,
+		FeatureWeights: make([]int16, NNUEINPUTS*hidden),
+		FeatureBiases:  make([]int16, hidden),
+		OutputWeights:  make([]int16, 2*hidden),
+	}
+}
+
+// Reads a network from a file in the format described at Network.
+func LoadNetwork(filename string) (*Network, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	n, err := ReadNetwork(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("func LoadNetwork: %s: %s", filename, err)
+	}
+	return n, nil
+}
+
+// Reads a network in the format described at Network.
+func ReadNetwork(r io.Reader) (*Network, error) {
+	var header struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Magic[:]) != nnueMagic {
+		return nil, errors.New("not a network file")
+	}
+	if header.Version != nnueVersion {
+		return nil, fmt.Errorf("unsupported version %d", header.Version)
+	}
+	if header.Hidden == 0 || header.Hidden > 1<<16 {
+		return nil, fmt.Errorf("bad hidden layer size %d", header.Hidden)
+	}
+	// the weights are read a bounded chunk at a time, so that a header promising more than the file holds cannot
+	// make it allocate the whole network up front
+	hidden := int(header.Hidden)
+	n := &Network{Hidden: hidden}
+	for _, weights := range []struct {
+		values *[]int16
+		count  int
+	}{{&n.FeatureWeights, NNUEINPUTS * hidden}, {&n.FeatureBiases, hidden}, {&n.OutputWeights, 2 * hidden}} {
+		values, err := readInt16s(r, weights.count)
+		if err != nil {
+			return nil, err
+		}
+		*weights.values = values
+	}
+	if err := binary.Read(r, binary.LittleEndian, &n.OutputBias); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != io.EOF {
+		return nil, errors.New("trailing data")
+	}
+	if unit := n.overflows(); unit >= 0 {
+		return nil, fmt.Errorf("hidden unit %d can overflow 16 bits", unit)
+	}
+	return n, nil
+}
+
+// Reads count little endian int16 values, nnueReadChunk at a time.
+func readInt16s(r io.Reader, count int) ([]int16, error) {
+	size := count
+	if size > nnueReadChunk {
+		size = nnueReadChunk
+	}
+	values := make([]int16, 0, size)
+	buf := make([]byte, 2*size)
+	for len(values) < count {
+		k := count - len(values)
+		if k > nnueReadChunk {
+			k = nnueReadChunk
+		}
+		if _, err := io.ReadFull(r, buf[:2*k]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		for i := 0; i < k; i++ {
+			values = append(values, int16(binary.LittleEndian.Uint16(buf[2*i:])))
+		}
+	}
+	return values, nil
+}
+
+// Returns a hidden unit whose sum can leave the range of an int16 with 32 pieces on the board, or -1 if there is
+// none. Every unit is checked against its bias plus its 32 largest and its 32 smallest feature weights, more than
+// any position can reach.
+func (n *Network) overflows() int {
+	weights := make([]int, NNUEINPUTS)
+	for unit := 0; unit < n.Hidden; unit++ {
+		for input := range weights {
+			weights[input] = int(n.FeatureWeights[input*n.Hidden+unit])
+		}
+		sort.Ints(weights)
+		low, high := int(n.FeatureBiases[unit]), int(n.FeatureBiases[unit])
+		for i := 0; i < 32; i++ {
+			low += weights[i]
+			high += weights[NNUEINPUTS-1-i]
+		}
+		if low < math.MinInt16 || high > math.MaxInt16 {
+			return unit
+		}
+	}
+	return -1
+}
+
+// Writes the network to a file in the format described at Network.
+func (n *Network) Save(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := n.Write(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Writes the network in the format described at Network.
+func (n *Network) Write(w io.Writer) error {
+	if len(n.FeatureWeights) != NNUEINPUTS*n.Hidden || len(n.FeatureBiases) != n.Hidden || len(n.OutputWeights) != 2*n.Hidden {
+		return errors.New("func Write: weights do not match the hidden layer size")
+	}
+	if _, err := io.WriteString(w, nnueMagic); err != nil {
+		return err
+	}
+	for _, data := range []interface{}{uint32(nnueVersion), uint32(n.Hidden), n.FeatureWeights, n.FeatureBiases, n.OutputWeights, n.OutputBias} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the input for a piece, seen from the point of view of the given side.
+func nnueInput(name byte, color int, s engine.Square, perspective int) int {
+	side, y := 0, s.Y
+	if color != perspective {
+		side = 1
+	}
+	if perspective == -1 {
+		y = 9 - y
+	}
+	return (side*6+nnuePieces[name])*64 + (y-1)*8 + s.X - 1
+}
+
+// The hidden layer of a network for one board, from white's and black's points of view.
+// Attached to a board, it only notes the inputs that moves add and remove, and brings the hidden layer up to date
+// when the board is next evaluated. A move taken back before then cancels out without touching the hidden layer,
+// as do the moves the search makes and takes back only to look at, such as those of the static exchange evaluation.
+type accumulator struct {
+	network *Network
+	values  [2][]int16
+	pending []nnueChange
+}
+
+// An input that has been added or removed since the hidden layer was last brought up to date.
+type nnueChange struct {
+	inputs [2]int // from white's and black's points of view
+	added  bool
+}
+
+func newAccumulator(n *Network, b *engine.Board) *accumulator {
+	acc := &accumulator{network: n}
+	for side := range acc.values {
+		acc.values[side] = append([]int16{}, n.FeatureBiases...)
+	}
+	for _, p := range b.Board {
+		if !p.Captured {
+			acc.Added(p.Name, p.Color, p.Position)
+		}
+	}
+	acc.update()
+	return acc
+}
+
+func (acc *accumulator) Added(name byte, color int, s engine.Square) {
+	acc.change(name, color, s, true)
+}
+
+func (acc *accumulator) Removed(name byte, color int, s engine.Square) {
+	acc.change(name, color, s, false)
+}
+
+// Notes an input added or removed, cancelling out the opposite change if one is pending.
+func (acc *accumulator) change(name byte, color int, s engine.Square, added bool) {
+	c := nnueChange{inputs: [2]int{nnueInput(name, color, s, 1), nnueInput(name, color, s, -1)}, added: added}
+	for i := len(acc.pending) - 1; i >= 0; i-- {
+		if p := acc.pending[i]; p.inputs == c.inputs && p.added != added {
+			acc.pending = append(acc.pending[:i], acc.pending[i+1:]...)
+			return
+		}
+	}
+	acc.pending = append(acc.pending, c)
+}
+
+// Brings the hidden layer up to date with the pending changes.
+func (acc *accumulator) update() {
+	hidden := acc.network.Hidden
+	for _, c := range acc.pending {
+		for side, input := range c.inputs {
+			weights := acc.network.FeatureWeights[input*hidden : (input+1)*hidden]
+			values := acc.values[side]
+			if c.added {
+				for i, w := range weights {
+					values[i] += w
+				}
+			} else {
+				for i, w := range weights {
+					values[i] -= w
+				}
+			}
+		}
+	}
+	acc.pending = acc.pending[:0]
+}
+
+// Runs the output layer for the side to move and returns the white-relative score.
+func (acc *accumulator) output(turn int) int {
+	acc.update()
+	n := acc.network
+	us, them := acc.values[0], acc.values[1]
+	if turn == -1 {
+		us, them = them, us
+	}
+	sum := int64(n.OutputBias)
+	for i := 0; i < n.Hidden; i++ {
+		sum += int64(clipNNUE(us[i])) * int64(n.OutputWeights[i])
+		sum += int64(clipNNUE(them[i])) * int64(n.OutputWeights[n.Hidden+i])
+	}
+	score := int(sum * NNUESCALE / (NNUEQA * NNUEQB))
+	// leave the scores beyond these to mates found by the search
+	if score > WHITEWIN/2 {
+		score = WHITEWIN / 2
+	} else if score < BLACKWIN/2 {
+		score = BLACKWIN / 2
+	}
+	return score * turn
+}
+
+func clipNNUE(v int16) int32 {
+	if v < 0 {
+		return 0
+	}
+	if v > NNUEQA {
+		return NNUEQA
+	}
+	return int32(v)
+}
+
+// Evaluates positions with a network. Attached to a board, it updates the accumulator as moves are made.
+// Evaluate scores a finished game as EvalBoard does, but the attached evaluator leaves checkmate and stalemate to
+// the search, which finds them when it generates the moves anyway.
+type NNUE struct {
+	Network *Network // must not change while in use
+}
+
+func (e NNUE) Evaluate(b *engine.Board) int {
+	if over := b.IsOver(); over != 0 {
+		return gameOverScore(over)
+	}
+	return newAccumulator(e.Network, b).output(b.Turn)
+}
+
+func (e NNUE) Attach(b *engine.Board) (Evaluator, func()) {
+	acc := newAccumulator(e.Network, b)
+	b.AddListener(acc)
+	return nnueBoard{acc}, func() { b.RemoveListener(acc) }
+}
+
+// The state of a network for one board.
+type nnueBoard struct {
+	acc *accumulator
+}
+
+func (e nnueBoard) Evaluate(b *engine.Board) int {
+	return e.acc.output(b.Turn)
+}
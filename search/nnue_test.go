@@ -0,0 +1,144 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Makes a small network with random weights.
+func randomNetwork(hidden int, seed int64) *Network {
+	r := rand.New(rand.NewSource(seed))
+	n := NewNetwork(hidden)
+	for i := range n.FeatureWeights {
+		n.FeatureWeights[i] = int16(r.Intn(41) - 20)
+	}
+	for i := range n.FeatureBiases {
+		n.FeatureBiases[i] = int16(r.Intn(101))
+	}
+	for i := range n.OutputWeights {
+		n.OutputWeights[i] = int16(r.Intn(129) - 64)
+	}
+	n.OutputBias = int32(r.Intn(2001) - 1000)
+	return n
+}
+
+func TestReadNetwork(t *testing.T) {
+	n := randomNetwork(8, 1)
+	var buf bytes.Buffer
+	if err := n.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if size := 4 + 4 + 4 + 2*NNUEINPUTS*8 + 2*8 + 2*2*8 + 4; len(data) != size {
+		t.Errorf("Expected a file of %d bytes, got %d", size, len(data))
+	}
+	read, err := ReadNetwork(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, n) {
+		t.Error("Expected to read back the network written")
+	}
+	if read, err := ReadNetwork(iotest.OneByteReader(bytes.NewReader(data))); err != nil || !reflect.DeepEqual(read, n) {
+		t.Errorf("Expected a reader returning a byte at a time to give the same network, got %v", err)
+	}
+	huge := append([]byte{}, data[:12]...)
+	binary.LittleEndian.PutUint32(huge[8:], 1<<16)
+	if _, err := ReadNetwork(bytes.NewReader(append(huge, data[12:]...))); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected a header promising more weights than the file holds to be truncated, got %v", err)
+	}
+	if _, err := ReadNetwork(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("Expected an error for a truncated file")
+	}
+	if _, err := ReadNetwork(bytes.NewReader(append(append([]byte{}, data...), 0))); err == nil {
+		t.Error("Expected an error for trailing data")
+	}
+	if _, err := ReadNetwork(bytes.NewReader(append([]byte("NNUE"), data[4:]...))); err == nil {
+		t.Error("Expected an error for a file with the wrong magic")
+	}
+	n.FeatureWeights[5*8+3] = math.MaxInt16 // a single piece takes unit 3 past 16 bits
+	buf.Reset()
+	n.Write(&buf)
+	if _, err := ReadNetwork(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("Expected an error for a network that can overflow")
+	}
+}
+
+func TestNNUEIncremental(t *testing.T) {
+	e := NNUE{Network: randomNetwork(16, 2)}
+	// castling, captures, promotions and captures that promote
+	board, err := engine.FromFen("r3k2r/1P6/8/3p4/4P3/8/8/R3K2R w KQkq -")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attached, detach := e.Attach(board)
+	defer detach()
+	for _, move := range board.AllLegalMoves() {
+		board.ForceMove(move)
+		if got, want := attached.Evaluate(board), e.Evaluate(board); got != want {
+			t.Errorf("After %s expected %d, got %d", move.ToString(), want, got)
+		}
+		for _, reply := range board.AllLegalMoves() {
+			pending := len(attached.(nnueBoard).acc.pending)
+			board.ForceMove(reply)
+			board.UndoMove(reply)
+			if after := len(attached.(nnueBoard).acc.pending); after != pending {
+				t.Errorf("Expected taking back %s %s to cancel out, got %d changes pending instead of %d", move.ToString(), reply.ToString(), after, pending)
+			}
+			board.ForceMove(reply)
+			if got, want := attached.Evaluate(board), e.Evaluate(board); got != want {
+				t.Errorf("After %s %s expected %d, got %d", move.ToString(), reply.ToString(), want, got)
+			}
+			board.UndoMove(reply)
+		}
+		board.UndoMove(move)
+		if got, want := attached.Evaluate(board), e.Evaluate(board); got != want {
+			t.Errorf("After taking back %s expected %d, got %d", move.ToString(), want, got)
+		}
+	}
+}
+
+func TestNNUESymmetry(t *testing.T) {
+	e := NNUE{Network: randomNetwork(16, 3)}
+	board, _ := engine.FromFen("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w")
+	mirrored, _ := engine.FromFen("rnbqkb1r/pppp1ppp/5n2/4p3/4P3/2N5/PPPP1PPP/R1BQKBNR b")
+	if eval := e.Evaluate(board); eval == 0 || e.Evaluate(mirrored) != -eval {
+		t.Errorf("Expected a position with colors swapped to score the opposite, got %d and %d", eval, e.Evaluate(mirrored))
+	}
+	mated, _ := engine.FromFen("k7/1Q6/1K6/8/8/8/8/8 b")
+	if eval := e.Evaluate(mated); eval != WHITEWIN {
+		t.Errorf("Expected checkmate to be scored as a win, got %d", eval)
+	}
+	board, _ = engine.FromFen("4k3/8/8/8/3r4/8/8/3QK3 w")
+	if result := Search(context.Background(), board, Options{Depth: 2, Threads: 2, Evaluator: e}); result.Move == nil {
+		t.Error("Expected a search with the network to find a move")
+	}
+}
+
+func TestNNUEQuiescence(t *testing.T) {
+	e := NNUE{Network: randomNetwork(16, 4)}
+	tests := []struct {
+		fen         string
+		qply, score int
+	}{
+		{"n5k1/5ppp/8/8/8/8/8/R5K1 w", 0, WHITEWIN - 1}, // Rxa8#
+		{"8/8/8/6Q1/8/8/5K1p/7k b", 1, DRAW},            // stalemate after a capture
+	}
+	for _, test := range tests {
+		board, _ := engine.FromFen(test.fen)
+		th := newThread(context.Background(), board, nil, e)
+		if score := th.quiescence(BLACKWIN, WHITEWIN, test.qply, test.qply); score != test.score {
+			t.Errorf("Expected quiescence with the network attached to score %s %d, got %d", test.fen, test.score, score)
+		}
+		th.close()
+	}
+}
@@ -0,0 +1,488 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAXWEIGHT = 2000 // largest weight a parameter file may set, in centipawns, so that scores stay clear of mates
+)
+
+// The weights of the built-in evaluation, see Classical.
+// The defaults are the variables of the same names in capitals, such as ISOLATEDPAWN for IsolatedPawn.
+type Params struct {
+	Material        map[byte]Score
+	HungPiece       Score
+	AdvancedPawn    Score
+	LongPawnChain   Score
+	IsolatedPawn    Score
+	DoubledPawn     Score
+	BackwardPawn    Score
+	PassedRank      [8]Score
+	CandidatePasser [8]Score
+	ConnectedPasser Score
+	SupportedPasser Score
+	Unstoppable     Score
+	ConnectedRooks  Score
+	ImportantSquare Score
+	WeakSquare      Score
+
+	Mobility         map[byte]Score
+	MobilityBase     map[byte]int
+	Outpost          map[byte]Score
+	BishopPair       Score
+	RookOpenFile     Score
+	RookHalfOpenFile Score
+	TrappedPiece     Score
+
+	KingOpenFile     Score
+	KingHalfOpenFile Score
+	Shelter          [4]Score
+	Storm            [5]Score
+	AttackUnits      map[byte]int
+	SafetyTable      [100]int
+
+	PST map[byte]Table
+}
+
+// the weights EvalBoard uses
+var defaultParams = DefaultParams()
+
+// Returns a copy of the default weights.
+func DefaultParams() *Params {
+	params := &Params{
+		Material:        MATERIAL,
+		HungPiece:       HUNGPIECE,
+		AdvancedPawn:    ADVANCEDPAWN,
+		LongPawnChain:   LONGPAWNCHAIN,
+		IsolatedPawn:    ISOLATEDPAWN,
+		DoubledPawn:     DOUBLEDPAWN,
+		BackwardPawn:    BACKWARDPAWN,
+		PassedRank:      PASSEDRANK,
+		CandidatePasser: CANDIDATEPASSER,
+		ConnectedPasser: CONNECTEDPASSER,
+		SupportedPasser: SUPPORTEDPASSER,
+		Unstoppable:     UNSTOPPABLE,
+		ConnectedRooks:  CONNECTEDROOKS,
+		ImportantSquare: IMPORTANTSQUARE,
+		WeakSquare:      WEAKSQUARE,
+
+		Mobility:         MOBILITY,
+		MobilityBase:     MOBILITYBASE,
+		Outpost:          OUTPOST,
+		BishopPair:       BISHOPPAIR,
+		RookOpenFile:     ROOKOPENFILE,
+		RookHalfOpenFile: ROOKHALFOPENFILE,
+		TrappedPiece:     TRAPPEDPIECE,
+
+		KingOpenFile:     KINGOPENFILE,
+		KingHalfOpenFile: KINGHALFOPENFILE,
+		Shelter:          SHELTER,
+		Storm:            STORM,
+		AttackUnits:      ATTACKUNITS,
+		SafetyTable:      SAFETYTABLE,
+
+		PST: PST,
+	}
+	return params.Clone()
+}
+
+// Returns a copy of the weights that can be changed without changing these.
+func (params *Params) Clone() *Params {
+	clone := *params
+	clone.Material = copyScores(params.Material)
+	clone.Mobility = copyScores(params.Mobility)
+	clone.Outpost = copyScores(params.Outpost)
+	clone.MobilityBase = copyInts(params.MobilityBase)
+	clone.AttackUnits = copyInts(params.AttackUnits)
+	clone.PST = make(map[byte]Table, len(params.PST))
+	for k, v := range params.PST {
+		clone.PST[k] = v
+	}
+	return &clone
+}
+
+func copyScores(m map[byte]Score) map[byte]Score {
+	result := make(map[byte]Score, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+func copyInts(m map[byte]int) map[byte]int {
+	result := make(map[byte]int, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// A single weight, named after the default variable it is part of: "ISOLATEDPAWN.mg", "PASSEDRANK.4.eg",
+// "MATERIAL.n.mg", "SAFETYTABLE.12" or "PST.k.eg.63". Parameter files set weights by these names.
+type param struct {
+	name string
+	get  func() int
+	set  func(int)
+}
+
+// Returns every weight, in a fixed order.
+func (params *Params) weights() []param {
+	var weights []param
+	addInt := func(name string, v *int) {
+		weights = append(weights, param{name, func() int { return *v }, func(n int) { *v = n }})
+	}
+	addScore := func(name string, s *Score) {
+		addInt(name+".mg", &s.MG)
+		addInt(name+".eg", &s.EG)
+	}
+	addScoreMap := func(name string, m map[byte]Score) {
+		for _, piece := range []byte("pnbrqk") {
+			if _, ok := m[piece]; !ok {
+				continue
+			}
+			piece := piece
+			prefix := fmt.Sprintf("%s.%c", name, piece)
+			weights = append(weights,
+				param{prefix + ".mg", func() int { return m[piece].MG }, func(n int) { s := m[piece]; s.MG = n; m[piece] = s }},
+				param{prefix + ".eg", func() int { return m[piece].EG }, func(n int) { s := m[piece]; s.EG = n; m[piece] = s }})
+		}
+	}
+	addIntMap := func(name string, m map[byte]int) {
+		for _, piece := range []byte("pnbrqk") {
+			if _, ok := m[piece]; !ok {
+				continue
+			}
+			piece := piece
+			weights = append(weights, param{fmt.Sprintf("%s.%c", name, piece), func() int { return m[piece] }, func(n int) { m[piece] = n }})
+		}
+	}
+
+	addScoreMap("MATERIAL", params.Material)
+	addScore("HUNGPIECE", &params.HungPiece)
+	addScore("ADVANCEDPAWN", &params.AdvancedPawn)
+	addScore("LONGPAWNCHAIN", &params.LongPawnChain)
+	addScore("ISOLATEDPAWN", &params.IsolatedPawn)
+	addScore("DOUBLEDPAWN", &params.DoubledPawn)
+	addScore("BACKWARDPAWN", &params.BackwardPawn)
+	for i := range params.PassedRank {
+		addScore(fmt.Sprintf("PASSEDRANK.%d", i), &params.PassedRank[i])
+	}
+	for i := range params.CandidatePasser {
+		addScore(fmt.Sprintf("CANDIDATEPASSER.%d", i), &params.CandidatePasser[i])
+	}
+	addScore("CONNECTEDPASSER", &params.ConnectedPasser)
+	addScore("SUPPORTEDPASSER", &params.SupportedPasser)
+	addScore("UNSTOPPABLE", &params.Unstoppable)
+	addScore("CONNECTEDROOKS", &params.ConnectedRooks)
+	addScore("IMPORTANTSQUARE", &params.ImportantSquare)
+	addScore("WEAKSQUARE", &params.WeakSquare)
+	addScoreMap("MOBILITY", params.Mobility)
+	addIntMap("MOBILITYBASE", params.MobilityBase)
+	addScoreMap("OUTPOST", params.Outpost)
+	addScore("BISHOPPAIR", &params.BishopPair)
+	addScore("ROOKOPENFILE", &params.RookOpenFile)
+	addScore("ROOKHALFOPENFILE", &params.RookHalfOpenFile)
+	addScore("TRAPPEDPIECE", &params.TrappedPiece)
+	addScore("KINGOPENFILE", &params.KingOpenFile)
+	addScore("KINGHALFOPENFILE", &params.KingHalfOpenFile)
+	for i := range params.Shelter {
+		addScore(fmt.Sprintf("SHELTER.%d", i), &params.Shelter[i])
+	}
+	for i := range params.Storm {
+		addScore(fmt.Sprintf("STORM.%d", i), &params.Storm[i])
+	}
+	addIntMap("ATTACKUNITS", params.AttackUnits)
+	for i := range params.SafetyTable {
+		addInt(fmt.Sprintf("SAFETYTABLE.%d", i), &params.SafetyTable[i])
+	}
+	for _, piece := range []byte("pnbrqk") {
+		if _, ok := params.PST[piece]; !ok {
+			continue
+		}
+		piece := piece
+		for i := 0; i < 64; i++ {
+			i := i
+			weights = append(weights,
+				param{fmt.Sprintf("PST.%c.mg.%d", piece, i), func() int { return params.PST[piece].MG[i] }, func(n int) { t := params.PST[piece]; t.MG[i] = n; params.PST[piece] = t }},
+				param{fmt.Sprintf("PST.%c.eg.%d", piece, i), func() int { return params.PST[piece].EG[i] }, func(n int) { t := params.PST[piece]; t.EG[i] = n; params.PST[piece] = t }})
+		}
+	}
+	return weights
+}
+
+// Returns the weights whose names start with one of the prefixes, or every weight if there are none.
+func (params *Params) selectWeights(prefixes []string) []param {
+	weights := params.weights()
+	if len(prefixes) == 0 {
+		return weights
+	}
+	selected := make([]param, 0)
+	for _, w := range weights {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(w.name, prefix) {
+				selected = append(selected, w)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// Checks that the weights make sense: none is larger than MAXWEIGHT either way, every piece is worth something and
+// has a piece-square table, mobility and attack units are not negative and the safety table never falls.
+func (params *Params) Validate() error {
+	for _, w := range params.weights() {
+		if v := w.get(); v > MAXWEIGHT || v < -MAXWEIGHT {
+			return fmt.Errorf("func Validate: %s is %d, more than %d either way", w.name, v, MAXWEIGHT)
+		}
+	}
+	for _, piece := range []byte("pnbrq") {
+		if s := params.Material[piece]; s.MG <= 0 || s.EG <= 0 {
+			return fmt.Errorf("func Validate: material of %c must be positive, got %v", piece, s)
+		}
+	}
+	for _, piece := range []byte("pnbrqk") {
+		if _, ok := params.PST[piece]; !ok {
+			return fmt.Errorf("func Validate: no piece-square table for %c", piece)
+		}
+	}
+	for piece, v := range params.MobilityBase {
+		if v < 0 {
+			return fmt.Errorf("func Validate: MOBILITYBASE.%c is negative", piece)
+		}
+	}
+	for piece, v := range params.AttackUnits {
+		if v < 0 {
+			return fmt.Errorf("func Validate: ATTACKUNITS.%c is negative", piece)
+		}
+	}
+	for i, v := range params.SafetyTable {
+		if v < 0 || (i > 0 && v < params.SafetyTable[i-1]) {
+			return fmt.Errorf("func Validate: SAFETYTABLE.%d is %d, the table must not be negative or fall", i, v)
+		}
+	}
+	return nil
+}
+
+// Reads weights from a file, starting from the defaults, and validates them.
+// Files ending in .toml are read as TOML and the rest as JSON. Either way each weight is set by its name, see
+// param, and the parts of a name may be nested: {"ISOLATEDPAWN": {"mg": -30}} in JSON or
+//
+//	[ISOLATEDPAWN]
+//	mg = -30
+//
+// in TOML set the same weight as "ISOLATEDPAWN.mg": -30. Arrays number their elements from 0, so that
+// "SHELTER": [{"mg": -30}] in JSON and SHELTER = [{mg = -30}] in TOML set "SHELTER.0.mg".
+// Weights left out of the file keep their default values.
+func LoadParams(filename string) (*Params, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]int
+	if strings.HasSuffix(filename, ".toml") {
+		values, err = parseTOML(data)
+	} else {
+		values, err = parseJSONParams(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	params := DefaultParams()
+	weights := make(map[string]param)
+	for _, w := range params.weights() {
+		weights[w.name] = w
+	}
+	for name, value := range values {
+		w, ok := weights[name]
+		if !ok {
+			return nil, errors.New("func LoadParams: unknown weight " + name)
+		}
+		w.set(value)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// Reads a JSON object of weights, flattening nested objects and arrays into dotted names. The object is read token
+// by token, so that a weight set twice, whether by the same key or once flat and once nested, is rejected as it is
+// in TOML.
+func parseJSONParams(data []byte) (map[string]int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	values := make(map[string]int)
+	var read func(name string) error
+	read = func(name string) error {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if name == "" && token != json.Delim('{') {
+			return errors.New("func LoadParams: expected a JSON object")
+		}
+		if delim, ok := token.(json.Delim); ok && (delim == '{' || delim == '[') {
+			for i := 0; decoder.More(); i++ {
+				key := strconv.Itoa(i)
+				if delim == '{' {
+					if token, err = decoder.Token(); err != nil {
+						return err
+					}
+					key = token.(string)
+				}
+				if err := read(name + "." + key); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+			return err
+		}
+		v, ok := token.(json.Number)
+		if !ok {
+			return errors.New("func LoadParams: " + name[1:] + " is not a number")
+		}
+		n, err := strconv.Atoi(v.String())
+		if err != nil {
+			return errors.New("func LoadParams: " + name[1:] + " is not a whole number")
+		}
+		if _, ok := values[name[1:]]; ok {
+			return errors.New("func LoadParams: " + name[1:] + " is set twice")
+		}
+		values[name[1:]] = n
+		return nil
+	}
+	if err := read(""); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Reads the part of TOML that a file of weights needs: comments, tables and keys, dotted or not, set to integers,
+// arrays or inline tables of them. An array may go on over several lines.
+func parseTOML(data []byte) (map[string]int, error) {
+	values := make(map[string]int)
+	var table string
+	lines := strings.Split(string(data), "\n")
+	uncomment := func(line string) string {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		return strings.TrimSpace(line)
+	}
+	for n := 0; n < len(lines); n++ {
+		line := uncomment(lines[n])
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			table = tomlKey(line[1:len(line)-1]) + "."
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("func LoadParams: line %d: expected key = value", n+1)
+		}
+		name := table + tomlKey(line[:i])
+		value, start := line[i+1:], n
+		for n+1 < len(lines) && strings.Count(value, "[")+strings.Count(value, "{") > strings.Count(value, "]")+strings.Count(value, "}") {
+			n++
+			value += "\n" + uncomment(lines[n])
+		}
+		rest, err := parseTOMLValue(value, name, values)
+		if err == nil && strings.TrimSpace(rest) != "" {
+			err = fmt.Errorf("unexpected %q after %s", strings.TrimSpace(rest), name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("func LoadParams: line %d: %s", start+1, err)
+		}
+	}
+	return values, nil
+}
+
+// Reads the TOML value at the start of s into values under name, naming the elements of an array by their index
+// and those of an inline table by their key, and returns the rest of s.
+func parseTOMLValue(s, name string, values map[string]int) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		array, end := s[0] == '[', "}"
+		if array {
+			end = "]"
+		}
+		s = strings.TrimSpace(s[1:])
+		for i := 0; !strings.HasPrefix(s, end); i++ {
+			key := strconv.Itoa(i)
+			if !array {
+				j := strings.IndexByte(s, '=')
+				if j < 0 {
+					return "", fmt.Errorf("%s: expected key = value", name)
+				}
+				key, s = tomlKey(s[:j]), s[j+1:]
+			}
+			rest, err := parseTOMLValue(s, name+"."+key, values)
+			if err != nil {
+				return "", err
+			}
+			s = strings.TrimSpace(rest)
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimSpace(s[1:])
+			} else if !strings.HasPrefix(s, end) {
+				return "", fmt.Errorf("%s: expected , or %s", name, end)
+			}
+		}
+		return s[1:], nil
+	}
+	j := strings.IndexAny(s, ",]}")
+	if j < 0 {
+		j = len(s)
+	}
+	value, err := strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(s[:j]), "_", ""))
+	if err != nil {
+		return "", fmt.Errorf("%s is not a whole number", name)
+	}
+	if _, ok := values[name]; ok {
+		return "", fmt.Errorf("%s is set twice", name)
+	}
+	values[name] = value
+	return s[j:], nil
+}
+
+// Returns a TOML key with spaces around its parts and quotes taken off.
+func tomlKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Writes the weights to a file that LoadParams can read, as TOML if the name ends in .toml and JSON otherwise,
+// with one line for each weight.
+func (params *Params) Save(filename string) error {
+	var data []byte
+	if strings.HasSuffix(filename, ".toml") {
+		var buf bytes.Buffer
+		for _, w := range params.weights() {
+			fmt.Fprintf(&buf, "%s = %d\n", w.name, w.get())
+		}
+		data = buf.Bytes()
+	} else {
+		values := make(map[string]int)
+		for _, w := range params.weights() {
+			values[w.name] = w.get()
+		}
+		encoded, err := json.MarshalIndent(values, "", "\t")
+		if err != nil {
+			return err
+		}
+		data = append(encoded, '\n')
+	}
+	return os.WriteFile(filename, data, 0644)
+}
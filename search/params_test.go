@@ -0,0 +1,138 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Returns the weights as a map from name to value, for comparing them.
+func weightValues(params *Params) map[string]int {
+	values := make(map[string]int)
+	for _, w := range params.weights() {
+		values[w.name] = w.get()
+	}
+	return values
+}
+
+func TestDefaultParams(t *testing.T) {
+	params := DefaultParams()
+	params.Material['n'] = Score{1, 2}
+	params.SafetyTable[10] = 0
+	if MATERIAL['n'] == params.Material['n'] || DefaultParams().Material['n'] == params.Material['n'] || SAFETYTABLE[10] == 0 {
+		t.Error("Expected the default weights to be copied")
+	}
+	if len(weightValues(params)) != len(params.weights()) {
+		t.Error("Expected every weight to have a name of its own")
+	}
+	if err := DefaultParams().Validate(); err != nil {
+		t.Errorf("Expected the default weights to be valid, got %s", err)
+	}
+	board, err := engine.FromFen("4k3/4p3/8/8/8/8/8/3QK3 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.Material['q'] = Score{1500, 1500}
+	if eval := (Classical{Params: params}).Evaluate(board); eval <= EvalBoard(board)+400 {
+		t.Errorf("Expected a queen worth 1500 to raise the evaluation, got %d against %d", eval, EvalBoard(board))
+	}
+}
+
+func TestLoadParams(t *testing.T) {
+	dir := t.TempDir()
+	params := DefaultParams()
+	params.IsolatedPawn = Score{-17, -23}
+	params.Outpost['b'] = Score{11, 12}
+	for _, filename := range []string{"params.json", "params.toml"} {
+		filename = filepath.Join(dir, filename)
+		if err := params.Save(filename); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadParams(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := weightValues(loaded)
+		for name, value := range weightValues(params) {
+			if values[name] != value {
+				t.Errorf("Expected %s to be read back from %s as %d, got %d", name, filename, value, values[name])
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		filename, data string
+		check          func(*Params) bool
+	}{
+		{"nested.json", `{"ISOLATEDPAWN": {"mg": -12}, "PASSEDRANK": [{"mg": 0}, {"mg": 7, "eg": 9}]}`, func(p *Params) bool {
+			return p.IsolatedPawn == Score{-12, ISOLATEDPAWN.EG} && p.PassedRank[1] == Score{7, 9}
+		}},
+		{"tables.toml", "\"ATTACKUNITS\".q = 6\n# knights\n[MATERIAL.n]\nmg = 333 # less than a bishop\n\n[MOBILITY]\nq.eg = 3\n", func(p *Params) bool {
+			return p.Material['n'] == Score{333, MATERIAL['n'].EG} && p.Mobility['q'].EG == 3 && p.AttackUnits['q'] == 6
+		}},
+		{"arrays.toml", "SAFETYTABLE = [\n\t0, 1, 1, # a comment\n\t2,\n]\nSHELTER = [{mg = -20}, {mg = 15, eg = 5}]\n[STORM]\n4 = { mg = -6 }\n", func(p *Params) bool {
+			return p.SafetyTable[2] == 1 && p.SafetyTable[3] == 2 && p.SafetyTable[4] == SAFETYTABLE[4] &&
+				p.Shelter[0] == Score{-20, SHELTER[0].EG} && p.Shelter[1] == Score{15, 5} && p.Storm[4].MG == -6
+		}},
+	} {
+		filename := filepath.Join(dir, test.filename)
+		if err := os.WriteFile(filename, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if loaded, err := LoadParams(filename); err != nil {
+			t.Errorf("Loading %s gave error %s", test.filename, err)
+		} else if !test.check(loaded) {
+			t.Errorf("Weights read wrong from %s", test.filename)
+		}
+	}
+
+	for _, data := range []string{
+		`{"KNIGHTONRIM.mg": -10}`,
+		`{"SAFETYTABLE.20": 0}`,
+		`{"MATERIAL.p.eg": -100}`,
+		`{"BISHOPPAIR.mg": 5000}`,
+		`{"BISHOPPAIR.mg": 12.5}`,
+		`{"ISOLATEDPAWN": "bad"}`,
+	} {
+		filename := filepath.Join(dir, "bad.json")
+		if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadParams(filename); err == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+	for _, data := range []string{
+		"SHELTER = [{mg = -20}, {mg = 15}\n",
+		"SHELTER = [{mg = -20} {mg = 15}]",
+		"SAFETYTABLE = [0, 1, x]",
+		"SAFETYTABLE = [0, 1] 2",
+		"SAFETYTABLE.1 = 1\nSAFETYTABLE = [0, 1]",
+	} {
+		filename := filepath.Join(dir, "bad.toml")
+		if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadParams(filename); err == nil {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+	// a weight set once flat and once nested, in either format
+	for _, test := range []struct{ filename, data string }{
+		{"twice.json", `{"ISOLATEDPAWN.mg": -10, "ISOLATEDPAWN": {"mg": -12}}`},
+		{"twice.toml", "ISOLATEDPAWN.mg = -10\n[ISOLATEDPAWN]\nmg = -12\n"},
+		{"same.json", `{"BISHOPPAIR": {"mg": 10, "mg": 20}}`},
+		{"same.toml", "[BISHOPPAIR]\nmg = 10\nmg = 20\n"},
+	} {
+		filename := filepath.Join(dir, test.filename)
+		if err := os.WriteFile(filename, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadParams(filename); err == nil || !strings.Contains(err.Error(), "set twice") {
+			t.Errorf("Expected %s to be rejected for setting a weight twice, got %v", test.filename, err)
+		}
+	}
+}
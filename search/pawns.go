@@ -0,0 +1,187 @@
+package search
+
+import "github.com/jacobroberts/chess/engine"
+
+const (
+	PAWNHASHSIZE = 1 << 12 // entries in each thread's pawn hash table
+)
+
+var (
+	// Passed pawns by rank, counted from the side's own back rank.
+	PASSEDRANK = [8]Score{{0, 0}, {5, 10}, {10, 15}, {15, 25}, {30, 50}, {50, 90}, {80, 140}, {0, 0}}
+	// Pawns that have no enemy pawn in front of them on their own file and enough friendly pawns next to them
+	// to force their way through, by rank.
+	CANDIDATEPASSER = [8]Score{{0, 0}, {2, 5}, {5, 8}, {8, 12}, {15, 25}, {25, 45}, {0, 0}, {0, 0}}
+	CONNECTEDPASSER = Score{5, 10} // per rank, passed pawn with another passed pawn next to it
+	SUPPORTEDPASSER = Score{3, 8}  // per rank, passed pawn defended by a pawn
+	BACKWARDPAWN    = Score{-10, -15}
+	UNSTOPPABLE     = Score{0, 500} // passed pawn the enemy king cannot catch, with no enemy pieces left to stop it
+)
+
+// Pawn structure changes far less often than the rest of the position, so the pawn terms are cached in a
+// table keyed by the Zobrist hash of the pawns alone.
+// Each search thread has a table of its own, so no locking is needed.
+// Reference: https://www.chessprogramming.org/Pawn_Hash_Table
+type pawnTable struct {
+	entries []pawnEntry
+	mask    uint64
+}
+
+// What the evaluation knows about a pawn structure.
+// An empty entry matches the structure without pawns, whose key is 0, and is correct for it.
+type pawnEntry struct {
+	key         uint64
+	structure   [2]Score  // white's and black's pawn structure, each from its own point of view
+	passedscore [2]Score  // the same for passed pawns and candidates
+	passed      [2]uint64 // white's and black's passed pawns, with bit (x-1)*8+y-1 set for a pawn on square (x, y)
+}
+
+func newPawnTable() *pawnTable {
+	return &pawnTable{entries: make([]pawnEntry, PAWNHASHSIZE), mask: PAWNHASHSIZE - 1}
+}
+
+// Returns the entry for the board's pawns, evaluating them if they are not in the table.
+// A nil table evaluates the pawns every time.
+// A table must always be probed with the same weights.
+func (pt *pawnTable) probe(b *engine.Board, params *Params, whitepawns, blackpawns []engine.Square) pawnEntry {
+	key := b.PawnHash()
+	if pt == nil {
+		return params.evaluatePawns(key, whitepawns, blackpawns)
+	}
+	entry := &pt.entries[key&pt.mask]
+	if entry.key != key {
+		*entry = params.evaluatePawns(key, whitepawns, blackpawns)
+	}
+	return *entry
+}
+
+// Evaluates the pawns of both sides.
+func (params *Params) evaluatePawns(key uint64, whitepawns, blackpawns []engine.Square) pawnEntry {
+	entry := pawnEntry{key: key}
+	for side, color := range []int{1, -1} {
+		pawns, enemypawns := whitepawns, blackpawns
+		if color == -1 {
+			pawns, enemypawns = blackpawns, whitepawns
+		}
+		structure, passedscore, passed := params.pawnTerms(pawns, enemypawns, color)
+		entry.structure[side] = params.pawnStructureAnalysis(pawns, color).plus(structure)
+		entry.passedscore[side], entry.passed[side] = passedscore, passed
+	}
+	return entry
+}
+
+// Returns the rank of a square counted from the back rank of the given color.
+func relativeRank(s engine.Square, color int) int {
+	if color == 1 {
+		return s.Y
+	}
+	return 9 - s.Y
+}
+
+func squareBit(s engine.Square) uint64 {
+	return 1 << uint((s.X-1)*8+s.Y-1)
+}
+
+// Scores backward pawns, then passed and candidate pawns, for one side from that side's point of view, and
+// returns the side's passed pawns as a mask.
+func (params *Params) pawnTerms(pawns, enemypawns []engine.Square, color int) (structure, score Score, passed uint64) {
+	for _, p := range pawns {
+		rank := relativeRank(p, color)
+		// compare ranks of other pawns with this one: ahead is positive, behind negative
+		var ownahead, neighbours, helpers, defenders, sentries, blockers, stopattackers int
+		for _, o := range pawns {
+			dx, dy := absInt(o.X-p.X), (o.Y-p.Y)*color
+			if dx == 0 && dy > 0 {
+				ownahead++
+			} else if dx == 1 {
+				neighbours++
+				if dy <= 0 {
+					helpers++
+				}
+				if dy == -1 {
+					defenders++
+				}
+			}
+		}
+		for _, e := range enemypawns {
+			dx, dy := absInt(e.X-p.X), (e.Y-p.Y)*color
+			if dx == 0 && dy > 0 {
+				blockers++
+			} else if dx == 1 && dy > 0 {
+				sentries++
+				if dy == 2 {
+					stopattackers++
+				}
+			}
+		}
+		switch {
+		case ownahead == 0 && pawnIsPassed(&engine.Piece{Position: p, Color: color}, enemypawns):
+			score = score.plus(params.PassedRank[rank-1])
+			if defenders > 0 {
+				score = score.plus(params.SupportedPasser.times(rank))
+			}
+			passed |= squareBit(p)
+		case blockers == 0 && ownahead == 0 && helpers >= sentries:
+			score = score.plus(params.CandidatePasser[rank-1])
+		case neighbours > 0 && helpers == 0 && stopattackers > 0:
+			// every pawn that could defend it has gone past it, and it cannot advance safely to join them
+			structure = structure.plus(params.BackwardPawn)
+		}
+	}
+	// passed pawns side by side, or one defending the other, are connected
+	for _, p := range pawns {
+		if passed&squareBit(p) == 0 {
+			continue
+		}
+		for _, o := range pawns {
+			if passed&squareBit(o) != 0 && absInt(o.X-p.X) == 1 && absInt(o.Y-p.Y) <= 1 {
+				score = score.plus(params.ConnectedPasser.times(relativeRank(p, color)))
+				break
+			}
+		}
+	}
+	return structure, score, passed
+}
+
+// Scores a passed pawn of the given color that the enemy king cannot catch, once the enemy has nothing but
+// pawns left to stop it with, by the rule of the square.
+// Only one such pawn is counted: one is enough to make a queen.
+func (m *boardMaps) unstoppable(params *Params, b *engine.Board, passed uint64, color int, enemyking engine.Square) Score {
+	if passed == 0 || m.pieces[colorSide(-color)] > 0 {
+		return Score{}
+	}
+	for i := uint(0); i < 64; i++ {
+		if passed&(1<<i) == 0 {
+			continue
+		}
+		x, y := int(i/8)+1, int(i%8)+1
+		promotion := 8
+		if color == -1 {
+			promotion = 1
+		}
+		moves := absInt(promotion - y)
+		if relativeRank(engine.Square{X: x, Y: y}, color) == 2 {
+			moves-- // the first move may be a double step
+		}
+		blocked := false
+		for yy := y + color; yy != promotion+color; yy += color {
+			if m.occupied[x-1][yy-1] != 0 {
+				blocked = true
+			}
+		}
+		if blocked {
+			continue
+		}
+		distance := absInt(enemyking.X - x)
+		if d := absInt(enemyking.Y - promotion); d > distance {
+			distance = d
+		}
+		if b.Turn != color {
+			distance-- // the king moves first
+		}
+		if distance > moves {
+			return params.Unstoppable
+		}
+	}
+	return Score{}
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestPawnTerms(t *testing.T) {
+	_, _, pawns := mapsFromFen(t, "4k3/8/8/8/8/8/3P4/4K3 w")
+	if _, score, passed := defaultParams.pawnTerms(pawns[0], pawns[1], 1); score != PASSEDRANK[1] || passed != squareBit(engine.Square{X: 4, Y: 2}) {
+		t.Errorf("Expected a lone pawn on d2 to be passed, got %v and mask %x", score, passed)
+	}
+	_, _, pawns = mapsFromFen(t, "4k3/8/8/3pp3/8/8/8/4K3 w")
+	connected := PASSEDRANK[3].plus(CONNECTEDPASSER.times(4)).times(2)
+	if _, score, _ := defaultParams.pawnTerms(pawns[1], pawns[0], -1); score != connected {
+		t.Errorf("Expected black's pawns on d5 and e5 to be connected passers worth %v, got %v", connected, score)
+	}
+	// the pawn on c3 is a passer defended from d2, and d2 cannot advance past the pawn on e4
+	_, _, pawns = mapsFromFen(t, "4k3/8/8/8/4p3/2P5/3P4/4K3 w")
+	expected := PASSEDRANK[2].plus(SUPPORTEDPASSER.times(3))
+	if structure, score, _ := defaultParams.pawnTerms(pawns[0], pawns[1], 1); score != expected || structure != BACKWARDPAWN {
+		t.Errorf("Expected a supported passer worth %v and a backward pawn, got %v and %v", expected, score, structure)
+	}
+	// d4 is faced by the pawn on c6, but has the pawn on c4 to help it through
+	_, _, pawns = mapsFromFen(t, "4k3/8/2p5/8/2PP4/8/8/4K3 w")
+	if _, score, passed := defaultParams.pawnTerms(pawns[0], pawns[1], 1); score != CANDIDATEPASSER[3] || passed != 0 {
+		t.Errorf("Expected d4 to be a candidate passer, got %v and mask %x", score, passed)
+	}
+}
+
+func TestPawnTable(t *testing.T) {
+	board, _, pawns := mapsFromFen(t, "4k3/pp6/8/8/3P4/8/PP6/4K3 w")
+	table := newPawnTable()
+	entry := table.probe(board, defaultParams, pawns[0], pawns[1])
+	if entry != (*pawnTable)(nil).probe(board, defaultParams, pawns[0], pawns[1]) || entry.key != board.PawnHash() {
+		t.Error("Expected the table to give the same entry as evaluating the pawns")
+	}
+	if table.probe(board, defaultParams, nil, nil) != entry {
+		t.Error("Expected the second probe to come from the table")
+	}
+	if entry.passed[0] != squareBit(engine.Square{X: 4, Y: 4}) || entry.passed[1] != 0 {
+		t.Errorf("Expected only d4 to be passed, got masks %x", entry.passed)
+	}
+}
+
+func TestUnstoppable(t *testing.T) {
+	for _, test := range []struct {
+		fen         string
+		unstoppable bool
+	}{
+		{"8/8/8/5k2/P7/8/8/K7 w", true},
+		{"8/8/8/5k2/P7/8/8/K7 b", false},
+		{"8/8/8/4k3/P7/8/8/K7 w", false},
+		{"8/8/8/5k2/P7/8/8/K6n w", false},
+		{"B7/8/8/5k2/P7/8/8/K7 w", false},
+	} {
+		board, maps, _ := mapsFromFen(t, test.fen)
+		passed := squareBit(engine.Square{X: 1, Y: 4})
+		king := board.Board[1].Position
+		if score := maps.unstoppable(defaultParams, board, passed, 1, king); (score == UNSTOPPABLE) != test.unstoppable {
+			t.Errorf("Expected the pawn in %s to be unstoppable: %t, got %v", test.fen, test.unstoppable, score)
+		}
+	}
+}
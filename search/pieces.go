@@ -0,0 +1,129 @@
+package search
+
+import "github.com/jacobroberts/chess/engine"
+
+var (
+	MOBILITY         = map[byte]Score{'n': {4, 4}, 'b': {5, 5}, 'r': {2, 4}, 'q': {1, 2}} // per safe square over MOBILITYBASE
+	MOBILITYBASE     = map[byte]int{'n': 4, 'b': 6, 'r': 7, 'q': 13}                      // safe squares of a piece with average scope
+	OUTPOST          = map[byte]Score{'n': {30, 20}, 'b': {15, 10}}                       // minor piece no enemy pawn can ever chase away
+	BISHOPPAIR       = Score{30, 50}
+	ROOKOPENFILE     = Score{40, 20} // no pawns on the rook's file
+	ROOKHALFOPENFILE = Score{20, 10} // only enemy pawns on the rook's file
+	TRAPPEDPIECE     = Score{-50, -40}
+)
+
+// What the evaluation knows about where the pieces are, gathered in one pass over the board.
+// Squares are indexed [x-1][y-1], like the attack array.
+type boardMaps struct {
+	occupied    [8][8]int     // color of the piece on each square, 0 if empty
+	pawnattacks [2][8][8]bool // squares attacked by white's pawns and by black's pawns
+	pawnfiles   [2][8]int     // number of white and black pawns on each file
+	pieces      [2]int        // number of white and black knights, bishops, rooks and queens
+}
+
+func (m *boardMaps) add(p *engine.Piece) {
+	m.occupied[p.Position.X-1][p.Position.Y-1] = p.Color
+	side := colorSide(p.Color)
+	if p.Name != 'p' {
+		if p.Name != 'k' {
+			m.pieces[side]++
+		}
+		return
+	}
+	m.pawnfiles[side][p.Position.X-1]++
+	for _, dx := range []int{-1, 1} {
+		x, y := p.Position.X+dx, p.Position.Y+p.Color
+		if 0 < x && x < 9 && 0 < y && y < 9 {
+			m.pawnattacks[side][x-1][y-1] = true
+		}
+	}
+}
+
+// Returns 0 for white and 1 for black, to index the maps.
+func colorSide(color int) int {
+	if color == 1 {
+		return 0
+	}
+	return 1
+}
+
+// Returns how many squares a knight, bishop, rook or queen can move to without landing on a square attacked by
+// an enemy pawn.
+func (m *boardMaps) safeMobility(p *engine.Piece) int {
+	enemypawns := &m.pawnattacks[colorSide(-p.Color)]
+	var count int
+	for _, dir := range p.Directions {
+		for n := 1; n < 8; n++ {
+			x, y := p.Position.X+dir[0]*n, p.Position.Y+dir[1]*n
+			if x < 1 || x > 8 || y < 1 || y > 8 {
+				break
+			}
+			occupant := m.occupied[x-1][y-1]
+			if occupant != p.Color && !enemypawns[x-1][y-1] {
+				count++
+			}
+			if occupant != 0 || !p.Infinite_direction {
+				break
+			}
+		}
+	}
+	return count
+}
+
+// Returns whether a knight or bishop stands on an outpost: in the enemy half or just short of it, defended by
+// a pawn, and on a square no enemy pawn can ever attack because none are left in front of it on the
+// neighbouring files.
+func (m *boardMaps) isOutpost(p *engine.Piece, enemypawns []engine.Square) bool {
+	x, y := p.Position.X, p.Position.Y
+	rank := y
+	if p.Color == -1 {
+		rank = 9 - y
+	}
+	if rank < 4 || rank > 6 || !m.pawnattacks[colorSide(p.Color)][x-1][y-1] {
+		return false
+	}
+	for _, pawn := range enemypawns {
+		if absInt(pawn.X-x) == 1 && (pawn.Y-y)*p.Color > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Scores the knights, bishops, rooks and queens of one side: mobility, outposts, the bishop pair, rooks on
+// open files and pieces with nowhere to go.
+func (m *boardMaps) pieceActivity(params *Params, b *engine.Board, color int, enemypawns []engine.Square, terms *evalTerms) {
+	var bishops int
+	side := colorSide(color)
+	for _, p := range b.Board {
+		if p.Captured || p.Color != color || p.Name == 'p' || p.Name == 'k' {
+			continue
+		}
+		term := pieceTerms[p.Name]
+		mobility := m.safeMobility(p)
+		terms.add(term, color, params.Mobility[p.Name].times(mobility-params.MobilityBase[p.Name]))
+		if mobility == 0 {
+			terms.add(term, color, params.TrappedPiece)
+		}
+		switch p.Name {
+		case 'b':
+			bishops++
+			fallthrough
+		case 'n':
+			if m.isOutpost(p, enemypawns) {
+				terms.add(term, color, params.Outpost[p.Name])
+			}
+		case 'r':
+			if m.pawnfiles[side][p.Position.X-1] == 0 {
+				if m.pawnfiles[1-side][p.Position.X-1] == 0 {
+					terms.add(term, color, params.RookOpenFile)
+				} else {
+					terms.add(term, color, params.RookHalfOpenFile)
+				}
+			}
+		}
+	}
+	if bishops >= 2 {
+		terms.add(termBishops, color, params.BishopPair)
+	}
+}
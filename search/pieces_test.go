@@ -0,0 +1,90 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Returns the maps of a position given in FEN, along with its pawns.
+func mapsFromFen(t *testing.T, fen string) (*engine.Board, *boardMaps, [2][]engine.Square) {
+	board, err := engine.FromFen(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var maps boardMaps
+	var pawns [2][]engine.Square
+	for _, p := range board.Board {
+		maps.add(p)
+		if p.Name == 'p' {
+			pawns[colorSide(p.Color)] = append(pawns[colorSide(p.Color)], p.Position)
+		}
+	}
+	return board, &maps, pawns
+}
+
+// Returns the white-relative score of the pieces of one side.
+func activity(board *engine.Board, maps *boardMaps, color int) Score {
+	var terms evalTerms
+	maps.pieceActivity(defaultParams, board, color, nil, &terms)
+	return terms.sum()
+}
+
+// Returns the piece on a square.
+func pieceOn(board *engine.Board, x, y int) *engine.Piece {
+	for _, p := range board.Board {
+		if p.Position.X == x && p.Position.Y == y && !p.Captured {
+			return p
+		}
+	}
+	return nil
+}
+
+func TestSafeMobility(t *testing.T) {
+	// the knight on d4 has 8 squares, but black pawns cover c6, e6 (from d7) and b3 (from c4)
+	board, maps, _ := mapsFromFen(t, "4k3/3p4/8/8/2pN4/8/8/4K3 w")
+	if mobility := maps.safeMobility(pieceOn(board, 4, 4)); mobility != 5 {
+		t.Errorf("Expected the knight to have 5 safe squares, got %d", mobility)
+	}
+	// the rook on a1 is boxed in by its own pieces
+	board, maps, _ = mapsFromFen(t, "4k3/8/8/8/8/8/PP6/RN2K3 w")
+	if mobility := maps.safeMobility(pieceOn(board, 1, 1)); mobility != 0 {
+		t.Errorf("Expected the rook to have no squares, got %d", mobility)
+	}
+	if score := activity(board, maps, 1); score.MG >= 0 {
+		t.Errorf("Expected a trapped rook to be penalized, got %v", score)
+	}
+}
+
+func TestOutpost(t *testing.T) {
+	// the knight on d5 is defended by the e4 pawn and the c7 pawn can still attack it from c6
+	board, maps, pawns := mapsFromFen(t, "4k3/2p5/8/3N4/4P3/8/8/4K3 w")
+	if maps.isOutpost(pieceOn(board, 4, 5), pawns[1]) {
+		t.Error("Expected a square an enemy pawn can still attack not to be an outpost")
+	}
+	board, maps, pawns = mapsFromFen(t, "4k3/7p/8/3N4/4P3/8/8/4K3 w")
+	if !maps.isOutpost(pieceOn(board, 4, 5), pawns[1]) {
+		t.Error("Expected a defended knight beyond the enemy pawns to be on an outpost")
+	}
+	// the same for black, mirrored
+	board, maps, pawns = mapsFromFen(t, "4k3/8/8/4p3/3n4/8/P7/4K3 b")
+	if !maps.isOutpost(pieceOn(board, 4, 4), pawns[0]) {
+		t.Error("Expected a defended black knight beyond the white pawns to be on an outpost")
+	}
+}
+
+func TestPieceActivity(t *testing.T) {
+	board, maps, _ := mapsFromFen(t, "4k3/8/8/8/8/8/8/2B1KB2 w")
+	pair := activity(board, maps, 1)
+	board, maps, _ = mapsFromFen(t, "4k3/8/8/8/8/8/8/2N1KB2 w")
+	if single := activity(board, maps, 1); pair.EG-single.EG < BISHOPPAIR.EG/2 {
+		t.Errorf("Expected the bishop pair to be worth more than a bishop and knight, got %v and %v", pair, single)
+	}
+	board, maps, _ = mapsFromFen(t, "4k3/p7/8/8/8/8/7P/R3K2R w")
+	if !(maps.pawnfiles[0][0] == 0 && maps.pawnfiles[1][0] == 1 && maps.pawnfiles[0][7] == 1) {
+		t.Errorf("Pawn files counted wrong: %v", maps.pawnfiles)
+	}
+	if score := activity(board, maps, -1); score != (Score{}) {
+		t.Errorf("Expected nothing for a side without pieces, got %v", score)
+	}
+}
@@ -0,0 +1,196 @@
+package search
+
+import "github.com/jacobroberts/chess/engine"
+
+// A piece-square table: a bonus in centipawns for a piece standing on each square, in the middlegame and in the
+// endgame. Squares are listed from white's point of view as the board is printed, a8 first and h1 last;
+// black's pieces use the same table mirrored.
+type Table struct {
+	MG [64]int
+	EG [64]int
+}
+
+// The default piece-square tables, by piece name. A parameter file sets their entries by name and index, from
+// "PST.k.mg.0" for a8 to "PST.k.mg.63" for h1, see Params.
+// Reference: https://www.chessprogramming.org/Simplified_Evaluation_Function
+var PST = map[byte]Table{
+	'p': {
+		MG: [64]int{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			10, 10, 20, 30, 30, 20, 10, 10,
+			5, 5, 10, 25, 25, 10, 5, 5,
+			0, 0, 0, 20, 20, 0, 0, 0,
+			5, -5, -10, 0, 0, -10, -5, 5,
+			5, 10, 10, -20, -20, 10, 10, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		EG: [64]int{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			80, 80, 80, 80, 80, 80, 80, 80,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			30, 30, 30, 30, 30, 30, 30, 30,
+			15, 15, 15, 15, 15, 15, 15, 15,
+			5, 5, 5, 5, 5, 5, 5, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+	},
+	'n': {
+		MG: [64]int{
+			-50, -40, -30, -30, -30, -30, -40, -50,
+			-40, -20, 0, 0, 0, 0, -20, -40,
+			-30, 0, 10, 15, 15, 10, 0, -30,
+			-30, 5, 15, 20, 20, 15, 5, -30,
+			-30, 0, 15, 20, 20, 15, 0, -30,
+			-30, 5, 10, 15, 15, 10, 5, -30,
+			-40, -20, 0, 5, 5, 0, -20, -40,
+			-50, -40, -30, -30, -30, -30, -40, -50,
+		},
+		EG: [64]int{
+			-50, -40, -30, -30, -30, -30, -40, -50,
+			-40, -20, 0, 0, 0, 0, -20, -40,
+			-30, 0, 10, 15, 15, 10, 0, -30,
+			-30, 5, 15, 20, 20, 15, 5, -30,
+			-30, 0, 15, 20, 20, 15, 0, -30,
+			-30, 5, 10, 15, 15, 10, 5, -30,
+			-40, -20, 0, 5, 5, 0, -20, -40,
+			-50, -40, -30, -30, -30, -30, -40, -50,
+		},
+	},
+	'b': {
+		MG: [64]int{
+			-20, -10, -10, -10, -10, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 10, 10, 5, 0, -10,
+			-10, 5, 5, 10, 10, 5, 5, -10,
+			-10, 0, 10, 10, 10, 10, 0, -10,
+			-10, 10, 10, 10, 10, 10, 10, -10,
+			-10, 5, 0, 0, 0, 0, 5, -10,
+			-20, -10, -10, -10, -10, -10, -10, -20,
+		},
+		EG: [64]int{
+			-20, -10, -10, -10, -10, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 10, 10, 5, 0, -10,
+			-10, 5, 5, 10, 10, 5, 5, -10,
+			-10, 0, 10, 10, 10, 10, 0, -10,
+			-10, 10, 10, 10, 10, 10, 10, -10,
+			-10, 5, 0, 0, 0, 0, 5, -10,
+			-20, -10, -10, -10, -10, -10, -10, -20,
+		},
+	},
+	'r': {
+		MG: [64]int{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			5, 10, 10, 10, 10, 10, 10, 5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			0, 0, 0, 5, 5, 0, 0, 0,
+		},
+		EG: [64]int{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			10, 10, 10, 10, 10, 10, 10, 10,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+	},
+	'q': {
+		MG: [64]int{
+			-20, -10, -10, -5, -5, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-5, 0, 5, 5, 5, 5, 0, -5,
+			0, 0, 5, 5, 5, 5, 0, -5,
+			-10, 5, 5, 5, 5, 5, 0, -10,
+			-10, 0, 5, 0, 0, 0, 0, -10,
+			-20, -10, -10, -5, -5, -10, -10, -20,
+		},
+		EG: [64]int{
+			-20, -10, -10, -5, -5, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-5, 0, 5, 5, 5, 5, 0, -5,
+			-5, 0, 5, 5, 5, 5, 0, -5,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-20, -10, -10, -5, -5, -10, -10, -20,
+		},
+	},
+	'k': {
+		MG: [64]int{
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-20, -30, -30, -40, -40, -30, -30, -20,
+			-10, -20, -20, -20, -20, -20, -20, -10,
+			20, 20, 0, 0, 0, 0, 20, 20,
+			20, 30, 10, 0, 0, 10, 30, 20,
+		},
+		EG: [64]int{
+			-50, -40, -30, -20, -20, -30, -40, -50,
+			-30, -20, -10, 0, 0, -10, -20, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -30, 0, 0, 0, 0, -30, -30,
+			-50, -30, -30, -30, -30, -30, -30, -50,
+		},
+	},
+}
+
+// Returns the bonus for a piece on a square, positive for white and negative for black.
+func pstScore(pst map[byte]Table, name byte, color int, s engine.Square) Score {
+	table, ok := pst[name]
+	if !ok {
+		return Score{}
+	}
+	y := s.Y
+	if color == -1 {
+		y = 9 - y
+	}
+	i := (8-y)*8 + s.X - 1
+	return Score{table.MG[i] * color, table.EG[i] * color}
+}
+
+// Keeps the sum of the piece-square bonuses of a board up to date as moves are made and taken back,
+// as an engine.Listener, so that EvalBoard does not have to add them up for every position.
+type pstTracker struct {
+	pst   map[byte]Table
+	score Score
+}
+
+// Starts tracking the piece-square bonuses of b with the tables in pst. Stop with b.RemoveListener.
+func trackPST(b *engine.Board, pst map[byte]Table) *pstTracker {
+	tracker := &pstTracker{pst: pst, score: boardPST(b, pst)}
+	b.AddListener(tracker)
+	return tracker
+}
+
+func (tracker *pstTracker) Added(name byte, color int, s engine.Square) {
+	tracker.score = tracker.score.plus(pstScore(tracker.pst, name, color, s))
+}
+
+func (tracker *pstTracker) Removed(name byte, color int, s engine.Square) {
+	tracker.score = tracker.score.minus(pstScore(tracker.pst, name, color, s))
+}
+
+// Adds up the piece-square bonuses of every piece on the board, with the tables in pst.
+func boardPST(b *engine.Board, pst map[byte]Table) Score {
+	var score Score
+	for _, p := range b.Board {
+		if !p.Captured {
+			score = score.plus(pstScore(pst, p.Name, p.Color, p.Position))
+		}
+	}
+	return score
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestPSTTracker(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	if score := boardPST(board, PST); score != (Score{}) {
+		t.Errorf("Expected the starting position to be symmetrical, got %v", score)
+	}
+	th := newThread(context.Background(), board, nil, nil)
+	defer th.close()
+	tracker := th.evaluator.(*classicalBoard).pst
+	// play a few moves, always the first legal one, including captures and castling as they come up
+	played := make([]*engine.Move, 0)
+	for i := 0; i < 12; i++ {
+		moves := board.AllLegalMoves()
+		move := moves[i*7%len(moves)]
+		th.makeMove(move)
+		played = append(played, move)
+		if tracker.score != boardPST(board, PST) {
+			t.Fatalf("After %s the tracked bonus %v differs from the board's %v", move.ToString(), tracker.score, boardPST(board, PST))
+		}
+	}
+	for i := len(played) - 1; i >= 0; i-- {
+		th.undoMove(played[i])
+	}
+	if tracker.score != (Score{}) {
+		t.Errorf("Expected taking every move back to restore the bonus, got %v", tracker.score)
+	}
+}
+
+func TestLoadPST(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "pst.json")
+	table := func(first int) string {
+		return "[" + strconv.Itoa(first) + strings.Repeat(", 0", 63) + "]"
+	}
+	if err := os.WriteFile(filename, []byte(`{"PST": {"k": {"mg": `+table(1)+`, "eg": `+table(2)+`}, "q": {"eg": `+table(3)+`}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	params, err := LoadParams(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a8 := engine.Square{X: 1, Y: 8}
+	if score := pstScore(params.PST, 'k', 1, a8); score != (Score{1, 2}) {
+		t.Errorf("Expected the loaded king table, got %v", score)
+	}
+	if score := pstScore(params.PST, 'k', -1, engine.Square{X: 1, Y: 1}); score != (Score{-1, -2}) {
+		t.Errorf("Expected black to use the mirrored table, got %v", score)
+	}
+	if params.PST['n'] != PST['n'] || pstScore(PST, 'k', 1, a8) == (Score{1, 2}) {
+		t.Error("Expected tables left out of the file and the defaults to be kept")
+	}
+	if params.PST['q'].MG != PST['q'].MG || params.PST['q'].EG[0] != 3 {
+		t.Error("Expected only the endgame half of the queen table to be replaced")
+	}
+	// the tables belong to the engine that loaded them
+	board, _ := engine.FromFen("4k3/8/8/8/8/8/8/K7 w")
+	if eval := (Classical{Params: params}).Evaluate(board); eval == EvalBoard(board) {
+		t.Errorf("Expected the loaded tables to change the evaluation, got %d both times", eval)
+	}
+	for _, bad := range []string{`{"PST": {"x": {"mg": [0]}}}`, `{"PST": {"k": {"eg": ` + table(0)[:len(table(0))-1] + `, 0]}}}`, `{"PST": {"k": {"mg": [5000]}}}`} {
+		if err := os.WriteFile(filename, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadParams(filename); err == nil {
+			t.Errorf("Expected an error loading %.30s", bad)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package search
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+const (
+	DELTAMARGIN = 200   // safety margin for delta pruning
+	KINGVALUE   = 10000 // only used so that static exchanges never trade the king
+)
+
+// Value of a piece for capture ordering and static exchange evaluation.
+func pieceValue(name byte) int {
+	if name == 'k' {
+		return KINGVALUE
+	}
+	return VALUES[name]
+}
+
+// Material a move wins before the opponent replies.
+func moveGain(m *engine.Move) int {
+	gain := pieceValue(m.Capture)
+	if m.Promotion != 0 {
+		gain += pieceValue(m.Promotion) - pieceValue('p')
+	}
+	return gain
+}
+
+// The following defines a type so that the sort package can order captures by MVV-LVA:
+// most valuable victim first, least valuable attacker breaking ties.
+type byMVVLVA []*engine.Move
+
+func (s byMVVLVA) Len() int {
+	return len(s)
+}
+
+func (s byMVVLVA) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s byMVVLVA) Less(i, j int) bool {
+	if gi, gj := moveGain(s[i]), moveGain(s[j]); gi != gj {
+		return gi > gj
+	}
+	return pieceValue(s[i].Piece) < pieceValue(s[j].Piece)
+}
+
+// Returns the captures and queen promotions among the legal moves of the player whose turn it is, best first.
+func captureMoves(movelist []*engine.Move) []*engine.Move {
+	captures := make([]*engine.Move, 0)
+	for _, move := range movelist {
+		if move.Capture != 0 || move.Promotion == 'q' {
+			captures = append(captures, move)
+		}
+	}
+	sort.Sort(byMVVLVA(captures))
+	return captures
+}
+
+// Returns the least valuable piece of the given color attacking a square, or nil if there is none.
+func leastValuableAttacker(b *engine.Board, s *engine.Square, color int) *engine.Piece {
+	var attacker *engine.Piece
+	for _, p := range b.Board {
+		if p.Color == color && !p.Captured && p.Attacking(s, b) {
+			if attacker == nil || pieceValue(p.Name) < pieceValue(attacker.Name) {
+				attacker = p
+			}
+		}
+	}
+	return attacker
+}
+
+// Static exchange evaluation.
+// Plays out every capture on the destination square of m, each side always recapturing with its least
+// valuable piece and stopping as soon as recapturing would lose material.
+// Returns the material won by the player making m, in centipawns.
+func see(b *engine.Board, m *engine.Move) int {
+	gain := moveGain(m)
+	victim := pieceValue(m.Piece)
+	if m.Promotion != 0 {
+		victim = pieceValue(m.Promotion)
+	}
+	b.ForceMove(m)
+	gain -= seeSquare(b, m.End, victim)
+	b.UndoMove(m)
+	return gain
+}
+
+// Material the player whose turn it is wins by capturing on s, where the piece on s is worth victim.
+func seeSquare(b *engine.Board, s engine.Square, victim int) int {
+	attacker := leastValuableAttacker(b, &s, b.Turn)
+	if attacker == nil {
+		return 0
+	}
+	_, capture := b.Occupied(&s)
+	m := &engine.Move{
+		Piece:   attacker.Name,
+		Begin:   attacker.Position,
+		End:     s,
+		Capture: capture,
+	}
+	value := pieceValue(attacker.Name)
+	if attacker.Name == 'p' && (s.Y == 1 || s.Y == 8) {
+		m.Promotion = 'q'
+		value = pieceValue('q')
+	}
+	b.ForceMove(m)
+	gain := victim - seeSquare(b, s, value)
+	b.UndoMove(m)
+	if gain < 0 {
+		return 0
+	}
+	return gain
+}
+
+// Reference: https://www.chessprogramming.org/Quiescence_Search
+
+// Searches captures and promotions until the position is quiet, so that a position is never evaluated in
+// the middle of an exchange.
+// The side to move may always "stand pat" and accept the static evaluation, except on the first ply
+// when it is in check, where every evasion is searched instead.
+// Captures that cannot raise the score to alpha (delta pruning) or that lose material (SEE pruning) are skipped.
+// ply is the distance from the root and qply the distance from the start of the quiescence search.
+func Quiescence(ctx context.Context, b *engine.Board, alpha, beta int, ply, qply int) int {
+	t := newThread(ctx, b, nil, nil)
+	defer t.close()
+	return t.quiescence(alpha, beta, ply, qply)
+}
+
+func (t *thread) quiescence(alpha, beta int, ply, qply int) int {
+	t.poll(ply)
+	if t.stopped() {
+		return 0
+	}
+	b := t.board
+	if qply == 0 && b.IsCheck(b.Turn) {
+		return t.quiescenceEvasions(alpha, beta, ply)
+	}
+	if b.InsufficientMaterial() {
+		return t.drawscore
+	}
+	// a position without moves is mate or stalemate, whatever the evaluation makes of it
+	movelist := b.AllLegalMoves()
+	if len(movelist) == 0 {
+		return t.terminalScore(ply)
+	}
+	standpat := mateAtPly(t.evaluate(), ply)
+	if b.Turn == 1 {
+		if standpat >= beta {
+			return standpat
+		}
+		if standpat+pieceValue('q')+DELTAMARGIN < alpha {
+			return alpha
+		}
+		if standpat > alpha {
+			alpha = standpat
+		}
+		for _, move := range captureMoves(movelist) {
+			if standpat+moveGain(move)+DELTAMARGIN <= alpha || see(b, move) < 0 {
+				continue
+			}
+			b.ForceMove(move)
+			score := t.quiescence(alpha, beta, ply+1, qply+1)
+			b.UndoMove(move)
+			if score > alpha {
+				alpha = score
+			}
+			if alpha >= beta {
+				return alpha
+			}
+		}
+		return alpha
+	} else {
+		if standpat <= alpha {
+			return standpat
+		}
+		if standpat-pieceValue('q')-DELTAMARGIN > beta {
+			return beta
+		}
+		if standpat < beta {
+			beta = standpat
+		}
+		for _, move := range captureMoves(movelist) {
+			if standpat-moveGain(move)-DELTAMARGIN >= beta || see(b, move) < 0 {
+				continue
+			}
+			b.ForceMove(move)
+			score := t.quiescence(alpha, beta, ply+1, qply+1)
+			b.UndoMove(move)
+			if score < beta {
+				beta = score
+			}
+			if beta <= alpha {
+				return beta
+			}
+		}
+		return beta
+	}
+}
+
+// Searches every legal reply to a check, captures first.
+// Checkmate is scored when there are none.
+func (t *thread) quiescenceEvasions(alpha, beta int, ply int) int {
+	b := t.board
+	movelist := b.AllLegalMoves()
+	if len(movelist) == 0 {
+		return t.terminalScore(ply)
+	}
+	sort.Stable(byMVVLVA(movelist))
+	if b.Turn == 1 {
+		for _, move := range movelist {
+			b.ForceMove(move)
+			score := t.quiescence(alpha, beta, ply+1, 1)
+			b.UndoMove(move)
+			if score > alpha {
+				alpha = score
+			}
+			if alpha >= beta {
+				return alpha
+			}
+		}
+		return alpha
+	} else {
+		for _, move := range movelist {
+			b.ForceMove(move)
+			score := t.quiescence(alpha, beta, ply+1, 1)
+			b.UndoMove(move)
+			if score < beta {
+				beta = score
+			}
+			if beta <= alpha {
+				return beta
+			}
+		}
+		return beta
+	}
+}
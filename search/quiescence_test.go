@@ -0,0 +1,66 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestSee(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 1, 1)
+	board.PlacePiece('k', -1, 8, 8)
+	board.PlacePiece('r', 1, 4, 1)
+	board.PlacePiece('p', -1, 4, 5)
+	capture := &engine.Move{Piece: 'r', Begin: engine.Square{X: 4, Y: 1}, End: engine.Square{X: 4, Y: 5}, Capture: 'p'}
+	if gain := see(board, capture); gain != 100 {
+		t.Errorf("Capturing an undefended pawn should gain 100, got %d", gain)
+	}
+	board.PlacePiece('p', -1, 5, 6)
+	if gain := see(board, capture); gain != -400 {
+		t.Errorf("Rook capturing a defended pawn should lose 400, got %d", gain)
+	}
+	board.PlacePiece('r', 1, 4, 8)
+	if gain := see(board, capture); gain != -300 {
+		t.Errorf("Recapturing with the second rook should win back a pawn, expected -300, got %d", gain)
+	}
+	if board.Board[3].Captured || board.Board[2].Position.Y != 1 || board.Turn != 1 {
+		t.Error("Static exchange evaluation modified the board")
+	}
+}
+
+func TestQuiescence(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 1, 1)
+	board.PlacePiece('k', -1, 8, 8)
+	board.PlacePiece('q', 1, 4, 1)
+	board.PlacePiece('p', -1, 4, 5)
+	board.PlacePiece('p', -1, 5, 6)
+	if score, eval := Quiescence(context.Background(), board, BLACKWIN, WHITEWIN, 0, 0), EvalBoard(board); score != eval {
+		t.Errorf("Losing capture should have been pruned, quiescence gave %d and static evaluation %d", score, eval)
+	}
+	if move := AlphaBeta(context.Background(), board, 1, BLACKWIN, WHITEWIN); move.End.X == 4 && move.End.Y == 5 {
+		t.Error("Queen captured a defended pawn at the horizon")
+	}
+
+	board = &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 1, 1)
+	board.PlacePiece('k', -1, 8, 8)
+	board.PlacePiece('p', 1, 4, 4)
+	board.PlacePiece('n', -1, 5, 5)
+	board.PlacePiece('p', -1, 6, 6)
+	// after dxe5 fxe5 black is left with a pawn the white king stops, which the KPK bitbase scores as a draw
+	if score, eval := Quiescence(context.Background(), board, BLACKWIN, WHITEWIN, 0, 0), EvalBoard(board); score != DRAW || eval != -341 {
+		t.Errorf("Winning a knight for a pawn should raise the score from -341 to %d, quiescence gave %d and static evaluation %d", DRAW, score, eval)
+	}
+
+	board = &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 1, 1)
+	board.PlacePiece('k', -1, 8, 8)
+	board.PlacePiece('q', -1, 2, 2)
+	board.PlacePiece('r', -1, 8, 2)
+	if score := Quiescence(context.Background(), board, BLACKWIN, WHITEWIN, 0, 0); score != BLACKWIN {
+		t.Errorf("Checkmate inside quiescence gave score %d", score)
+	}
+}
@@ -0,0 +1,316 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Settings for a call to Search.
+type Options struct {
+	Depth   int                 // depth of the last iteration, or 0 to search until cancelled
+	Nodes   uint64              // stop once about this many positions have been searched after depth 1, or 0 for no limit
+	Threads int                 // number of threads searching in parallel, 1 if not set
+	Table   *TranspositionTable // shared by all threads; keep it between moves to reuse earlier work. Made if nil.
+
+	// Ponderhit makes the search a ponder search: one started on the move the opponent is expected to play,
+	// while it is still their turn. Until a value is received from Ponderhit or it is closed, the search keeps
+	// going past Depth and does not return. Afterwards it becomes a normal search, keeping everything it has
+	// found so far. A ponder search on the wrong move should be cancelled through its context.
+	Ponderhit <-chan struct{}
+
+	// Info is called with the progress of the search every time a depth is finished, once for each line.
+	// May be nil.
+	Info func(Info)
+
+	// MultiPV is the number of best moves to find, each with a line of its own. 1 if not set.
+	// The second best move is found by searching the root again without the best move, and so on.
+	MultiPV int
+
+	// Strength makes the engine play weaker, by limiting Depth and Nodes and choosing among at least
+	// four lines instead of always playing the best move. Full strength if nil or at MAXSKILL.
+	Strength *Strength
+
+	// Contempt is how many centipawns worse than equal a draw is for the side to move, so that it avoids draws
+	// against weaker opponents. Negative to seek draws instead. Applies to stalemate, repetition, the fifty
+	// move rule and insufficient material.
+	Contempt int
+
+	// History holds the hashes (see engine.Board.Hash) of the positions played before the one searched, since the
+	// last capture or pawn move, oldest first. HalfmoveClock counts the half-moves played since then.
+	// Both are needed to recognize draws by repetition and the fifty move rule.
+	History       []uint64
+	HalfmoveClock int
+
+	// Clock makes the search manage its own time, stopping when a TimeManager says so. Depth and Nodes still
+	// apply. The time of a ponder search starts at the ponderhit. No time limit if nil.
+	Clock *Clock
+
+	// Evaluator scores the positions at the leaves of the search. Classical if nil.
+	Evaluator Evaluator
+
+	// Tablebase gives the exact result of positions with few enough pieces. At the root, only the moves it ranks
+	// best are searched. Not used if nil.
+	Tablebase Tablebase
+}
+
+// What a search found: the move to play and how good it is for white, in centipawns.
+// With a Strength set, the move to play may not be the best: Move, Score, Mate and PV then describe the line
+// chosen, which may not be Lines[0].
+// Mate is the number of moves until a forced mate, separate from the score so that it can be reported as "mate in N".
+// It is positive when white mates, negative when black mates and 0 when no forced mate was found.
+type Result struct {
+	Move   *engine.Move
+	Score  int
+	Mate   int
+	PV     []*engine.Move // principal variation, starting with Move
+	Lines  []Line         // the best moves, best first, as many as Options.MultiPV asked for
+	Depth  int            // last depth searched completely
+	Nodes  uint64         // positions searched by all threads
+	TBHits uint64         // successful tablebase probes by all threads
+}
+
+// One of the best moves at the root, with its own score and principal variation.
+type Line struct {
+	Move  *engine.Move
+	Score int
+	Mate  int
+	PV    []*engine.Move
+}
+
+// Adds lines from an earlier depth to the lines of the current depth, until there are n.
+// Used when a search is cancelled before finding every line of the current depth.
+func mergeLines(lines, earlier []Line, n int) []Line {
+	for _, line := range earlier {
+		if len(lines) >= n {
+			break
+		}
+		var found bool
+		for _, l := range lines {
+			if sameMove(l.Move, line.Move) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Chooses moves. AlphaBetaSearcher and MCTS both are, so that the engine can be switched between them.
+type Searcher interface {
+	Search(ctx context.Context, b *engine.Board, opts Options) Result
+}
+
+// The alpha-beta search of Search, as a Searcher.
+type AlphaBetaSearcher struct{}
+
+func (AlphaBetaSearcher) Search(ctx context.Context, b *engine.Board, opts Options) Result {
+	return Search(ctx, b, opts)
+}
+
+// Reference: https://www.chessprogramming.org/Lazy_SMP
+
+// Searches a position by iterative deepening and reports the best move.
+// Move is nil when the game is already over.
+// Cancelling ctx stops the search, which then reports the best move found so far.
+// With more than one thread the search is a "lazy SMP": every thread searches the same root on a copy of the
+// board, and they only cooperate through the shared transposition table. Helpers alternate between the main
+// thread's depth and one deeper and order their root moves differently, so that they fill the table with
+// entries the main thread has not reached yet. The main thread's move is the one reported.
+func Search(ctx context.Context, b *engine.Board, opts Options) Result {
+	if b.IsOver() != 0 {
+		return Result{}
+	}
+	maxdepth := opts.Depth
+	if maxdepth < 1 || maxdepth >= MAXPLY {
+		maxdepth = MAXPLY - 1
+	}
+	maxnodes := opts.Nodes
+	multipv := opts.MultiPV
+	if opts.Strength.weakens() {
+		if depth := opts.Strength.depth(); depth < maxdepth {
+			maxdepth = depth
+		}
+		if nodes := opts.Strength.nodes(); maxnodes == 0 || nodes < maxnodes {
+			maxnodes = nodes
+		}
+		if multipv < 4 {
+			multipv = 4
+		}
+	}
+	table := opts.Table
+	if table == nil {
+		table = NewTranspositionTable(DEFAULTHASH)
+	}
+	table.NewSearch()
+
+	var timer *TimeManager
+	if opts.Clock != nil {
+		timer = NewTimeManager(*opts.Clock, b)
+	}
+	pondering := opts.Ponderhit != nil
+	ponderhit := func() bool {
+		if pondering {
+			select {
+			case <-opts.Ponderhit:
+				pondering = false
+				if timer != nil {
+					timer.Restart()
+				}
+			default:
+			}
+		}
+		return !pondering
+	}
+	var result Result
+	drawscore := drawScore(opts.Contempt, b.Turn)
+	mainthread := newThread(ctx, b, table, opts.Evaluator)
+	mainthread.drawscore = drawscore
+	mainthread.setHistory(opts.History, opts.HalfmoveClock)
+	defer mainthread.close()
+	if opts.Tablebase != nil {
+		mainthread.tablebase = opts.Tablebase
+		mainthread.rootmoves = mainthread.tablebaseRootMoves()
+	}
+	helpers := make([]*thread, 0)
+	nodes := func() uint64 {
+		n := atomic.LoadUint64(&mainthread.nodes)
+		for _, helper := range helpers {
+			n += atomic.LoadUint64(&helper.nodes)
+		}
+		return n
+	}
+	tbhits := func() uint64 {
+		n := atomic.LoadUint64(&mainthread.tbhits)
+		for _, helper := range helpers {
+			n += atomic.LoadUint64(&helper.tbhits)
+		}
+		return n
+	}
+	mainthread.limit = func() bool {
+		if maxnodes != 0 && result.Depth >= 1 && nodes() >= maxnodes && ponderhit() {
+			return true
+		}
+		// the first iteration always finishes, so that the move played has been searched even with no time left
+		if timer != nil && result.Depth >= 1 && ponderhit() && timer.timeUp() {
+			return true
+		}
+		// a ponder search that has already gone past its depth ends as soon as it becomes a normal search
+		return result.Depth >= maxdepth && ponderhit()
+	}
+
+	helpersstop := new(int32)
+	var wg sync.WaitGroup
+	for i := 1; i < opts.Threads; i++ {
+		helper := newThread(ctx, b.Copy(), table, opts.Evaluator)
+		helper.id, helper.stop, helper.drawscore = i, helpersstop, drawscore
+		helper.tablebase, helper.rootmoves = mainthread.tablebase, mainthread.rootmoves
+		helper.setHistory(opts.History, opts.HalfmoveClock)
+		helpers = append(helpers, helper)
+		wg.Add(1)
+		go func(helper *thread) {
+			defer wg.Done()
+			defer helper.close()
+			for depth := 1 + helper.id%2; depth < MAXPLY && !helper.stopped(); depth++ {
+				helper.rootSearch(depth, BLACKWIN, WHITEWIN)
+			}
+		}(helper)
+	}
+
+	start := time.Now()
+	if multipv < 1 {
+		multipv = 1
+	}
+	legal := len(b.AllLegalMoves())
+	if mainthread.rootmoves != nil {
+		legal = len(mainthread.rootmoves)
+	}
+	if multipv > legal {
+		multipv = legal
+	}
+	for depth := 1; depth < MAXPLY; depth++ {
+		mainthread.seldepth = 0
+		mainthread.excluded = mainthread.excluded[:0]
+		lines := make([]Line, 0, multipv)
+		for len(lines) < multipv {
+			move := mainthread.rootSearch(depth, BLACKWIN, WHITEWIN)
+			if move == nil {
+				break
+			}
+			lines = append(lines, Line{Move: move, Score: move.Score, Mate: MateIn(move.Score), PV: mainthread.principalVariation()})
+			mainthread.excluded = append(mainthread.excluded, move)
+			if mainthread.stopped() {
+				break
+			}
+		}
+		result.Lines = mergeLines(lines, result.Lines, multipv)
+		if len(result.Lines) > 0 {
+			best := result.Lines[0]
+			result.Move, result.Score, result.Mate, result.PV = best.Move, best.Score, best.Mate, best.PV
+		}
+		if mainthread.stopped() {
+			break
+		}
+		result.Depth = depth
+		if opts.Info != nil {
+			elapsed := time.Since(start)
+			for i, line := range result.Lines {
+				info := Info{
+					Depth:    depth,
+					SelDepth: mainthread.seldepth,
+					MultiPV:  i + 1,
+					Score:    line.Score,
+					Mate:     line.Mate,
+					Nodes:    nodes(),
+					Time:     elapsed,
+					Hashfull: table.Hashfull(),
+					TBHits:   tbhits(),
+					PV:       line.PV,
+				}
+				if elapsed > 0 {
+					info.NPS = uint64(float64(info.Nodes) / elapsed.Seconds())
+				}
+				opts.Info(info)
+			}
+		}
+		if timer != nil {
+			timer.update(result.Move, result.Score, b.Turn)
+			if ponderhit() && !timer.nextIteration() {
+				break
+			}
+		}
+		if depth >= maxdepth && ponderhit() {
+			break
+		}
+	}
+	if pondering && ctx.Err() == nil {
+		// every depth has been searched, but a ponder search may not return before the opponent has moved
+		select {
+		case <-opts.Ponderhit:
+		case <-ctx.Done():
+		}
+	}
+	atomic.StoreInt32(helpersstop, 1)
+	wg.Wait()
+	if result.Move == nil {
+		// cancelled before a single move was searched
+		result.Move = b.AllLegalMoves()[0]
+		if mainthread.rootmoves != nil {
+			result.Move = mainthread.rootmoves[0]
+		}
+		result.PV = []*engine.Move{result.Move}
+		result.Lines = []Line{{Move: result.Move, PV: result.PV}}
+	}
+	if opts.Strength.weakens() {
+		line := opts.Strength.pick(result.Lines, b.Turn)
+		result.Move, result.Score, result.Mate, result.PV = line.Move, line.Score, line.Mate, line.PV
+	}
+	result.Nodes, result.TBHits = nodes(), tbhits()
+	return result
+}
@@ -1,25 +1,29 @@
 package search
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/jacobroberts/chess/engine"
 )
 
 func TestSearch(t *testing.T) {
-	functions := []func(*engine.Board, int, float64, float64) *engine.Move{AlphaBeta}
+	functions := []func(context.Context, *engine.Board, int, int, int) *engine.Move{AlphaBeta}
 	function_names := []string{"AlphaBeta"}
 	board := &engine.Board{Turn: -1}
 	board.PlacePiece('k', 1, 1, 1)
 	board.PlacePiece('k', -1, 1, 3)
 	board.PlacePiece('r', -1, 3, 3)
 	for i, f := range functions {
-		move := f(board, 2, BLACKWIN, WHITEWIN)
+		move := f(context.Background(), board, 2, BLACKWIN, WHITEWIN)
 		if move.Begin.X != 3 || move.End.Y != 1 {
 			t.Errorf("\nFunction %s gave move %s when Rc3-c1 was expected\n Unable to solve one move checkmate\n Full returned move: %+v", function_names[i], move.ToString(), move)
 		}
-		if move.Score != BLACKWIN {
-			t.Errorf("Checkmate should have given score %f, instead gave score %f", BLACKWIN, move.Score)
+		if move.Score != BLACKWIN+1 {
+			t.Errorf("Mate in one should have given score %d, instead gave score %d", BLACKWIN+1, move.Score)
 		}
 		if board.Turn != -1 {
 			t.Errorf("Board turn got flipped, is %d instead of -1", board.Turn)
@@ -44,12 +48,12 @@ func TestSearch(t *testing.T) {
 	board.PlacePiece('r', 1, 3, 7)
 	board.PlacePiece('r', 1, 4, 8)
 	for i, f := range functions {
-		move := f(board, 4, BLACKWIN, WHITEWIN)
+		move := f(context.Background(), board, 4, BLACKWIN, WHITEWIN)
 		if move.Begin.X != 4 || move.End.X != 2 || move.End.Y != 8 {
 			t.Errorf("\nFunction %s gave move %s when rd8-b8 was expected\n Unable to solve two move checkmate\n Full returned move: %+v", function_names[i], move.ToString(), move)
 		}
-		if move.Score != WHITEWIN {
-			t.Errorf("Checkmate should have given score %f, instead gave score %f", WHITEWIN, move.Score)
+		if move.Score != WHITEWIN-3 {
+			t.Errorf("Mate in two should have given score %d, instead gave score %d", WHITEWIN-3, move.Score)
 		}
 		if board.Turn != 1 {
 			t.Errorf("Board turn got flipped, is %d instead of 1", board.Turn)
@@ -69,3 +73,294 @@ func TestSearch(t *testing.T) {
 		}
 	}
 }
+
+func TestSearchReportsMate(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 8, 8)
+	board.PlacePiece('k', -1, 2, 1)
+	board.PlacePiece('r', 1, 3, 7)
+	board.PlacePiece('r', 1, 4, 8)
+	if result := Search(context.Background(), board, Options{Depth: 4}); result.Mate != 2 {
+		t.Errorf("Expected mate in 2, got mate in %d with score %d", result.Mate, result.Score)
+	}
+	board = &engine.Board{Turn: -1}
+	board.PlacePiece('k', 1, 1, 1)
+	board.PlacePiece('k', -1, 1, 3)
+	board.PlacePiece('r', -1, 3, 3)
+	if result := Search(context.Background(), board, Options{Depth: 2}); result.Mate != -1 {
+		t.Errorf("Expected black to mate in 1, got mate in %d with score %d", result.Mate, result.Score)
+	}
+	if mate := MateIn(350); mate != 0 {
+		t.Errorf("Centipawn score reported as mate in %d", mate)
+	}
+}
+
+func TestMateScoresInTranspositionTable(t *testing.T) {
+	// a mate in 3 plies found 4 plies from the root is a mate in 7 plies from the root
+	stored := scoreToTT(WHITEWIN-7, 4)
+	if stored != WHITEWIN-3 {
+		t.Errorf("Mate should be stored relative to the position, expected %d got %d", WHITEWIN-3, stored)
+	}
+	if score := scoreFromTT(stored, 2); score != WHITEWIN-5 {
+		t.Errorf("Mate reached by a shorter path should be nearer the root, expected %d got %d", WHITEWIN-5, score)
+	}
+	if score := scoreFromTT(scoreToTT(BLACKWIN+6, 6), 1); score != BLACKWIN+1 {
+		t.Errorf("Black mate read back at ply 1 gave %d", score)
+	}
+	if score := scoreToTT(125, 10); score != 125 {
+		t.Errorf("Non-mate scores should be stored unchanged, got %d", score)
+	}
+}
+
+func TestLazySMP(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 8, 8)
+	board.PlacePiece('k', -1, 2, 1)
+	board.PlacePiece('r', 1, 3, 7)
+	board.PlacePiece('r', 1, 4, 8)
+	fen := board.ToFen()
+	table := NewTranspositionTable(1)
+	for _, threads := range []int{1, 4} {
+		result := Search(context.Background(), board, Options{Depth: 4, Threads: threads, Table: table})
+		// rd8-b8 and rd8-d2 both mate in 2
+		if move := result.Move; move.Begin.X != 4 || !(move.End == engine.Square{X: 2, Y: 8} || move.End == engine.Square{X: 4, Y: 2}) {
+			t.Errorf("%d threads gave move %s when rd8-b8 or rd8-d2 was expected", threads, move.ToString())
+		}
+		if result.Mate != 2 {
+			t.Errorf("%d threads found mate in %d instead of mate in 2", threads, result.Mate)
+		}
+		if newfen := board.ToFen(); newfen != fen {
+			t.Errorf("Searching with %d threads modified the board from %s to %s", threads, fen, newfen)
+		}
+	}
+}
+
+func TestTranspositionTable(t *testing.T) {
+	table := NewTranspositionTable(1)
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	hash := board.Hash()
+	if _, ok := table.Probe(hash); ok {
+		t.Error("Empty table returned an entry")
+	}
+	stored := ttData{score: -125, depth: 3, bound: LOWERBOUND, hasmove: true,
+		begin: engine.Square{X: 5, Y: 2}, end: engine.Square{X: 5, Y: 4}}
+	table.Store(hash, stored)
+	entry, ok := table.Probe(hash)
+	if !ok || entry != stored {
+		t.Errorf("Stored %+v, probed %+v", stored, entry)
+	}
+	if move := entry.matchMove(board.AllLegalMoves()); move == nil || move.ToString() != "pe2-e4" {
+		t.Errorf("Stored move should match pe2-e4, matched %v", move)
+	}
+	if _, ok := table.Probe(hash ^ 1<<40); ok {
+		t.Error("Probing a different position with the same index returned an entry")
+	}
+}
+
+// Time to reach depth 3 in a rook endgame with one, two and four threads.
+func BenchmarkLazySMP(b *testing.B) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 7, 1)
+	board.PlacePiece('k', -1, 7, 8)
+	board.PlacePiece('r', 1, 1, 1)
+	board.PlacePiece('r', -1, 4, 8)
+	for x := 6; x <= 8; x++ {
+		board.PlacePiece('p', 1, x, 2)
+		board.PlacePiece('p', -1, x, 7)
+	}
+	for _, threads := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Search(context.Background(), board.Copy(), Options{Depth: 3, Threads: threads, Table: NewTranspositionTable(4)})
+			}
+		})
+	}
+}
+
+func TestSearchCancel(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := Search(ctx, board, Options{Threads: 2})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Search took %s to notice it was cancelled", elapsed)
+	}
+	if result.Move == nil {
+		t.Fatal("Cancelled search returned no move")
+	}
+	if err := board.Copy().Move(result.Move); err != nil {
+		t.Errorf("Cancelled search returned illegal move %s: %s", result.Move.ToString(), err)
+	}
+	if fen := board.ToFen(); fen != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w" {
+		t.Errorf("Cancelled search left the board at %s", fen)
+	}
+}
+
+func TestPonder(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 7, 1)
+	board.PlacePiece('k', -1, 7, 8)
+	board.PlacePiece('r', 1, 1, 1)
+	board.PlacePiece('p', 1, 6, 2)
+	board.PlacePiece('p', -1, 6, 7)
+	ponderhit := make(chan struct{})
+	results := make(chan Result, 1)
+	go func() {
+		results <- Search(context.Background(), board, Options{Depth: 1, Ponderhit: ponderhit})
+	}()
+	select {
+	case <-results:
+		t.Fatal("Ponder search returned before ponderhit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(ponderhit)
+	select {
+	case result := <-results:
+		if result.Move == nil || result.Depth < 1 {
+			t.Errorf("Ponder search converted to a normal search gave %+v", result)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Search did not end after ponderhit")
+	}
+}
+
+func TestSearchInfo(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.PlacePiece('k', 1, 8, 8)
+	board.PlacePiece('k', -1, 2, 1)
+	board.PlacePiece('r', 1, 3, 7)
+	board.PlacePiece('r', 1, 4, 8)
+	infos := make([]Info, 0)
+	result := Search(context.Background(), board, Options{Depth: 4, Info: func(info Info) {
+		infos = append(infos, info)
+	}})
+	if len(infos) != 4 {
+		t.Fatalf("Expected an info for each of 4 depths, got %d", len(infos))
+	}
+	for i, info := range infos {
+		if info.Depth != i+1 || info.SelDepth == 0 || info.Nodes == 0 || len(info.PV) == 0 {
+			t.Errorf("Info for depth %d is incomplete: %+v", i+1, info)
+		}
+	}
+	last := infos[len(infos)-1]
+	if last.Mate != 2 || len(last.PV) != 3 || last.PV[0] != result.Move {
+		t.Errorf("Expected a three move mating line starting with the best move, got %s", last)
+	}
+	pvboard := board.Copy()
+	for _, m := range result.PV {
+		if err := pvboard.Move(m); err != nil {
+			t.Fatalf("Principal variation has illegal move %s: %s", m.ToString(), err)
+		}
+	}
+	if pvboard.IsOver() != 2 {
+		t.Errorf("Mating line %s did not end in mate", last)
+	}
+}
+
+func TestMultiPV(t *testing.T) {
+	// the white queen can take an undefended rook, knight or pawn
+	board, err := engine.FromFen("k7/8/8/1r1q1n2/8/3Q4/8/K6p w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := Search(context.Background(), board, Options{Depth: 2, MultiPV: 3})
+	if len(result.Lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(result.Lines))
+	}
+	if result.Lines[0].Move != result.Move || result.Lines[0].Score != result.Score {
+		t.Errorf("Expected the first line to be the best move %s, got %s", result.Move.ToString(), result.Lines[0].Move.ToString())
+	}
+	for i := 1; i < len(result.Lines); i++ {
+		if sameMove(result.Lines[i].Move, result.Lines[i-1].Move) {
+			t.Errorf("Line %d repeats the move %s", i+1, result.Lines[i].Move.ToString())
+		}
+		if result.Lines[i].Score > result.Lines[i-1].Score {
+			t.Errorf("Line %d scores %d, better than line %d at %d", i+1, result.Lines[i].Score, i, result.Lines[i-1].Score)
+		}
+	}
+}
+
+func TestStrength(t *testing.T) {
+	if SkillFromElo(MINELO) != 0 || SkillFromElo(MAXELO) != MAXSKILL || SkillFromElo(100) != 0 || SkillFromElo(3000) != MAXSKILL {
+		t.Error("Expected ratings to map onto skill levels 0 to MAXSKILL")
+	}
+	// the white queen can take an undefended rook, knight or pawn
+	board, err := engine.FromFen("k7/8/8/1r1q1n2/8/3Q4/8/K6p w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := Search(context.Background(), board, Options{Depth: 2})
+	moves := make(map[string]bool)
+	for seed := int64(0); seed < 10; seed++ {
+		strength := &Strength{Skill: 0, Rand: rand.New(rand.NewSource(seed))}
+		result := Search(context.Background(), board, Options{Depth: 4, Strength: strength})
+		if result.Depth > 1 {
+			t.Errorf("Expected skill 0 to search to depth 1, searched to %d", result.Depth)
+		}
+		if len(result.Lines) != 4 {
+			t.Errorf("Expected a weakened search to choose among 4 lines, got %d", len(result.Lines))
+		}
+		moves[result.Move.ToString()] = true
+	}
+	if len(moves) < 2 {
+		t.Errorf("Expected skill 0 to vary its moves, always played %s", full.Move.ToString())
+	}
+	// MAXSKILL searches exactly as no Strength does, with neither limits nor extra lines
+	strong := Search(context.Background(), board, Options{Depth: 2, Strength: &Strength{Skill: MAXSKILL, Rand: rand.New(rand.NewSource(1))}})
+	if !sameMove(strong.Move, full.Move) || strong.Nodes != full.Nodes || len(strong.Lines) != 1 {
+		t.Errorf("Expected full skill to play the best move %s in %d nodes with one line, played %s in %d nodes with %d",
+			full.Move.ToString(), full.Nodes, strong.Move.ToString(), strong.Nodes, len(strong.Lines))
+	}
+	m := &MCTS{}
+	fullplayouts := m.Search(context.Background(), board, Options{Nodes: 2000})
+	m = &MCTS{}
+	strongplayouts := m.Search(context.Background(), board, Options{Nodes: 2000, Strength: &Strength{Skill: MAXSKILL}})
+	if !sameMove(strongplayouts.Move, fullplayouts.Move) || strongplayouts.Nodes != fullplayouts.Nodes {
+		t.Errorf("Expected full skill to play %s in %d playouts, played %s in %d",
+			fullplayouts.Move.ToString(), fullplayouts.Nodes, strongplayouts.Move.ToString(), strongplayouts.Nodes)
+	}
+}
+
+func TestContempt(t *testing.T) {
+	// white is a rook for a pawn down, and Kg1 repeats an earlier position
+	board, err := engine.FromFen("k7/8/8/8/8/7P/r7/5K2 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repeat *engine.Move
+	for _, m := range board.AllLegalMoves() {
+		if m.End.X == 7 {
+			repeat = m
+		}
+	}
+	board.ForceMove(repeat)
+	history := []uint64{board.Hash(), 0, 0}
+	board.UndoMove(repeat)
+
+	result := Search(context.Background(), board, Options{Depth: 2, History: history, HalfmoveClock: 3})
+	if !sameMove(result.Move, repeat) || result.Score != DRAW {
+		t.Errorf("Expected the losing side to repeat for a draw, got %s scoring %d", result.Move.ToString(), result.Score)
+	}
+	result = Search(context.Background(), board, Options{Depth: 2, History: history, HalfmoveClock: 3, Contempt: 1000})
+	if sameMove(result.Move, repeat) {
+		t.Errorf("Expected a contempt of 1000 to avoid the draw, got %s scoring %d", result.Move.ToString(), result.Score)
+	}
+	result = Search(context.Background(), board, Options{Depth: 2, History: history, HalfmoveClock: 0})
+	if result.Score == DRAW {
+		t.Error("Expected no repetition across a capture or pawn move")
+	}
+}
+
+func TestFiftyMoves(t *testing.T) {
+	board, err := engine.FromFen("k7/8/8/8/8/8/r7/5K2 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := Search(context.Background(), board, Options{Depth: 2, HalfmoveClock: FIFTYMOVES - 1})
+	if result.Score != DRAW {
+		t.Errorf("Expected the fifty move rule to draw, got %d", result.Score)
+	}
+}
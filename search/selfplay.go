@@ -0,0 +1,122 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// A position from a self-play game, for training an evaluation offline.
+type TrainingPosition struct {
+	FEN    string
+	Score  int     // white-relative score the search found for the position
+	Result float64 // 1 if white won the game, 0.5 for a draw and 0 if black won
+}
+
+// How to play games against itself.
+type SelfPlayOptions struct {
+	Depth       int        // depth searched for every move, 1 if not set
+	RandomPlies int        // half-moves played at random at the start, so that games differ. They are not recorded.
+	MaxPlies    int        // half-moves after which the game is called a draw, 400 if not set
+	Evaluator   Evaluator  // Classical if nil
+	Searcher    Searcher   // plays both sides, AlphaBetaSearcher if nil
+	Rand        *rand.Rand // chooses the random moves, seeded with 1 if nil
+	Contempt    [2]int     // white's and black's contempt, see Options.Contempt
+}
+
+// Plays a game from the starting position against itself and returns the positions played, labelled with the
+// score of the search and the result of the game.
+// Only quiet positions are kept: not in check, not followed by a capture or promotion and not scored as a mate,
+// since a static evaluation cannot be expected to predict those.
+// Returns ctx's error if it is cancelled before the game ends.
+func SelfPlay(ctx context.Context, opts SelfPlayOptions) ([]TrainingPosition, error) {
+	if opts.Depth < 1 {
+		opts.Depth = 1
+	}
+	if opts.MaxPlies < 1 {
+		opts.MaxPlies = 400
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewSource(1))
+	}
+	if opts.Searcher == nil {
+		opts.Searcher = AlphaBetaSearcher{}
+	}
+	b := &engine.Board{Turn: 1}
+	b.SetUpPieces()
+	// a table for each side, as the sides may score draws differently
+	tables := [2]*TranspositionTable{NewTranspositionTable(1), NewTranspositionTable(1)}
+	// positions since the last capture or pawn move, including the current one
+	history := []uint64{b.Hash()}
+	positions := make([]TrainingPosition, 0)
+	result := 0.5
+	for ply := 0; ply < opts.MaxPlies; ply++ {
+		if over := b.IsOver(); over != 0 {
+			if over == 2 {
+				result = 1
+			} else if over == -2 {
+				result = 0
+			}
+			break
+		}
+		if b.InsufficientMaterial() || len(history) > FIFTYMOVES || repetitions(history) >= 3 {
+			break
+		}
+		var move *engine.Move
+		if ply < opts.RandomPlies {
+			movelist := b.AllLegalMoves()
+			move = movelist[opts.Rand.Intn(len(movelist))]
+		} else {
+			found := opts.Searcher.Search(ctx, b, Options{
+				Depth:         opts.Depth,
+				Table:         tables[colorSide(b.Turn)],
+				Evaluator:     opts.Evaluator,
+				Contempt:      opts.Contempt[colorSide(b.Turn)],
+				History:       history[:len(history)-1],
+				HalfmoveClock: len(history) - 1,
+			})
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			move = found.Move
+			if found.Mate == 0 && move.Capture == 0 && move.Promotion == 0 && !b.IsCheck(b.Turn) {
+				positions = append(positions, TrainingPosition{FEN: b.ToFen(), Score: found.Score})
+			}
+		}
+		b.ForceMove(move)
+		if move.Piece == 'p' || move.Capture != 0 {
+			history = history[:0]
+		}
+		history = append(history, b.Hash())
+	}
+	for i := range positions {
+		positions[i].Result = result
+	}
+	return positions, nil
+}
+
+// Returns how many times the last position occurs in history.
+func repetitions(history []uint64) int {
+	count := 0
+	for _, key := range history {
+		if key == history[len(history)-1] {
+			count++
+		}
+	}
+	return count
+}
+
+// Writes positions one to a line, as the FEN, the score and the result separated by bars:
+//
+//	rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b | -35 | 0.5
+func WriteTrainingPositions(w io.Writer, positions []TrainingPosition) error {
+	for _, p := range positions {
+		if _, err := fmt.Fprintf(w, "%s | %d | %.1f\n", p.FEN, p.Score, p.Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
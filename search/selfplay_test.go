@@ -0,0 +1,68 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestSelfPlay(t *testing.T) {
+	positions, err := SelfPlay(context.Background(), SelfPlayOptions{Depth: 1, RandomPlies: 2, MaxPlies: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) == 0 || len(positions) > 4 {
+		t.Fatalf("Expected up to four positions after two random moves, got %d", len(positions))
+	}
+	for _, p := range positions {
+		if p.Result != 0.5 {
+			t.Errorf("Expected a game cut short to count as a draw, got %v", p.Result)
+		}
+		if _, err := engine.FromFen(p.FEN); err != nil {
+			t.Error(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := WriteTrainingPositions(&buf, positions); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(positions) || !strings.HasSuffix(lines[0], " | 0.5") {
+		t.Errorf("Expected a line for each position, got %q", buf.String())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := SelfPlay(ctx, SelfPlayOptions{}); err == nil {
+		t.Error("Expected a cancelled game to return an error")
+	}
+}
+
+// A Searcher that keeps the white-relative score of a draw each side searched with.
+type drawScoreSearcher struct {
+	draws map[int]map[int]bool
+}
+
+func (s drawScoreSearcher) Search(ctx context.Context, b *engine.Board, opts Options) Result {
+	s.draws[b.Turn][drawScore(opts.Contempt, b.Turn)] = true
+	return Search(ctx, b, opts)
+}
+
+func TestSelfPlayContempt(t *testing.T) {
+	searcher := drawScoreSearcher{map[int]map[int]bool{1: {}, -1: {}}}
+	if _, err := SelfPlay(context.Background(), SelfPlayOptions{MaxPlies: 4, Searcher: searcher, Contempt: [2]int{50, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(searcher.draws[1]) != 1 || !searcher.draws[1][DRAW-50] || len(searcher.draws[-1]) != 1 || !searcher.draws[-1][DRAW] {
+		t.Errorf("Expected white to count a draw 50 below equal and black to count it equal, got %v and %v",
+			searcher.draws[1], searcher.draws[-1])
+	}
+}
+
+func TestRepetitions(t *testing.T) {
+	if n := repetitions([]uint64{1, 2, 1, 3, 1}); n != 3 {
+		t.Errorf("Expected 3 repetitions, got %d", n)
+	}
+}
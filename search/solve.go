@@ -0,0 +1,178 @@
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// A mate solver for problems of the kind "white to play and mate in N": a search that only asks whether the side
+// to move can force mate within a number of its own moves, trying every move of the attacker and every defence,
+// and that finds every key move rather than just one, so that problems can be checked for cooks.
+// The attacker's last move must give check, so only checks are tried for it; with ChecksOnly every attacker move
+// must. Draws by repetition and the fifty move rule are ignored, since they cannot come about in a short mate.
+// Reference: https://www.chessprogramming.org/Mate_Search
+const (
+	MAXMATEMOVES = 10 // longest mate, in moves of the attacker, SolveMate looks for
+)
+
+// Settings for SolveMate.
+type MateOptions struct {
+	ChecksOnly bool // the attacker only plays checks, as in checking problems or to prove a mate quickly
+}
+
+// The outcome of SolveMate.
+type MateSolution struct {
+	Keys     []*engine.Move // every first move that mates in at most the moves asked for, in no particular order
+	Shortest int            // the fewest moves mate can be forced in, or 0 if it cannot within the moves asked for
+	Nodes    uint64         // positions searched
+}
+
+// Returns whether the problem has more than one key move, which composers call a cook.
+func (s MateSolution) Cooked() bool {
+	return len(s.Keys) > 1
+}
+
+// The state of a call to SolveMate.
+type mateSolver struct {
+	ctx   context.Context
+	board *engine.Board
+	opts  MateOptions
+	nodes uint64
+	err   error
+
+	// for each position, the fewest attacker moves mate is known to be forced in, and the most it is known not to be
+	proven, disproven map[uint64]int
+}
+
+// Finds whether the side to move can force mate in at most n moves, and with which first moves.
+// Returns an error if n is not from 1 to MAXMATEMOVES, and ctx's error, along with what was found so far, if it is
+// cancelled first.
+func SolveMate(ctx context.Context, b *engine.Board, n int, opts MateOptions) (MateSolution, error) {
+	if n < 1 || n > MAXMATEMOVES {
+		return MateSolution{}, fmt.Errorf("func SolveMate: cannot look for a mate in %d, only in 1 to %d", n, MAXMATEMOVES)
+	}
+	s := &mateSolver{ctx: ctx, board: b.Copy(), opts: opts, proven: make(map[uint64]int), disproven: make(map[uint64]int)}
+	var solution MateSolution
+	for i := 1; i <= n && s.err == nil; i++ {
+		if s.attack(i) {
+			solution.Shortest = i
+			break
+		}
+	}
+	if solution.Shortest != 0 {
+		for _, move := range s.attackerMoves(n) {
+			s.board.ForceMove(move)
+			mates := s.defend(n - 1)
+			s.board.UndoMove(move)
+			if mates {
+				solution.Keys = append(solution.Keys, move)
+			}
+		}
+	}
+	solution.Nodes = s.nodes
+	return solution, s.err
+}
+
+// Counts a node and every POLLINTERVAL nodes checks whether the solver has been cancelled.
+// Returns false once it has.
+func (s *mateSolver) poll() bool {
+	s.nodes++
+	if s.err == nil && s.nodes%POLLINTERVAL == 0 {
+		s.err = s.ctx.Err()
+	}
+	return s.err == nil
+}
+
+// Returns whether the side to move can force mate in at most n of its moves.
+func (s *mateSolver) attack(n int) bool {
+	if n == 0 || !s.poll() {
+		return false
+	}
+	hash := s.board.Hash()
+	if proven, ok := s.proven[hash]; ok && proven <= n {
+		return true
+	}
+	if disproven, ok := s.disproven[hash]; ok && disproven >= n {
+		return false
+	}
+	for _, move := range s.attackerMoves(n) {
+		s.board.ForceMove(move)
+		mates := s.defend(n - 1)
+		s.board.UndoMove(move)
+		if mates {
+			s.proven[hash] = n
+			return true
+		}
+		if s.err != nil {
+			return false
+		}
+	}
+	s.disproven[hash] = n
+	return false
+}
+
+// Returns whether the side to move is checkmated, or every one of its moves lets the attacker mate in at most n
+// more moves.
+func (s *mateSolver) defend(n int) bool {
+	if !s.poll() {
+		return false
+	}
+	b := s.board
+	movelist := b.AllLegalMoves()
+	if len(movelist) == 0 {
+		return b.IsCheck(b.Turn)
+	}
+	if n == 0 {
+		return false
+	}
+	hash := b.Hash()
+	if proven, ok := s.proven[hash]; ok && proven <= n {
+		return true
+	}
+	if disproven, ok := s.disproven[hash]; ok && disproven >= n {
+		return false
+	}
+	// captures are the likeliest defences
+	for _, captures := range []bool{true, false} {
+		for _, move := range movelist {
+			if (move.Capture != 0) != captures {
+				continue
+			}
+			b.ForceMove(move)
+			mates := s.attack(n)
+			b.UndoMove(move)
+			if !mates {
+				if s.err == nil {
+					s.disproven[hash] = n
+				}
+				return false
+			}
+		}
+	}
+	s.proven[hash] = n
+	return true
+}
+
+// Returns the moves the attacker tries with n moves left: checks first, then captures, then the rest; only checks
+// for its last move or with ChecksOnly.
+func (s *mateSolver) attackerMoves(n int) []*engine.Move {
+	b := s.board
+	var checks, captures, rest []*engine.Move
+	for _, move := range b.AllLegalMoves() {
+		b.ForceMove(move)
+		check := b.IsCheck(b.Turn)
+		b.UndoMove(move)
+		switch {
+		case check:
+			checks = append(checks, move)
+		case n == 1 || s.opts.ChecksOnly:
+		case move.Capture != 0:
+			captures = append(captures, move)
+		default:
+			rest = append(rest, move)
+		}
+	}
+	return append(append(checks, captures...), rest...)
+}
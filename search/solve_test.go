@@ -0,0 +1,63 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestSolveMate(t *testing.T) {
+	tests := []struct {
+		fen        string
+		n          int
+		checksonly bool
+		shortest   int
+		keys       string
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w", 1, false, 1, "ra1-a8"},
+		{"6k1/5ppp/8/8/8/8/8/RR4K1 w", 1, false, 1, "ra1-a8 rb1-b8"}, // cooked
+		{"r5k1/5ppp/8/8/8/8/5PPP/6K1 b", 2, false, 1, "ra8-a1"},
+		{"7k/8/5K2/8/8/8/8/6R1 w", 2, false, 2, "kf6-f7"},
+		{"7k/8/5K2/8/8/8/8/6R1 w", 2, true, 0, ""}, // the key is quiet
+		{"7k/8/5K2/8/8/8/8/6R1 w", 1, false, 0, ""},
+	}
+	for _, test := range tests {
+		board, _ := engine.FromFen(test.fen)
+		solution, err := SolveMate(context.Background(), board, test.n, MateOptions{ChecksOnly: test.checksonly})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, len(solution.Keys))
+		for i, key := range solution.Keys {
+			keys[i] = key.ToString()
+		}
+		sort.Strings(keys)
+		if strings.Join(keys, " ") != test.keys || solution.Shortest != test.shortest || solution.Cooked() != (len(keys) > 1) {
+			t.Errorf("Expected keys %q in %d for mate in %d in %s, got %q in %d",
+				test.keys, test.shortest, test.n, test.fen, keys, solution.Shortest)
+		}
+	}
+}
+
+func TestSolveMateLimit(t *testing.T) {
+	board, _ := engine.FromFen("6k1/5ppp/8/8/8/8/8/R5K1 w")
+	for _, n := range []int{0, MAXMATEMOVES + 1} {
+		if solution, err := SolveMate(context.Background(), board, n, MateOptions{}); err == nil || solution.Nodes != 0 {
+			t.Errorf("Expected an error for a mate in %d, got %v after %d nodes", n, err, solution.Nodes)
+		}
+	}
+}
+
+func TestSolveMateCancel(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	solution, err := SolveMate(ctx, board, 5, MateOptions{})
+	if err != context.Canceled || solution.Shortest != 0 || solution.Nodes > POLLINTERVAL {
+		t.Errorf("Expected the solver to stop at once, got %v after %d nodes", err, solution.Nodes)
+	}
+}
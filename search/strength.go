@@ -0,0 +1,111 @@
+package search
+
+import (
+	"math"
+	"math/rand"
+)
+
+const (
+	MAXSKILL = 20 // full strength
+
+	MINELO = 800  // approximate rating of skill 0
+	MAXELO = 2400 // approximate rating of MAXSKILL
+)
+
+// A playing strength weaker than the engine's best, for players who would otherwise never win.
+// Weaker levels search less deeply and with fewer nodes, and choose among the best few root moves at random,
+// weighted towards the better ones. Now and then they make an outright mistake.
+type Strength struct {
+	Skill int        // 0 to MAXSKILL
+	Elo   int        // approximate rating to play at; used instead of Skill if set
+	Rand  *rand.Rand // source of randomness for choosing moves; the math/rand default source if nil
+}
+
+// Returns the skill level that plays at about the given rating.
+func SkillFromElo(elo int) int {
+	skill := (elo - MINELO) * MAXSKILL / (MAXELO - MINELO)
+	if skill < 0 {
+		return 0
+	}
+	if skill > MAXSKILL {
+		return MAXSKILL
+	}
+	return skill
+}
+
+// Returns the skill level in use, from 0 to MAXSKILL.
+func (s *Strength) level() int {
+	if s.Elo != 0 {
+		return SkillFromElo(s.Elo)
+	}
+	if s.Skill < 0 {
+		return 0
+	}
+	if s.Skill > MAXSKILL {
+		return MAXSKILL
+	}
+	return s.Skill
+}
+
+// Reports whether s plays any weaker than full strength. A nil Strength and one at MAXSKILL both search without
+// limits and play the best move.
+func (s *Strength) weakens() bool {
+	return s != nil && s.level() < MAXSKILL
+}
+
+// Returns the deepest the search may go, from 1 at skill 0 to 5 a level below full strength.
+func (s *Strength) depth() int {
+	return 1 + s.level()/4
+}
+
+// Returns how many nodes the search may look at, doubling every two levels.
+func (s *Strength) nodes() uint64 {
+	return 50 << uint(s.level()/2)
+}
+
+func (s *Strength) intn(n int) int {
+	if s.Rand != nil {
+		return s.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// Chooses the move to play from the best lines of a search.
+// Every line gets a random bonus, larger when the lines are far apart and the level is low, and a penalty for
+// how much worse than the best line it is; the line with the highest total is played.
+// On top of that a weak level occasionally blunders and plays any line but the best. MAXSKILL always plays the best.
+// Scores are counted from the point of view of the side to move, given by turn.
+// Reference: Stockfish's Skill::pick_best
+func (s *Strength) pick(lines []Line, turn int) Line {
+	level := s.level()
+	if len(lines) < 2 || level == MAXSKILL {
+		return lines[0]
+	}
+	if s.intn(MAXSKILL*4) < MAXSKILL-level {
+		return lines[1+s.intn(len(lines)-1)]
+	}
+	// scores for the side to move, with mates kept within range
+	score := func(line Line) int {
+		s := line.Score * turn
+		if s > 1000 {
+			return 1000
+		} else if s < -1000 {
+			return -1000
+		}
+		return s
+	}
+	top := score(lines[0])
+	weakness := 120 - 2*level
+	delta := top - score(lines[len(lines)-1])
+	if delta > 100 {
+		delta = 100
+	}
+	best, bestvalue := lines[0], math.MinInt32
+	for _, line := range lines {
+		push := (weakness*(top-score(line)) + delta*s.intn(weakness)) / 128
+		if value := score(line) + push; value > bestvalue {
+			best, bestvalue = line, value
+		}
+	}
+	return best
+}
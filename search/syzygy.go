@@ -0,0 +1,978 @@
+package search
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Syzygy tablebases come in two files for each set of material, such as KRvK: KRvK.rtbw holds the result of every
+// position (win, draw or loss, with the fifty move rule in mind) and KRvK.rtbz the distance to zeroing, the number
+// of half-moves until the next capture or pawn move with best play. The files index positions by the squares of
+// their pieces, mirrored and permuted into a canonical order, and compress the results in blocks of Huffman coded
+// symbols, each of which expands into a pair of symbols until the values are reached ("recursive pairing").
+// This follows the reference prober by Ronald de Man and the port of it in Stockfish's tbprobe.cpp.
+// Reference: https://github.com/syzygy1/tb
+const (
+	SYZYGYMAXPIECES = 7 // the most pieces in any Syzygy tablebase
+)
+
+var (
+	syzygyWDLMagic = []byte{0x71, 0xE8, 0x23, 0x5D}
+	syzygyDTZMagic = []byte{0xD7, 0x66, 0x0C, 0xA5}
+)
+
+// Flags of each table in a file.
+const (
+	tbFlagSTM         = 1   // the side to move of a DTZ table, which only holds positions with one side to move
+	tbFlagMapped      = 2   // DTZ values are looked up in a map
+	tbFlagWinPlies    = 4   // winning DTZ values are in half-moves rather than moves
+	tbFlagLossPlies   = 8   // losing DTZ values are in half-moves rather than moves
+	tbFlagWide        = 16  // the DTZ map holds 16 bit values
+	tbFlagSingleValue = 128 // every position has the same value
+)
+
+// How a probe went.
+const (
+	probeOK        = iota
+	probeFail      // the position is not in the tablebases
+	probeChangeSTM // the DTZ table holds the position with the other side to move
+	probeZeroing   // the best move is a capture or a pawn move, for which DTZ tables hold no value
+)
+
+// Index tables, with squares numbered a1 = 0, b1 = 1, ..., h8 = 63.
+var (
+	tbMapPawns      [64]int     // the pawn squares a2-h7 from 47 down to 0, edge files and low ranks first
+	tbMapB1H1H7     [64]int     // the squares below the a1-h8 diagonal, from 0 to 27
+	tbMapA1D1D4     [64]int     // the squares of the a1-d1-d4 triangle, from 0 to 9 with the diagonal last
+	tbMapKK         [10][64]int // the 462 placements of two kings with the first in the a1-d1-d4 triangle
+	tbBinomial      [7][64]uint64
+	tbLeadPawnIdx   [6][64]uint64 // index of the leading pawn for each number of leading pawns
+	tbLeadPawnsSize [6][4]uint64  // the number of placements of the leading pawns, on each of the files a-d
+)
+
+// Returns how far above the a1-h8 diagonal a square is, negative below it.
+func offA1H8(s int) int {
+	return s/8 - s%8
+}
+
+func init() {
+	code := 0
+	for s := 0; s < 64; s++ {
+		if offA1H8(s) < 0 {
+			tbMapB1H1H7[s] = code
+			code++
+		}
+	}
+	code = 0
+	var diagonal []int
+	for s := 0; s < 28; s++ {
+		if offA1H8(s) < 0 && s%8 <= 3 {
+			tbMapA1D1D4[s] = code
+			code++
+		} else if offA1H8(s) == 0 && s%8 <= 3 {
+			diagonal = append(diagonal, s)
+		}
+	}
+	for _, s := range diagonal {
+		tbMapA1D1D4[s] = code
+		code++
+	}
+	// with the first king on the diagonal the second is not above it, and both on the diagonal come last
+	code = 0
+	var bothdiagonal [][2]int
+	for idx := 0; idx < 10; idx++ {
+		for s1 := 0; s1 < 28; s1++ {
+			if tbMapA1D1D4[s1] != idx || (idx == 0 && s1 != 1) {
+				continue
+			}
+			for s2 := 0; s2 < 64; s2++ {
+				switch {
+				case squareDistance(s1, s2) <= 1:
+				case offA1H8(s1) == 0 && offA1H8(s2) > 0:
+				case offA1H8(s1) == 0 && offA1H8(s2) == 0:
+					bothdiagonal = append(bothdiagonal, [2]int{idx, s2})
+				default:
+					tbMapKK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothdiagonal {
+		tbMapKK[p[0]][p[1]] = code
+		code++
+	}
+	tbBinomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 7 && k <= n; k++ {
+			if k > 0 {
+				tbBinomial[k][n] += tbBinomial[k-1][n-1]
+			}
+			if k < n {
+				tbBinomial[k][n] += tbBinomial[k][n-1]
+			}
+		}
+	}
+	available := 47
+	for lead := 1; lead <= 5; lead++ {
+		for f := 0; f < 4; f++ {
+			idx := uint64(0)
+			for r := 1; r <= 6; r++ {
+				s := r*8 + f
+				if lead == 1 {
+					tbMapPawns[s] = available
+					tbMapPawns[s^7] = available - 1
+					available -= 2
+				}
+				tbLeadPawnIdx[lead][s] = idx
+				idx += tbBinomial[lead-1][tbMapPawns[s]]
+			}
+			tbLeadPawnsSize[lead][f] = idx
+		}
+	}
+}
+
+// How the values of one table in a file are encoded and compressed. Offsets are into the file.
+type tbPairs struct {
+	flags           int
+	blocksize       int    // bytes in a block of compressed data
+	span            uint64 // values between entries of the sparse index
+	blocks          int
+	maxsymlen       int // bits in the longest Huffman code
+	minsymlen       int // bits in the shortest Huffman code, or the value of a single valued table
+	lowestsym       int // offset of the lowest symbol of each code length
+	btree           int // offset of the pairs of symbols each symbol expands into, three bytes each
+	blocklength     int // offset of the number of values (minus one) in each block
+	blocklengthsize int
+	sparseindex     int // offset of the sparse index: the block and the offset in it of every span values
+	sparseindexsize int
+	data            int                  // offset of the compressed data
+	base64          []uint64             // the lowest code of each length, padded to 64 bits
+	symlen          []int                // the number of values (minus one) each symbol expands into
+	pieces          [SYZYGYMAXPIECES]int // the pieces in the order they are encoded
+	groupidx        [SYZYGYMAXPIECES + 1]uint64
+	grouplen        [SYZYGYMAXPIECES + 1]int // the pieces encoded together, ending with 0
+	mapidx          [4]int                   // where the DTZ map of each result starts
+}
+
+// A tablebase file, read the first time it is probed.
+type syzygyTable struct {
+	key, key2 string // the material with the side listed first as white, and as black
+	filename  string
+	dtz       bool
+	pieces    int
+	pawns     bool
+	unique    bool   // whether some side has exactly one of some piece other than the king
+	pawncount [2]int // pawns of the leading side, the one with fewer but some, and of the other side
+
+	once   sync.Once
+	err    error
+	data   []byte
+	items  [2][4]tbPairs // by side to move and file of the leading pawn
+	dtzmap int
+}
+
+// Makes a table from the material in its name, in the canonical order of materialKey.
+func newSyzygyTable(key, filename string, dtz bool) *syzygyTable {
+	sides := strings.Split(key, "v")
+	e := &syzygyTable{key: key, key2: sides[1] + "v" + sides[0], filename: filename, dtz: dtz, pieces: len(key) - 1}
+	e.pawns = strings.Contains(key, "P")
+	for _, side := range sides {
+		for _, name := range "QRBNP" {
+			if strings.Count(side, string(name)) == 1 {
+				e.unique = true
+			}
+		}
+	}
+	white, black := strings.Count(sides[0], "P"), strings.Count(sides[1], "P")
+	e.pawncount = [2]int{white, black}
+	if black > 0 && (white == 0 || black < white) {
+		e.pawncount = [2]int{black, white}
+	}
+	return e
+}
+
+// Returns the table of the side to move and the file of the leading pawn.
+func (e *syzygyTable) get(stm, file int) *tbPairs {
+	if e.dtz {
+		stm = 0
+	}
+	if !e.pawns {
+		file = 0
+	}
+	return &e.items[stm][file]
+}
+
+func (e *syzygyTable) u16(offset int) int {
+	return int(binary.LittleEndian.Uint16(e.data[offset:]))
+}
+
+// Reads the file and sets up its tables, once.
+func (e *syzygyTable) load() error {
+	e.once.Do(func() {
+		if e.err = e.read(); e.err != nil {
+			e.data = nil
+		}
+	})
+	return e.err
+}
+
+func (e *syzygyTable) read() (err error) {
+	if e.data, err = os.ReadFile(e.filename); err != nil {
+		return err
+	}
+	magic := syzygyWDLMagic
+	if e.dtz {
+		magic = syzygyDTZMagic
+	}
+	if len(e.data)%64 != 16 || string(e.data[:4]) != string(magic) {
+		return fmt.Errorf("%s: not a Syzygy tablebase", e.filename)
+	}
+	// an index out of range means the file is corrupt
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("%s: corrupt tablebase", e.filename)
+		}
+	}()
+	return e.setup()
+}
+
+// Reads the layout of the tables in the file.
+func (e *syzygyTable) setup() error {
+	data := e.data
+	if flags := data[4]; (flags&2 != 0) != e.pawns {
+		return fmt.Errorf("%s: pawns do not match the name", e.filename)
+	}
+	offset := 5
+	sides := 1
+	if !e.dtz && e.key != e.key2 {
+		sides = 2
+	}
+	maxfile := 0
+	if e.pawns {
+		maxfile = 3
+	}
+	bothpawns := e.pawns && e.pawncount[1] > 0
+	for f := 0; f <= maxfile; f++ {
+		order := [2][2]int{{int(data[offset] & 0xF), 0xF}, {int(data[offset] >> 4), 0xF}}
+		if bothpawns {
+			order[0][1], order[1][1] = int(data[offset+1]&0xF), int(data[offset+1]>>4)
+			offset++
+		}
+		offset++
+		for k := 0; k < e.pieces; k++ {
+			for i := 0; i < sides; i++ {
+				e.get(i, f).pieces[k] = int(data[offset]>>(4*i)) & 0xF
+			}
+			offset++
+		}
+		for i := 0; i < sides; i++ {
+			if err := e.setGroups(e.get(i, f), order[i], f); err != nil {
+				return err
+			}
+		}
+	}
+	offset += offset & 1
+	for f := 0; f <= maxfile; f++ {
+		for i := 0; i < sides; i++ {
+			offset = e.setSizes(e.get(i, f), offset)
+		}
+	}
+	if e.dtz {
+		offset = e.setDTZMap(offset, maxfile)
+	}
+	for f := 0; f <= maxfile; f++ {
+		for i := 0; i < sides; i++ {
+			d := e.get(i, f)
+			d.sparseindex = offset
+			offset += 6 * d.sparseindexsize
+		}
+	}
+	for f := 0; f <= maxfile; f++ {
+		for i := 0; i < sides; i++ {
+			d := e.get(i, f)
+			d.blocklength = offset
+			offset += 2 * d.blocklengthsize
+		}
+	}
+	for f := 0; f <= maxfile; f++ {
+		for i := 0; i < sides; i++ {
+			d := e.get(i, f)
+			offset = (offset + 0x3F) &^ 0x3F
+			d.data = offset
+			offset += d.blocks * d.blocksize
+		}
+	}
+	if offset > len(data) {
+		return fmt.Errorf("%s: truncated tablebase", e.filename)
+	}
+	return nil
+}
+
+// Splits the pieces into the groups they are encoded in, and works out the size of the index of each group.
+// The first group is the leading pawns, or two or three pieces whose placements are counted together; then come
+// the other side's pawns and then each kind of piece. The order says which groups vary fastest in the index.
+func (e *syzygyTable) setGroups(d *tbPairs, order [2]int, file int) error {
+	n := 0
+	first := 2
+	if e.pawns {
+		first = 0
+	} else if e.unique {
+		first = 3
+	}
+	d.grouplen[0] = 1
+	for i := 1; i < e.pieces; i++ {
+		first--
+		if first > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.grouplen[n]++
+		} else {
+			n++
+			d.grouplen[n] = 1
+		}
+	}
+	n++
+	d.grouplen[n] = 0
+	bothpawns := e.pawns && e.pawncount[1] > 0
+	next := 1
+	free := 64 - d.grouplen[0]
+	if bothpawns {
+		next = 2
+		free -= d.grouplen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch {
+		case k == order[0]:
+			d.groupidx[0] = idx
+			switch {
+			case e.pawns:
+				idx *= tbLeadPawnsSize[d.grouplen[0]][file]
+			case e.unique:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case k == order[1]:
+			d.groupidx[1] = idx
+			idx *= tbBinomial[d.grouplen[1]][48-d.grouplen[0]]
+		default:
+			d.groupidx[next] = idx
+			idx *= tbBinomial[d.grouplen[next]][free]
+			free -= d.grouplen[next]
+			next++
+		}
+		if k > 15 {
+			return fmt.Errorf("%s: bad group order", e.filename)
+		}
+	}
+	d.groupidx[n] = idx
+	return nil
+}
+
+// Reads the sizes of a table and its Huffman code, returning the offset after them.
+func (e *syzygyTable) setSizes(d *tbPairs, offset int) int {
+	data := e.data
+	d.flags = int(data[offset])
+	offset++
+	if d.flags&tbFlagSingleValue != 0 {
+		d.minsymlen = int(data[offset])
+		return offset + 1
+	}
+	n := 0
+	for d.grouplen[n] != 0 {
+		n++
+	}
+	size := d.groupidx[n]
+	d.blocksize = 1 << data[offset]
+	d.span = 1 << data[offset+1]
+	d.sparseindexsize = int((size + d.span - 1) / d.span)
+	padding := int(data[offset+2])
+	d.blocks = int(binary.LittleEndian.Uint32(data[offset+3:]))
+	d.blocklengthsize = d.blocks + padding
+	d.maxsymlen, d.minsymlen = int(data[offset+7]), int(data[offset+8])
+	offset += 9
+	d.lowestsym = offset
+	// longer codes have lower values, so base64 falls as the length grows
+	d.base64 = make([]uint64, d.maxsymlen-d.minsymlen+1)
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(e.u16(d.lowestsym+2*i)) - uint64(e.u16(d.lowestsym+2*i+2))) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= uint(64 - i - d.minsymlen)
+	}
+	offset += 2 * len(d.base64)
+	d.symlen = make([]int, e.u16(offset))
+	offset += 2
+	d.btree = offset
+	visited := make([]bool, len(d.symlen))
+	for sym := range d.symlen {
+		if !visited[sym] {
+			d.symlen[sym] = e.setSymlen(d, sym, visited)
+		}
+	}
+	return offset + 3*len(d.symlen) + len(d.symlen)&1
+}
+
+// Returns the symbols a symbol expands into. A symbol that stands for a value has 0xFFF on the right and the
+// value on the left.
+func (e *syzygyTable) pair(d *tbPairs, sym int) (left, right int) {
+	lr := e.data[d.btree+3*sym:]
+	return int(lr[1]&0xF)<<8 | int(lr[0]), int(lr[2])<<4 | int(lr[1]>>4)
+}
+
+// Returns the number of values, minus one, a symbol expands into.
+func (e *syzygyTable) setSymlen(d *tbPairs, sym int, visited []bool) int {
+	visited[sym] = true
+	left, right := e.pair(d, sym)
+	if right == 0xFFF {
+		return 0
+	}
+	if !visited[left] {
+		d.symlen[left] = e.setSymlen(d, left, visited)
+	}
+	if !visited[right] {
+		d.symlen[right] = e.setSymlen(d, right, visited)
+	}
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+// Reads where the DTZ map of each result starts, returning the offset after the maps.
+func (e *syzygyTable) setDTZMap(offset, maxfile int) int {
+	e.dtzmap = offset
+	for f := 0; f <= maxfile; f++ {
+		d := e.get(0, f)
+		if d.flags&tbFlagMapped == 0 {
+			continue
+		}
+		if d.flags&tbFlagWide != 0 {
+			offset += offset & 1
+			for i := range d.mapidx {
+				d.mapidx[i] = (offset-e.dtzmap)/2 + 1
+				offset += 2*e.u16(offset) + 2
+			}
+		} else {
+			for i := range d.mapidx {
+				d.mapidx[i] = offset - e.dtzmap + 1
+				offset += int(e.data[offset]) + 1
+			}
+		}
+	}
+	return offset + offset&1
+}
+
+// Returns the value at an index of a table.
+func (e *syzygyTable) decompress(d *tbPairs, idx uint64) int {
+	if d.flags&tbFlagSingleValue != 0 {
+		return d.minsymlen
+	}
+	// the sparse index tells the block of the value in the middle of every span, and how far into it it is
+	entry := d.sparseindex + 6*int(idx/d.span)
+	block := int(binary.LittleEndian.Uint32(e.data[entry:]))
+	offset := e.u16(entry+4) + int(idx%d.span) - int(d.span/2)
+	for offset < 0 {
+		block--
+		offset += e.u16(d.blocklength+2*block) + 1
+	}
+	for offset > e.u16(d.blocklength+2*block) {
+		offset -= e.u16(d.blocklength+2*block) + 1
+		block++
+	}
+	ptr := d.data + block*d.blocksize
+	buf := binary.BigEndian.Uint64(e.data[ptr:])
+	ptr += 8
+	bits := 64
+	var sym int
+	for {
+		length := 0
+		for buf < d.base64[length] {
+			length++
+		}
+		s := uint16((buf - d.base64[length]) >> uint(64-length-d.minsymlen))
+		s += uint16(e.u16(d.lowestsym + 2*length))
+		sym = int(s)
+		if offset < d.symlen[sym]+1 {
+			break
+		}
+		offset -= d.symlen[sym] + 1
+		length += d.minsymlen
+		buf <<= uint(length)
+		bits -= length
+		if bits <= 32 {
+			bits += 32
+			buf |= uint64(binary.BigEndian.Uint32(e.data[ptr:])) << uint(64-bits)
+			ptr += 4
+		}
+	}
+	// the symbol expands into symlen+1 values; find ours among the pairs it expands into
+	for d.symlen[sym] != 0 {
+		left, right := e.pair(d, sym)
+		if offset < d.symlen[left]+1 {
+			sym = left
+		} else {
+			offset -= d.symlen[left] + 1
+			sym = right
+		}
+	}
+	left, _ := e.pair(d, sym)
+	return left
+}
+
+// Converts a value from a table to a result, or a DTZ value to half-moves given the result.
+func (e *syzygyTable) mapScore(file, value, wdl int) int {
+	if !e.dtz {
+		return value - 2
+	}
+	d := e.get(0, file)
+	if d.flags&tbFlagMapped != 0 {
+		i := d.mapidx[[]int{1, 3, 0, 2, 0}[wdl+2]] + value
+		if d.flags&tbFlagWide != 0 {
+			value = e.u16(e.dtzmap + 2*i)
+		} else {
+			value = int(e.data[e.dtzmap+i])
+		}
+	}
+	if (wdl == TBWON && d.flags&tbFlagWinPlies == 0) || (wdl == TBLOSS && d.flags&tbFlagLossPlies == 0) ||
+		wdl == TBCURSEDWIN || wdl == TBBLESSEDLOSS {
+		value *= 2
+	}
+	return value + 1
+}
+
+// Looks up a position whose material is key.
+func (e *syzygyTable) probe(b *engine.Board, key string, wdl int, state *int) int {
+	d, file, idx, ok := e.index(b, key)
+	if !ok {
+		*state = probeChangeSTM
+		return 0
+	}
+	return e.mapScore(file, e.decompress(d, idx), wdl)
+}
+
+// Returns the table holding a position whose material is key, the file of its leading pawn and its index in the
+// table, or false if it is a DTZ table holding the other side to move. The table holds positions with the side
+// listed first in its name as white, so with the colors the other way round the board is looked at upside down
+// with the colors swapped. Symmetric tables only hold white to move, so they are looked at the same way with black
+// to move.
+func (e *syzygyTable) index(b *engine.Board, key string) (d *tbPairs, file int, idx uint64, ok bool) {
+	type tbPiece struct{ square, code int }
+	all := make([]tbPiece, 0, SYZYGYMAXPIECES)
+	for _, p := range b.Board {
+		if !p.Captured {
+			all = append(all, tbPiece{(p.Position.Y-1)*8 + p.Position.X - 1, syzygyPieceCode(p)})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].square < all[j].square })
+	flip := key != e.key || (e.key == e.key2 && b.Turn == -1)
+	flipcolor, flipsquares, stm := 0, 0, 0
+	if b.Turn == -1 {
+		stm = 1
+	}
+	if flip {
+		flipcolor, flipsquares, stm = 8, 56, 1-stm
+	}
+	var squares, pieces [SYZYGYMAXPIECES]int
+	size, leadpawns := 0, 0
+	leadcode := -1
+	// the leading pawns are the pawns of the side the table lists first, led by the one nearest the edge and
+	// then lowest; the table is split by the file of that pawn
+	if e.pawns {
+		leadcode = e.get(0, 0).pieces[0] ^ flipcolor
+		for _, p := range all {
+			if p.code == leadcode {
+				squares[size] = p.square ^ flipsquares
+				size++
+			}
+		}
+		leadpawns = size
+		lead := 0
+		for i := 1; i < leadpawns; i++ {
+			if tbMapPawns[squares[i]] > tbMapPawns[squares[lead]] {
+				lead = i
+			}
+		}
+		squares[0], squares[lead] = squares[lead], squares[0]
+		file = squares[0] % 8
+		if file > 3 {
+			file = 7 - file
+		}
+	}
+	if e.dtz && e.get(stm, file).flags&tbFlagSTM != stm && (e.key != e.key2 || e.pawns) {
+		return nil, file, 0, false
+	}
+	for _, p := range all {
+		if p.code != leadcode {
+			squares[size], pieces[size] = p.square^flipsquares, p.code^flipcolor
+			size++
+		}
+	}
+	d = e.get(stm, file)
+	// put the pieces in the order of the table
+	for i := leadpawns; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+	// mirror the leading piece onto files a-d
+	if squares[0]%8 > 3 {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+	if e.pawns {
+		idx = tbLeadPawnIdx[leadpawns][squares[0]]
+		rest := squares[1:leadpawns]
+		sort.SliceStable(rest, func(i, j int) bool { return tbMapPawns[rest[i]] < tbMapPawns[rest[j]] })
+		for i := 1; i < leadpawns; i++ {
+			idx += tbBinomial[i][tbMapPawns[squares[i]]]
+		}
+	} else {
+		// without pawns, mirror it onto ranks 1-4 too, and the first of the leading group off the diagonal
+		// below the diagonal
+		if squares[0]/8 > 3 {
+			for i := 0; i < size; i++ {
+				squares[i] ^= 56
+			}
+		}
+		for i := 0; i < d.grouplen[0]; i++ {
+			if offA1H8(squares[i]) == 0 {
+				continue
+			}
+			if offA1H8(squares[i]) > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = (squares[j]>>3 | squares[j]<<3) & 63
+				}
+			}
+			break
+		}
+		if e.unique {
+			idx = tbUniqueIndex(squares[0], squares[1], squares[2])
+		} else {
+			idx = uint64(tbMapKK[tbMapA1D1D4[squares[0]]][squares[1]])
+		}
+	}
+	idx *= d.groupidx[0]
+	// each further group counts the placements of its pieces on the squares the earlier groups left free
+	start := d.grouplen[0]
+	otherpawns := e.pawns && e.pawncount[1] > 0
+	for next := 1; d.grouplen[next] != 0; next++ {
+		group := squares[start : start+d.grouplen[next]]
+		sort.Ints(group)
+		n := uint64(0)
+		for i, s := range group {
+			adjust := 0
+			for _, earlier := range squares[:start] {
+				if s > earlier {
+					adjust++
+				}
+			}
+			if otherpawns {
+				adjust += 8
+			}
+			n += tbBinomial[i+1][s-adjust]
+		}
+		otherpawns = false
+		idx += n * d.groupidx[next]
+		start += len(group)
+	}
+	return d, file, idx, true
+}
+
+// Returns the index of three unique pieces without pawns, the first in the a1-d1-d4 triangle.
+func tbUniqueIndex(s0, s1, s2 int) uint64 {
+	adjust1 := 0
+	if s1 > s0 {
+		adjust1++
+	}
+	adjust2 := 0
+	if s2 > s0 {
+		adjust2++
+	}
+	if s2 > s1 {
+		adjust2++
+	}
+	switch {
+	case offA1H8(s0) != 0:
+		return uint64((tbMapA1D1D4[s0]*63+s1-adjust1)*62 + s2 - adjust2)
+	case offA1H8(s1) != 0:
+		return uint64((6*63+(s0/8)*28+tbMapB1H1H7[s1])*62 + s2 - adjust2)
+	case offA1H8(s2) != 0:
+		return uint64(6*63*62 + 4*28*62 + (s0/8)*7*28 + (s1/8-adjust1)*28 + tbMapB1H1H7[s2])
+	}
+	return uint64(6*63*62 + 4*28*62 + 4*7*28 + (s0/8)*7*6 + (s1/8-adjust1)*6 + s2/8 - adjust2)
+}
+
+// Returns the code of a piece in a tablebase file: pawn to king from 1 to 6 for white and from 9 to 14 for black.
+func syzygyPieceCode(p *engine.Piece) int {
+	code := strings.IndexByte("pnbrqk", p.Name) + 1
+	if p.Color == -1 {
+		code += 8
+	}
+	return code
+}
+
+// Returns the material on a board as tablebases are named, such as "KRvK": white's pieces, then black's, each
+// from the king down to the pawns.
+func materialKey(b *engine.Board) string {
+	var sides [2][]byte
+	for _, p := range b.Board {
+		if !p.Captured {
+			side := colorSide(p.Color)
+			sides[side] = append(sides[side], p.Name-'a'+'A')
+		}
+	}
+	return syzygyOrder(sides[0]) + "v" + syzygyOrder(sides[1])
+}
+
+// Sorts the letters of one side's pieces from the king down to the pawns.
+func syzygyOrder(side []byte) string {
+	const order = "KQRBNP"
+	sort.Slice(side, func(i, j int) bool { return strings.IndexByte(order, side[i]) < strings.IndexByte(order, side[j]) })
+	return string(side)
+}
+
+// Returns the material key of a tablebase file name such as "KRvK", or false if it is not one.
+func syzygyKey(name string) (string, bool) {
+	sides := strings.Split(name, "v")
+	if len(sides) != 2 || len(name)-1 > SYZYGYMAXPIECES {
+		return "", false
+	}
+	for i, side := range sides {
+		if strings.Count(side, "K") != 1 || strings.Trim(side, "KQRBNP") != "" {
+			return "", false
+		}
+		sides[i] = syzygyOrder([]byte(side))
+	}
+	return sides[0] + "v" + sides[1], true
+}
+
+// Syzygy tablebases, as found by LoadSyzygy. Files are read into memory the first time they are probed, which
+// for the larger tables takes a while and a lot of memory. Safe for concurrent use.
+type Syzygy struct {
+	wdl, dtz  map[string]*syzygyTable // by material key, with either side as white
+	maxpieces int
+}
+
+// Finds the Syzygy tablebase files (*.rtbw and *.rtbz) in a list of directories separated as in $PATH.
+// Where a table is in more than one directory, the first is used.
+func LoadSyzygy(path string) (*Syzygy, error) {
+	s := &Syzygy{wdl: make(map[string]*syzygyTable), dtz: make(map[string]*syzygyTable)}
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("func LoadSyzygy: %s", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			ext := filepath.Ext(name)
+			if ext != ".rtbw" && ext != ".rtbz" {
+				continue
+			}
+			key, ok := syzygyKey(strings.TrimSuffix(name, ext))
+			if !ok {
+				continue
+			}
+			tables := s.wdl
+			if ext == ".rtbz" {
+				tables = s.dtz
+			}
+			if _, found := tables[key]; found {
+				continue
+			}
+			table := newSyzygyTable(key, filepath.Join(dir, name), ext == ".rtbz")
+			tables[table.key], tables[table.key2] = table, table
+			if ext == ".rtbw" && table.pieces > s.maxpieces {
+				s.maxpieces = table.pieces
+			}
+		}
+	}
+	return s, nil
+}
+
+// Returns the most pieces of any position in the WDL tables found.
+func (s *Syzygy) MaxPieces() int {
+	return s.maxpieces
+}
+
+// Probes the WDL tables, see Tablebase.
+func (s *Syzygy) ProbeWDL(b *engine.Board) (wdl int, ok bool) {
+	if pieceCount(b) > s.maxpieces || castlingRights(b) {
+		return 0, false
+	}
+	defer recoverCorrupt(&ok)
+	state := probeOK
+	wdl = s.search(b.Copy(), false, &state)
+	return wdl, state != probeFail
+}
+
+// Probes the DTZ tables, see Tablebase.
+func (s *Syzygy) ProbeDTZ(b *engine.Board) (dtz int, ok bool) {
+	if pieceCount(b) > s.maxpieces || castlingRights(b) {
+		return 0, false
+	}
+	defer recoverCorrupt(&ok)
+	state := probeOK
+	dtz = s.probeDTZ(b.Copy(), &state)
+	return dtz, state != probeFail
+}
+
+// Turns an index out of range while probing a corrupt table into a failed probe.
+func recoverCorrupt(ok *bool) {
+	if r := recover(); r != nil {
+		if _, isruntime := r.(runtime.Error); !isruntime {
+			panic(r)
+		}
+		*ok = false
+	}
+}
+
+// Looks up a position in the WDL or DTZ table of its material.
+func (s *Syzygy) probeTable(b *engine.Board, dtz bool, wdl int, state *int) int {
+	if pieceCount(b) == 2 {
+		return TBDRAW
+	}
+	key := materialKey(b)
+	tables := s.wdl
+	if dtz {
+		tables = s.dtz
+	}
+	table := tables[key]
+	if table == nil || table.load() != nil {
+		*state = probeFail
+		return 0
+	}
+	return table.probe(b, key, wdl, state)
+}
+
+// Returns the result of a position. The tables do not know about en passant and may hold any value for a
+// position whose best move is a capture, so captures are searched first, and pawn moves too when zeroing is set,
+// as a DTZ probe needs to know whether the best move zeroes the fifty move counter.
+func (s *Syzygy) search(b *engine.Board, zeroing bool, state *int) int {
+	movelist := b.AllLegalMoves()
+	if len(movelist) == 0 {
+		if b.IsCheck(b.Turn) {
+			return TBLOSS
+		}
+		return TBDRAW
+	}
+	best, searched := TBLOSS, 0
+	for _, move := range movelist {
+		if move.Capture == 0 && (!zeroing || move.Piece != 'p') {
+			continue
+		}
+		searched++
+		b.ForceMove(move)
+		value := -s.search(b, false, state)
+		b.UndoMove(move)
+		if *state == probeFail {
+			return TBDRAW
+		}
+		if value > best {
+			best = value
+			if value >= TBWON {
+				*state = probeZeroing
+				return value
+			}
+		}
+	}
+	all := searched == len(movelist)
+	value := best
+	if !all {
+		if value = s.probeTable(b, false, 0, state); *state == probeFail {
+			return TBDRAW
+		}
+	}
+	if best >= value {
+		*state = probeOK
+		if best > TBDRAW || all {
+			*state = probeZeroing
+		}
+		return best
+	}
+	*state = probeOK
+	return value
+}
+
+// Returns the DTZ of a zeroing move from the result it leads to.
+func dtzBeforeZeroing(wdl int) int {
+	switch wdl {
+	case TBWON:
+		return 1
+	case TBCURSEDWIN:
+		return 101
+	case TBBLESSEDLOSS:
+		return -101
+	case TBLOSS:
+		return -1
+	}
+	return 0
+}
+
+// Returns the distance to zeroing of a position, see Tablebase.ProbeDTZ.
+func (s *Syzygy) probeDTZ(b *engine.Board, state *int) int {
+	*state = probeOK
+	movelist := b.AllLegalMoves()
+	if len(movelist) == 0 {
+		if b.IsCheck(b.Turn) {
+			return -1
+		}
+		return 0
+	}
+	wdl := s.search(b, true, state)
+	if *state == probeFail || wdl == TBDRAW {
+		return 0
+	}
+	if *state == probeZeroing {
+		return dtzBeforeZeroing(wdl)
+	}
+	dtz := s.probeTable(b, true, wdl, state)
+	if *state == probeFail {
+		return 0
+	}
+	if *state != probeChangeSTM {
+		if wdl == TBCURSEDWIN || wdl == TBBLESSEDLOSS {
+			dtz += 100
+		}
+		return dtz * sign(wdl)
+	}
+	// the table holds the other side to move, so look one move ahead for the best of the moves keeping the result
+	best := 0xFFFF
+	for _, move := range movelist {
+		zeroes := move.Capture != 0 || move.Piece == 'p'
+		b.ForceMove(move)
+		if zeroes {
+			dtz = -dtzBeforeZeroing(s.search(b, false, state))
+		} else {
+			dtz = -s.probeDTZ(b, state)
+			if dtz == 1 && b.IsCheck(b.Turn) && len(b.AllLegalMoves()) == 0 {
+				best = 1
+			}
+			dtz += sign(dtz)
+		}
+		if dtz < best && sign(dtz) == sign(wdl) {
+			best = dtz
+		}
+		b.UndoMove(move)
+		if *state == probeFail {
+			return 0
+		}
+	}
+	if best == 0xFFFF {
+		return -1
+	}
+	return best
+}
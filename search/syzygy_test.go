@@ -0,0 +1,725 @@
+package search
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestSyzygyIndexTables(t *testing.T) {
+	codes := make(map[int]bool)
+	for idx := range tbMapKK {
+		for s := range tbMapKK[idx] {
+			if code := tbMapKK[idx][s]; code != 0 || (idx == 0 && s == 0) {
+				codes[code] = true
+			}
+		}
+	}
+	if len(codes) != 462 {
+		t.Errorf("Expected 462 placements of two kings, got %d", len(codes))
+	}
+	// a2, h2, a3 and the last of the pawn squares, e7
+	if tbMapPawns[8] != 47 || tbMapPawns[15] != 46 || tbMapPawns[16] != 45 || tbMapPawns[52] != 0 {
+		t.Errorf("Unexpected pawn square codes %d %d %d %d", tbMapPawns[8], tbMapPawns[15], tbMapPawns[16], tbMapPawns[52])
+	}
+	if tbMapA1D1D4[1] != 0 || tbMapA1D1D4[0] != 6 || tbMapA1D1D4[27] != 9 || tbMapB1H1H7[55] != 27 {
+		t.Error("Unexpected triangle codes")
+	}
+	if tbBinomial[2][5] != 10 || tbBinomial[3][62] != 37820 {
+		t.Errorf("Unexpected binomial coefficients %d and %d", tbBinomial[2][5], tbBinomial[3][62])
+	}
+	if len(syzygyTriples) != 31332 {
+		t.Errorf("Expected 31332 placements of three unique pieces, got %d", len(syzygyTriples))
+	}
+	if total := tbLeadPawnsSize[1][0] + tbLeadPawnsSize[1][1] + tbLeadPawnsSize[1][2] + tbLeadPawnsSize[1][3]; total != 24 {
+		t.Errorf("Expected 24 squares for a single leading pawn, got %d", total)
+	}
+}
+
+func TestSyzygyKey(t *testing.T) {
+	tests := []struct {
+		name, key string
+		ok        bool
+	}{
+		{"KRvK", "KRvK", true},
+		{"KvKQ", "KvKQ", true},
+		{"KPRvKN", "KRPvKN", true},
+		{"KRRRvKBNP", "", false}, // eight pieces
+		{"KRvKvK", "", false},
+		{"RvK", "", false},
+		{"KXvK", "", false},
+	}
+	for _, test := range tests {
+		if key, ok := syzygyKey(test.name); key != test.key || ok != test.ok {
+			t.Errorf("Expected %s to give %q %v, got %q %v", test.name, test.key, test.ok, key, ok)
+		}
+	}
+	board, _ := engine.FromFen("8/8/3k4/3p4/8/8/8/4K1RN w")
+	if key := materialKey(board); key != "KRNvKP" {
+		t.Errorf("Expected KRNvKP, got %s", key)
+	}
+}
+
+// Writes a tablebase file for king and queen against king in which every position has the same value, header
+// first and padded to the size Syzygy files have. The values are the results for each side to move.
+func writeKQK(t *testing.T, filename string, magic []byte, values ...byte) {
+	data := append([]byte{}, magic...)
+	data = append(data, 1, 0, 0x66, 0x55, 0xEE, 0) // split, the order of the groups, white king, queen, black king
+	for _, value := range values {
+		data = append(data, tbFlagSingleValue, value)
+	}
+	data = append(data, make([]byte, 80-len(data))...)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSyzygy(t *testing.T) {
+	dir := t.TempDir()
+	writeKQK(t, filepath.Join(dir, "KQvK.rtbw"), syzygyWDLMagic, 4, 0) // won with white to move, lost with black to move
+	writeKQK(t, filepath.Join(dir, "KQvK.rtbz"), syzygyDTZMagic, 5)    // white to move, five moves from zeroing
+	// a file with the wrong magic, and one whose tables run past its end
+	os.WriteFile(filepath.Join(dir, "KRvK.rtbw"), make([]byte, 80), 0644)
+	os.WriteFile(filepath.Join(dir, "KBvK.rtbw"), append(append([]byte{}, syzygyWDLMagic...), make([]byte, 12)...), 0644)
+	os.WriteFile(filepath.Join(dir, "README"), nil, 0644)
+
+	tb, err := LoadSyzygy(dir + string(filepath.ListSeparator) + t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tb.MaxPieces() != 3 {
+		t.Errorf("Expected tables of up to 3 pieces, got %d", tb.MaxPieces())
+	}
+	tests := []struct {
+		fen      string
+		wdl, dtz int
+		ok       bool
+	}{
+		{"8/8/8/3k4/8/8/8/4K2Q w", TBWON, 11, true},
+		{"8/8/8/3k4/8/8/8/4K2Q b", TBLOSS, -12, true}, // the DTZ table only holds white to move
+		{"4k2q/8/8/8/3K4/8/8/8 b", TBWON, 11, true},   // the colors the other way round
+		{"8/8/8/8/8/8/5k2/4K1Q1 b", TBDRAW, 0, true},  // the queen is taken
+		{"8/8/8/3k4/8/8/8/4K2R w", 0, 0, false},
+		{"8/8/8/3k4/8/8/8/4K2B w", 0, 0, false},
+		{"8/8/8/3k4/8/8/8/4KN1Q w", 0, 0, false},
+	}
+	for _, test := range tests {
+		board, _ := engine.FromFen(test.fen)
+		if wdl, ok := tb.ProbeWDL(board); wdl != test.wdl || ok != test.ok {
+			t.Errorf("Expected WDL %d %v for %s, got %d %v", test.wdl, test.ok, test.fen, wdl, ok)
+		}
+		if dtz, ok := tb.ProbeDTZ(board); dtz != test.dtz || ok != test.ok {
+			t.Errorf("Expected DTZ %d %v for %s, got %d %v", test.dtz, test.ok, test.fen, dtz, ok)
+		}
+	}
+	castling, _ := engine.FromFen("8/8/8/3k4/8/8/8/R3K3 w Q")
+	nocastling, _ := engine.FromFen("8/8/8/3k4/8/8/8/R3K3 w -")
+	if !castlingRights(castling) || castlingRights(nocastling) {
+		t.Error("Expected only the position with castling rights to be left unprobed")
+	}
+	if _, err := LoadSyzygy(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+// Works out the distance to zeroing of every decisive position of a table with pawns: the half-moves the side to
+// move takes, with best play, to capture, move a pawn or mate while keeping the result. The fifty move rule is left
+// out, as no table made here comes near it. Mated positions and draws are left at 0.
+// The tables the captures and promotions lead into are made with g, and kept in it.
+func dtzPlies(t *testing.T, g *dtmGenerator, signature string) (*DTMTable, []int) {
+	table, err := g.generate(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := func(v byte) bool { return v >= dtmMated && (v-dtmMated)%2 == 0 }
+	children := make(map[[3]int]*dtmChild)
+	dtz := make([]int, len(table.values))
+	// the positions the quiet moves of each decisive position lead to, which keep the result for a won one
+	next := make([][]int, len(table.values))
+	var pending []int
+	moves := make([]dtmMove, 0, 64)
+	for idx, v := range table.values {
+		if v <= dtmMated {
+			continue
+		}
+		won := !lost(v)
+		p := table.position(idx)
+		var quiet []int
+		zeroes := false
+		for _, m := range p.moves(moves[:0]) {
+			var after byte
+			q := p
+			if m.captured < 0 && m.promotion == 0 {
+				q.squares[m.slot], q.stm = m.to, 1-p.stm
+				after = table.values[q.index()]
+			} else {
+				key := [3]int{m.captured, promotedSlot(m), int(m.promotion)}
+				child := children[key]
+				if child == nil {
+					if child, err = g.child(table, m.captured, promotedSlot(m), m.promotion); err != nil {
+						t.Fatal(err)
+					}
+					children[key] = child
+				}
+				after = child.value(&p, m)
+			}
+			if won && !lost(after) {
+				continue
+			}
+			if m.captured >= 0 || table.slots[m.slot].name == 'p' || after == dtmMated {
+				zeroes = true
+			} else {
+				quiet = append(quiet, q.index())
+			}
+		}
+		if (won && zeroes) || (!won && len(quiet) == 0) {
+			dtz[idx] = 1
+		} else {
+			next[idx] = quiet
+			pending = append(pending, idx)
+		}
+	}
+	// a won position is one half-move further from zeroing than the nearest of the lost positions it can reach,
+	// and a lost one than the furthest of the won positions it must reach
+	for plies := 2; len(pending) > 0; plies++ {
+		if plies > DTMMAXPLIES {
+			t.Fatalf("%s: no distance to zeroing for %d positions", signature, len(pending))
+		}
+		var found, left []int
+		for _, idx := range pending {
+			won := !lost(table.values[idx])
+			known := !won
+			for _, q := range next[idx] {
+				if d := dtz[q]; won && d != 0 && d < plies {
+					known = true
+				} else if !won && (d == 0 || d >= plies) {
+					known = false
+				}
+			}
+			if known {
+				found = append(found, idx)
+			} else {
+				left = append(left, idx)
+			}
+		}
+		for _, idx := range found {
+			dtz[idx] = plies
+		}
+		pending = left
+	}
+	return table, dtz
+}
+
+// A table of a Syzygy file as encodeSyzygy writes it.
+type tbEncoding struct {
+	sizes, sparseindex, blocklength, data []byte
+}
+
+// Compresses the values of a table the way Syzygy files do, with a canonical Huffman code of a symbol for each
+// value and one more symbol for the commonest value twice over, in blocks of 32 bytes with a sparse index entry
+// every 64 values.
+func encodeSyzygy(flags byte, values []int) tbEncoding {
+	const blocksize, span = 32, 64
+	counts := make(map[int]int)
+	for _, v := range values {
+		counts[v]++
+	}
+	if len(counts) == 1 {
+		return tbEncoding{sizes: []byte{flags | tbFlagSingleValue, byte(values[0])}}
+	}
+	common := values[0]
+	for v, n := range counts {
+		if n > counts[common] || (n == counts[common] && v < common) {
+			common = v
+		}
+	}
+	// the symbols are the values themselves and -1 for the pair
+	var tokens []int
+	for i := 0; i < len(values); i++ {
+		if values[i] == common && i+1 < len(values) && values[i+1] == common {
+			tokens = append(tokens, -1)
+			i++
+		} else {
+			tokens = append(tokens, values[i])
+		}
+	}
+	freq := make(map[int]int)
+	for _, token := range tokens {
+		freq[token]++
+	}
+	var symbols []int
+	for token := range freq {
+		symbols = append(symbols, token)
+	}
+	sort.Ints(symbols)
+	// Huffman code lengths, by merging the two least frequent groups of symbols until one is left
+	length := make(map[int]int)
+	type group struct{ weight, members []int }
+	groups := make([]group, len(symbols))
+	for i, s := range symbols {
+		groups[i] = group{[]int{freq[s]}, []int{s}}
+	}
+	for len(groups) > 1 {
+		sort.SliceStable(groups, func(i, j int) bool { return groups[i].weight[0] < groups[j].weight[0] })
+		merged := group{[]int{groups[0].weight[0] + groups[1].weight[0]}, append(groups[0].members, groups[1].members...)}
+		for _, s := range merged.members {
+			length[s]++
+		}
+		groups = append([]group{merged}, groups[2:]...)
+	}
+	minlen, maxlen := 64, 0
+	for _, s := range symbols {
+		if length[s] < minlen {
+			minlen = length[s]
+		}
+		if length[s] > maxlen {
+			maxlen = length[s]
+		}
+	}
+	// symbols are numbered from the longest codes to the shortest, and longer codes have lower values
+	sort.SliceStable(symbols, func(i, j int) bool { return length[symbols[i]] > length[symbols[j]] })
+	number := make(map[int]int)
+	lowest := make([]int, maxlen+1)
+	count := make([]int, maxlen+2)
+	for i, s := range symbols {
+		number[s] = i
+		if count[length[s]] == 0 {
+			lowest[length[s]] = i
+		}
+		count[length[s]]++
+	}
+	base := make([]int, maxlen+1)
+	for l := maxlen - 1; l >= minlen; l-- {
+		base[l] = (base[l+1] + count[l+1]) / 2
+		if count[l] == 0 {
+			lowest[l] = lowest[l+1] + count[l+1]
+		}
+	}
+
+	var enc tbEncoding
+	var block []byte
+	var starts []int
+	bits, start, first := 0, 0, 0
+	flush := func(end int) {
+		enc.data = append(enc.data, block...)
+		enc.data = append(enc.data, make([]byte, blocksize-len(block))...)
+		enc.blocklength = binary.LittleEndian.AppendUint16(enc.blocklength, uint16(end-first-1))
+		starts = append(starts, first)
+		block, bits, first = nil, 0, end
+	}
+	for _, token := range tokens {
+		n := 1
+		if token == -1 {
+			n = 2
+		}
+		l := length[token]
+		if bits+l > 8*blocksize {
+			flush(start)
+		}
+		code := base[l] + number[token] - lowest[l]
+		for i := l - 1; i >= 0; i-- {
+			if bits%8 == 0 {
+				block = append(block, 0)
+			}
+			if code>>uint(i)&1 != 0 {
+				block[bits/8] |= 0x80 >> uint(bits%8)
+			}
+			bits++
+		}
+		start += n
+	}
+	flush(start)
+	for i := 0; i*span < len(values); i++ {
+		middle := i*span + span/2
+		b := sort.SearchInts(starts, middle+1) - 1
+		enc.sparseindex = binary.LittleEndian.AppendUint32(enc.sparseindex, uint32(b))
+		enc.sparseindex = binary.LittleEndian.AppendUint16(enc.sparseindex, uint16(middle-starts[b]))
+	}
+
+	enc.sizes = []byte{flags, 5, 6, 0}
+	enc.sizes = binary.LittleEndian.AppendUint32(enc.sizes, uint32(len(starts)))
+	enc.sizes = append(enc.sizes, byte(maxlen), byte(minlen))
+	for l := minlen; l <= maxlen; l++ {
+		enc.sizes = binary.LittleEndian.AppendUint16(enc.sizes, uint16(lowest[l]))
+	}
+	enc.sizes = binary.LittleEndian.AppendUint16(enc.sizes, uint16(len(symbols)))
+	for _, s := range symbols {
+		left, right := s, 0xFFF
+		if s == -1 {
+			left, right = number[common], number[common]
+		}
+		enc.sizes = append(enc.sizes, byte(left), byte(left>>8&0xF|right<<4), byte(right>>4))
+	}
+	if len(symbols)%2 == 1 {
+		enc.sizes = append(enc.sizes, 0)
+	}
+	return enc
+}
+
+// The index of every placement of three pieces without pawns in a Syzygy table, in the order the format counts
+// them: the first piece below the diagonal in the a1-d1-d4 triangle and the others anywhere; then the first on the
+// a1-d4 diagonal and the second below the a1-h8 diagonal; then the first two on it and the third below it; and
+// last all three on it. Made by listing the placements, independently of the prober's index tables.
+var syzygyTriples = func() map[[3]int]int {
+	var triangle, diagonal, below []int
+	for s := 0; s < 64; s++ {
+		switch {
+		case s/8 == s%8:
+			diagonal = append(diagonal, s)
+		case s/8 < s%8:
+			below = append(below, s)
+			if s%8 <= 3 {
+				triangle = append(triangle, s)
+			}
+		}
+	}
+	all := make([]int, 64)
+	for s := range all {
+		all[s] = s
+	}
+	triples := make(map[[3]int]int)
+	add := func(first, second, third []int) {
+		for _, s0 := range first {
+			for _, s1 := range second {
+				for _, s2 := range third {
+					if s1 != s0 && s2 != s0 && s2 != s1 {
+						triples[[3]int{s0, s1, s2}] = len(triples)
+					}
+				}
+			}
+		}
+	}
+	add(triangle, all, all)
+	add(diagonal[:4], below, all)
+	add(diagonal[:4], diagonal, below)
+	add(diagonal[:4], diagonal, diagonal)
+	return triples
+}()
+
+// Returns the file of the leading pawn and the index of three pieces in a Syzygy table with the groups in the
+// order of the header, worked out from the format rather than with the prober's code. Without pawns the board is
+// turned whichever of its eight ways puts the pieces in syzygyTriples. With a pawn, first in squares, the board
+// is mirrored to put it on files a-d and the pawn's rank varies fastest, then the square of the second piece
+// among the 63 left and then that of the third among the 62 left.
+func syzygyTestIndex(pawns bool, squares [3]int) (file, idx int) {
+	mirror := func(s int) int { return s ^ 7 }
+	if !pawns {
+		flips := []func(int) int{mirror, func(s int) int { return s ^ 56 }, func(s int) int { return s%8*8 + s/8 }}
+		for turn := 0; turn < 8; turn++ {
+			var t [3]int
+			for i, s := range squares {
+				for bit, flip := range flips {
+					if turn>>uint(bit)&1 != 0 {
+						s = flip(s)
+					}
+				}
+				t[i] = s
+			}
+			if idx, ok := syzygyTriples[t]; ok {
+				return 0, idx
+			}
+		}
+		panic("no way to turn the board puts the pieces in syzygyTriples")
+	}
+	if squares[0]%8 > 3 {
+		for i := range squares {
+			squares[i] = mirror(squares[i])
+		}
+	}
+	// the number of squares below s that no earlier piece is on
+	free := func(s int, earlier ...int) int {
+		n := s
+		for _, e := range earlier {
+			if e < s {
+				n--
+			}
+		}
+		return n
+	}
+	return squares[0] % 8, squares[0]/8 - 1 + 6*free(squares[1], squares[0]) + 6*63*free(squares[2], squares[0], squares[1])
+}
+
+// Writes the Syzygy file of the material of a three piece DTM table, a WDL file or a DTZ file holding white to
+// move, with the value value gives for each position of the DTM table by its index: the result plus 2, or the
+// distance to zeroing in half-moves minus 1. The positions are indexed by syzygyTestIndex, so that a prober that
+// reads the file back has only the format in common with the writer.
+func writeSyzygy(t *testing.T, filename string, dtm *DTMTable, dtz bool, value func(idx int) int) {
+	second := strings.LastIndexByte(dtm.Signature, 'K')
+	key := dtm.Signature[:second] + "v" + dtm.Signature[second:]
+	e := newSyzygyTable(key, filename, dtz)
+	magic, flags, sides, maxfile := syzygyWDLMagic, byte(0), 1, 0
+	if dtz {
+		magic, flags = syzygyDTZMagic, tbFlagWinPlies|tbFlagLossPlies
+	} else if e.key != e.key2 {
+		sides = 2
+	}
+	header := append([]byte{}, magic...)
+	if e.pawns {
+		header, maxfile = append(header, 2|byte(sides-1)), 3
+	} else {
+		header = append(header, byte(sides-1))
+	}
+	// the pawns lead, then the pieces in the order of the DTM table
+	var codes []byte
+	for _, pawns := range []bool{true, false} {
+		for _, slot := range dtm.slots {
+			if (slot.name == 'p') == pawns {
+				codes = append(codes, byte(strings.IndexByte("pnbrqk", slot.name)+1+8*slot.side))
+			}
+		}
+	}
+	for f := 0; f <= maxfile; f++ {
+		header = append(header, 0)
+		for _, code := range codes {
+			header = append(header, code|code<<4)
+		}
+	}
+	header = append(header, make([]byte, len(header)&1)...)
+	pad := func(data []byte, align, rest int) []byte {
+		for len(data)%align != rest {
+			data = append(data, 0)
+		}
+		return data
+	}
+
+	// the slots of the pieces in the order of the header
+	var order []int
+	for _, pawns := range []bool{true, false} {
+		for i, slot := range dtm.slots {
+			if (slot.name == 'p') == pawns {
+				order = append(order, i)
+			}
+		}
+	}
+	size := len(syzygyTriples)
+	if e.pawns {
+		size = 6 * 63 * 62
+	}
+	values := make([][]int, (maxfile+1)*sides)
+	set := make([][]bool, len(values))
+	for i := range values {
+		values[i], set[i] = make([]int, size), make([]bool, size)
+	}
+	for idx, v := range dtm.values {
+		if v == dtmInvalid {
+			continue
+		}
+		p := dtm.position(idx)
+		if dtz && p.stm == 1 {
+			continue
+		}
+		var squares [3]int
+		for i, slot := range order {
+			squares[i] = p.squares[slot]
+		}
+		file, i := syzygyTestIndex(e.pawns, squares)
+		table := file*sides + p.stm%sides
+		if x := value(idx); !set[table][i] {
+			values[table][i], set[table][i] = x, true
+		} else if values[table][i] != x {
+			t.Fatalf("%s: positions with the same index %d have values %d and %d", key, i, values[table][i], x)
+		}
+	}
+
+	var encodings []tbEncoding
+	data := append([]byte{}, header...)
+	for f := 0; f <= maxfile; f++ {
+		for i := 0; i < sides; i++ {
+			enc := encodeSyzygy(flags, values[f*sides+i])
+			encodings = append(encodings, enc)
+			data = append(data, enc.sizes...)
+		}
+	}
+	if dtz {
+		data = pad(data, 2, 0)
+	}
+	for _, enc := range encodings {
+		data = append(data, enc.sparseindex...)
+	}
+	for _, enc := range encodings {
+		data = append(data, enc.blocklength...)
+	}
+	for _, enc := range encodings {
+		data = append(pad(data, 64, 0), enc.data...)
+	}
+	// room for the decoder to read ahead past the last block
+	data = pad(append(data, make([]byte, 64)...), 64, 16)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the position at an index of a DTM table, with the kings first as the engine expects.
+func (t *DTMTable) board(idx int) *engine.Board {
+	p := t.position(idx)
+	b := &engine.Board{Turn: 1 - 2*p.stm}
+	for _, kings := range []bool{true, false} {
+		for i, slot := range t.slots {
+			if (slot.name == 'k') == kings {
+				b.PlacePiece(slot.name, 1-2*slot.side, p.squares[i]%8+1, p.squares[i]/8+1)
+			}
+		}
+	}
+	return b
+}
+
+// Flips a board upside down with the colors swapped, which keeps every result and distance.
+func flipColors(b *engine.Board) *engine.Board {
+	flipped := &engine.Board{Turn: -b.Turn}
+	order := []int{1, 0} // the black king becomes the white one
+	for i := 2; i < len(b.Board); i++ {
+		order = append(order, i)
+	}
+	for _, i := range order {
+		if p := b.Board[i]; !p.Captured {
+			flipped.PlacePiece(p.Name, -p.Color, p.Position.X, 9-p.Position.Y)
+		}
+	}
+	return flipped
+}
+
+// Known results of positions in KQvK, KRvK and KPvK with either side to move, and their distances to zeroing.
+var syzygyProbes = []struct {
+	fen      string
+	wdl, dtz int
+}{
+	{"7k/8/6K1/8/8/8/8/1Q6 w", TBWON, 1},   // Qb8#
+	{"1q6/8/8/8/8/6k1/8/7K b", TBWON, 1},   // the colors the other way round
+	{"7k/8/6K1/8/8/8/8/1Q6 b", TBLOSS, -2}, // Kg8 Qb8#
+	{"8/8/8/8/8/8/6Qk/K7 b", TBDRAW, 0},    // Kxg2
+	{"7k/8/6K1/8/8/8/8/1R6 w", TBWON, 1},
+	{"8/8/8/3k4/8/8/8/R3K3 w", TBWON, 27},
+	{"8/8/8/3k4/8/8/8/R3K3 b", TBLOSS, -28},
+	{"8/4k3/8/4K3/4P3/8/8/8 w", TBDRAW, 0}, // black has the opposition
+	{"8/4k3/8/4K3/4P3/8/8/8 b", TBLOSS, -4},
+	{"8/8/8/4p3/4k3/8/4K3/8 b", TBDRAW, 0}, // the colors the other way round
+	{"8/8/8/4p3/4k3/8/4K3/8 w", TBLOSS, -4},
+	{"k7/8/8/8/8/8/P7/K7 w", TBDRAW, 0}, // a rook pawn with the king in the corner
+	{"7k/8/8/8/8/8/7P/7K w", TBDRAW, 0},
+	{"k7/8/K7/P7/8/8/8/8 b", TBDRAW, 0},
+	{"3k4/8/3K4/3P4/8/8/8/8 b", TBLOSS, -4},
+}
+
+// Checks the tablebases against syzygyProbes.
+func checkSyzygyProbes(t *testing.T, tb Tablebase) {
+	for _, test := range syzygyProbes {
+		board, err := engine.FromFen(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wdl, ok := tb.ProbeWDL(board); wdl != test.wdl || !ok {
+			t.Errorf("Expected WDL %d for %s, got %d %v", test.wdl, test.fen, wdl, ok)
+		}
+		if dtz, ok := tb.ProbeDTZ(board); dtz != test.dtz || !ok {
+			t.Errorf("Expected DTZ %d for %s, got %d %v", test.dtz, test.fen, dtz, ok)
+		}
+	}
+}
+
+func TestSyzygyTables(t *testing.T) {
+	dir := t.TempDir()
+	wdlValue := map[int]int{TBLOSS: 0, TBDRAW: 2, TBWON: 4}
+	type truth struct {
+		table *DTMTable
+		dtz   []int
+	}
+	var tables []truth
+	// the tables without pawns are made along with KPK, which promotes into them
+	g := &dtmGenerator{tables: make(map[string]*DTMTable)}
+	for _, signature := range []string{"KPK", "KQK", "KRK", "KBK", "KNK"} {
+		var table *DTMTable
+		var dtz []int
+		if signature == "KPK" {
+			table, dtz = dtzPlies(t, g, signature)
+		} else {
+			// without pawns no move zeroes and keeps the result, so the distance to zeroing is the distance to mate
+			table = g.tables[signature]
+			dtz = make([]int, len(table.values))
+			for idx, v := range table.values {
+				if v > dtmMated {
+					dtz[idx] = int(v - dtmMated)
+				}
+			}
+		}
+		tables = append(tables, truth{table, dtz})
+		wdl := func(idx int) int {
+			switch v := table.values[idx]; {
+			case v == dtmDraw:
+				return wdlValue[TBDRAW]
+			case (v-dtmMated)%2 == 1:
+				return wdlValue[TBWON]
+			}
+			return wdlValue[TBLOSS]
+		}
+		name := filepath.Join(dir, signature[:len(signature)-1]+"vK")
+		writeSyzygy(t, name+".rtbw", table, false, wdl)
+		writeSyzygy(t, name+".rtbz", table, true, func(idx int) int {
+			if dtz[idx] == 0 {
+				return 0
+			}
+			return dtz[idx] - 1
+		})
+	}
+	tb, err := LoadSyzygy(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkSyzygyProbes(t, tb)
+
+	// every position the tables were made from, in a sample, with either side as white
+	for _, truth := range tables {
+		checked := 0
+		for idx := 0; idx < len(truth.table.values); idx += 499 {
+			v := truth.table.values[idx]
+			if v == dtmInvalid {
+				continue
+			}
+			b := truth.table.board(idx)
+			wdl, dtz := TBDRAW, 0
+			switch {
+			case v == dtmMated:
+				wdl, dtz = TBLOSS, -1
+			case v > dtmMated && (v-dtmMated)%2 == 1:
+				wdl, dtz = TBWON, truth.dtz[idx]
+			case v > dtmMated:
+				wdl, dtz = TBLOSS, -truth.dtz[idx]
+			}
+			for _, board := range []*engine.Board{b, flipColors(b)} {
+				gotwdl, ok := tb.ProbeWDL(board)
+				gotdtz, ok2 := tb.ProbeDTZ(board)
+				if gotwdl != wdl || gotdtz != dtz || !ok || !ok2 {
+					t.Fatalf("%s: expected WDL %d and DTZ %d for %s, got %d %v and %d %v", truth.table.Signature, wdl, dtz,
+						board.ToFen(), gotwdl, ok, gotdtz, ok2)
+				}
+			}
+			checked++
+		}
+		if checked == 0 {
+			t.Errorf("%s: no positions checked", truth.table.Signature)
+		}
+	}
+}
+
+// Probes the real tables in testdata/syzygy, as distributed with the Syzygy tablebases, rather than tables written
+// by the code under test. The test is skipped when they are not there.
+func TestSyzygyFiles(t *testing.T) {
+	dir := filepath.Join("testdata", "syzygy")
+	for _, name := range []string{"KQvK", "KRvK", "KPvK"} {
+		for _, ext := range []string{".rtbw", ".rtbz"} {
+			if _, err := os.Stat(filepath.Join(dir, name+ext)); err != nil {
+				t.Skipf("%s%s is not in %s", name, ext, dir)
+			}
+		}
+	}
+	tb, err := LoadSyzygy(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyzygyProbes(t, tb)
+}
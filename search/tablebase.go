@@ -0,0 +1,189 @@
+package search
+
+import (
+	"sync/atomic"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Endgame tablebases hold the exact result of every position with a few pieces left. The search asks them about
+// positions reached by a capture or a pawn move, and at the root about every move, so that it keeps to the moves
+// that win fastest.
+// Reference: https://www.chessprogramming.org/Endgame_Tablebases
+const (
+	TBWIN = MATEBOUND - MAXPLY // score of a position the tablebases say is won, below any forced mate
+)
+
+// Results of a tablebase probe, for the side to move. A cursed win is a win the fifty move rule turns into a draw,
+// and a blessed loss a loss it saves.
+const (
+	TBLOSS        = -2
+	TBBLESSEDLOSS = -1
+	TBDRAW        = 0
+	TBCURSEDWIN   = 1
+	TBWON         = 2
+)
+
+// A set of endgame tablebases. Positions with castling rights are never probed.
+type Tablebase interface {
+	// MaxPieces is the most pieces, kings included, of any position in the tablebases.
+	MaxPieces() int
+
+	// ProbeWDL returns the result of a position for the side to move, from TBLOSS to TBWON, with ok false if the
+	// position is not in the tablebases.
+	ProbeWDL(b *engine.Board) (wdl int, ok bool)
+
+	// ProbeDTZ returns the distance to zeroing: the number of half-moves until the next capture or pawn move
+	// with best play, positive when the side to move wins and negative when it loses, or 0 for a draw.
+	// Cursed wins and blessed losses are 100 further from zero. ok is false if the position is not in the
+	// tablebases.
+	ProbeDTZ(b *engine.Board) (dtz int, ok bool)
+}
+
+// A set of endgame tablebases that also knows how far each position is from mate. At the root the search then
+// keeps to the moves that mate soonest instead of those that zero soonest.
+type MateTablebase interface {
+	Tablebase
+
+	// ProbeDTM returns the number of half-moves to mate with best play, positive when the side to move wins and
+	// negative when it loses, or 0 for a draw or a side already mated. ok is false if the position is not in the
+	// tablebases.
+	ProbeDTM(b *engine.Board) (dtm int, ok bool)
+}
+
+// Returns the number of pieces on a board, kings included.
+func pieceCount(b *engine.Board) int {
+	n := 0
+	for _, p := range b.Board {
+		if !p.Captured {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns whether either side can still castle, which tablebases do not allow for.
+func castlingRights(b *engine.Board) bool {
+	for _, king := range b.Board {
+		if king.Name != 'k' || king.Captured || !king.Can_castle {
+			continue
+		}
+		for _, rook := range b.Board {
+			if rook.Name == 'r' && rook.Color == king.Color && !rook.Captured && rook.Can_castle {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether the tablebases may hold the thread's board.
+func (t *thread) canProbe() bool {
+	return t.tablebase != nil && pieceCount(t.board) <= t.tablebase.MaxPieces() && !castlingRights(t.board)
+}
+
+// Converts a tablebase result for the side to move to a white-relative score. Cursed wins and blessed losses
+// are draws.
+func (t *thread) tablebaseScore(wdl int) int {
+	switch {
+	case wdl == TBWON:
+		return TBWIN * t.board.Turn
+	case wdl == TBLOSS:
+		return -TBWIN * t.board.Turn
+	}
+	return t.drawscore
+}
+
+// Probes the tablebases for the result of the thread's board, counting the hit.
+func (t *thread) probeWDL() (int, bool) {
+	wdl, ok := t.tablebase.ProbeWDL(t.board)
+	if ok {
+		atomic.AddUint64(&t.tbhits, 1)
+	}
+	return wdl, ok
+}
+
+// Returns the root moves that keep the best result the tablebases allow, or nil if the root is not in them.
+// Among winning moves only those that reach the next capture or pawn move soonest are kept, so that the win
+// makes progress; among losing moves those that put it off longest, hoping for the fifty move rule.
+// With a MateTablebase the moves that mate soonest, or are mated latest, are kept instead. Without distance to
+// zeroing or mate every move keeping the result is kept.
+func (t *thread) tablebaseRootMoves() []*engine.Move {
+	if !t.canProbe() {
+		return nil
+	}
+	b := t.board
+	best := -1 << 30
+	var moves []*engine.Move
+	for _, move := range b.AllLegalMoves() {
+		t.makeMove(move)
+		rank, ok := t.rootRank()
+		t.undoMove(move)
+		if !ok {
+			return nil
+		}
+		if rank > best {
+			best, moves = rank, moves[:0]
+		}
+		if rank == best {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// Ranks the root move just made, from the tablebase result of the position it reaches.
+func (t *thread) rootRank() (int, bool) {
+	b := t.board
+	if len(b.AllLegalMoves()) == 0 {
+		if b.IsCheck(b.Turn) {
+			return 2000, true
+		}
+		return 0, true
+	}
+	wdl, ok := t.probeWDL()
+	if !ok {
+		return 0, false
+	}
+	wdl = -wdl
+	if tb, ok := t.tablebase.(MateTablebase); ok {
+		// one half-move further from mate than the position after the move; the distance to mate says nothing of
+		// the fifty move rule, so a win is never taken for a cursed one
+		dtm, ok := tb.ProbeDTM(b)
+		if !ok {
+			return 1000 * wdl, true
+		}
+		atomic.AddUint64(&t.tbhits, 1)
+		return 1000*wdl - (absInt(dtm)+1)*sign(wdl), true
+	}
+	dtz := 0
+	if t.clocks[len(t.clocks)-1] > 0 {
+		if d, ok := t.tablebase.ProbeDTZ(b); ok {
+			atomic.AddUint64(&t.tbhits, 1)
+			// one half-move further from zeroing than the position after the move
+			dtz = -d
+			if dtz > 0 {
+				dtz++
+			} else if dtz < 0 {
+				dtz--
+			}
+		}
+	}
+	switch {
+	case wdl == TBWON && dtz > 0 && dtz+t.clocks[len(t.clocks)-2] >= FIFTYMOVES:
+		wdl = TBCURSEDWIN
+	case wdl == TBLOSS && dtz < 0 && -dtz+t.clocks[len(t.clocks)-2] >= FIFTYMOVES:
+		wdl = TBBLESSEDLOSS
+	}
+	return 1000*wdl - absInt(dtz)*sign(wdl), true
+}
+
+func sign(i int) int {
+	switch {
+	case i > 0:
+		return 1
+	case i < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Tablebases for king and queen against king in which the queen always wins, the slower the higher it stands,
+// except that it wins at once from a few chosen positions.
+type fakeTablebase struct {
+	fast map[string]bool // positions, as ToFen writes them, a few moves from zeroing
+}
+
+func (fakeTablebase) MaxPieces() int {
+	return 3
+}
+
+func (f fakeTablebase) ProbeWDL(b *engine.Board) (int, bool) {
+	if materialKey(b) != "KQvK" {
+		return 0, false
+	}
+	if b.Turn == 1 {
+		return TBWON, true
+	}
+	return TBLOSS, true
+}
+
+func (f fakeTablebase) ProbeDTZ(b *engine.Board) (int, bool) {
+	wdl, ok := f.ProbeWDL(b)
+	dtz := 20
+	if f.fast[b.ToFen()] {
+		dtz = 3
+	}
+	return dtz * sign(wdl), ok
+}
+
+func TestTablebaseRootMoves(t *testing.T) {
+	board, _ := engine.FromFen("8/8/8/3k4/8/8/8/4K2Q w")
+	fast, _ := engine.FromFen("8/8/8/3k4/7Q/8/8/4K3 b")
+	tb := fakeTablebase{fast: map[string]bool{fast.ToFen(): true}}
+	var infos []Info
+	result := Search(context.Background(), board, Options{Depth: 3, MultiPV: 2, Tablebase: tb, Info: func(info Info) {
+		infos = append(infos, info)
+	}})
+	if result.Move.ToString() != "qh1-h4" {
+		t.Errorf("Expected the move nearest to zeroing, got %s", result.Move.ToString())
+	}
+	if len(result.Lines) != 1 {
+		t.Errorf("Expected the other moves to be left out, got %d lines", len(result.Lines))
+	}
+	if result.TBHits == 0 || infos[len(infos)-1].TBHits == 0 {
+		t.Error("Expected tablebase hits to be counted")
+	}
+	// past the fifty move rule every win is cursed, so the fastest is still the one kept
+	result = Search(context.Background(), board, Options{Depth: 1, Tablebase: tb, HalfmoveClock: 90})
+	if result.Move.ToString() != "qh1-h4" {
+		t.Errorf("Expected the move nearest to zeroing with the fifty move rule close, got %s", result.Move.ToString())
+	}
+}
+
+func TestTablebaseSearch(t *testing.T) {
+	dir := t.TempDir()
+	writeKQK(t, filepath.Join(dir, "KQvK.rtbw"), syzygyWDLMagic, 4, 0)
+	tb, err := LoadSyzygy(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// taking the rook reaches a won ending the tablebases know; without them a shallow search only sees a queen up
+	board, _ := engine.FromFen("4k3/8/8/8/8/8/8/r2QK3 w")
+	result := Search(context.Background(), board, Options{Depth: 2, Tablebase: tb})
+	if result.Move.ToString() != "qd1-a1" || result.Score != TBWIN || result.TBHits == 0 {
+		t.Errorf("Expected Qxa1 scoring %d with tablebase hits, got %s scoring %d with %d hits",
+			TBWIN, result.Move.ToString(), result.Score, result.TBHits)
+	}
+	result = Search(context.Background(), board, Options{Depth: 2})
+	if result.Move.ToString() != "qd1-a1" || result.Score >= TBWIN || result.TBHits != 0 {
+		t.Errorf("Expected Qxa1 without tablebases to score as usual, got %s scoring %d", result.Move.ToString(), result.Score)
+	}
+}
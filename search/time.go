@@ -0,0 +1,125 @@
+package search
+
+import (
+	"time"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+const (
+	MOVEOVERHEAD = 50 * time.Millisecond // kept back on every move for the time it takes to send it
+
+	MINMOVESLEFT = 20 // moves a game is expected to last from the endgame on
+	MAXMOVESLEFT = 40 // moves a game is expected to last from the starting position
+)
+
+// The time control of the side to move. The web server's timed games fill it in from the game's settings; a UCI
+// front end would take it from the wtime or btime, winc or binc and movestogo of "go", and an XBoard one from
+// "level" and "time".
+type Clock struct {
+	Remaining time.Duration // time left on the clock
+	Increment time.Duration // added after every move
+	MovesToGo int           // moves until the clock is topped up again, 0 if the remaining time is for the rest of the game
+}
+
+// Decides how long to think about a move.
+// Every move gets a share of the remaining time, the optimum, which grows when the best move keeps changing or the
+// score drops between iterations, and is never allowed to grow past the maximum. The maximum leaves MOVEOVERHEAD
+// on the clock, so that the engine never loses on time.
+// Reference: https://www.chessprogramming.org/Time_Management
+type TimeManager struct {
+	start            time.Time
+	optimum, maximum time.Duration
+
+	lastmove    *engine.Move
+	lastscore   int
+	instability float64 // how often the best move has changed lately, decaying with every iteration
+	drop        int     // how much the score fell in the last iteration, for the side to move
+}
+
+// Makes a time manager for a move in position b, starting the time now.
+func NewTimeManager(clock Clock, b *engine.Board) *TimeManager {
+	movesleft := clock.MovesToGo
+	if movesleft <= 0 {
+		movesleft = expectedMovesLeft(b)
+	}
+	safe := clock.Remaining - MOVEOVERHEAD
+	if safe < clock.Remaining/2 {
+		safe = clock.Remaining / 2
+	}
+	optimum := clock.Remaining/time.Duration(movesleft) + clock.Increment*3/4
+	maximum := optimum * 5
+	if maximum > safe*3/4 {
+		maximum = safe * 3 / 4
+	}
+	if optimum > maximum {
+		optimum = maximum
+	}
+	return &TimeManager{start: time.Now(), optimum: optimum, maximum: maximum}
+}
+
+// Estimates how many moves the game has left from the material still on the board:
+// MAXMOVESLEFT with every piece on the board, down to MINMOVESLEFT once only pawns and kings remain.
+func expectedMovesLeft(b *engine.Board) int {
+	material := 0
+	for _, p := range b.Board {
+		if !p.Captured && p.Name != 'p' {
+			material += VALUES[p.Name]
+		}
+	}
+	const full = 6200 // pieces other than pawns in the starting position
+	if material > full {
+		material = full
+	}
+	return MINMOVESLEFT + (MAXMOVESLEFT-MINMOVESLEFT)*material/full
+}
+
+// Restarts the time, for a ponder search that has just become a normal one.
+func (tm *TimeManager) Restart() {
+	tm.start = time.Now()
+}
+
+// Returns how long the search has been thinking.
+func (tm *TimeManager) Elapsed() time.Duration {
+	return time.Since(tm.start)
+}
+
+// Records the result of an iteration, with the white-relative score of the best move and the side to move.
+func (tm *TimeManager) update(move *engine.Move, score, turn int) {
+	tm.instability /= 2
+	if tm.lastmove != nil && !sameMove(move, tm.lastmove) {
+		tm.instability++
+	}
+	tm.drop = 0
+	if tm.lastmove != nil {
+		tm.drop = (tm.lastscore - score) * turn
+	}
+	tm.lastmove, tm.lastscore = move, score
+}
+
+// Returns how long the current move should take, given how the search has gone so far.
+func (tm *TimeManager) target() time.Duration {
+	scale := 1 + tm.instability/2
+	if tm.drop > 0 {
+		scale *= 1 + float64(tm.drop)/100
+		if scale > 3 {
+			scale = 3
+		}
+	}
+	target := time.Duration(float64(tm.optimum) * scale)
+	if target > tm.maximum {
+		return tm.maximum
+	}
+	return target
+}
+
+// Returns whether another iteration should be started.
+// Each iteration takes several times as long as the last, so none is started once half the target has passed.
+func (tm *TimeManager) nextIteration() bool {
+	return tm.Elapsed() < tm.target()/2
+}
+
+// Returns whether the search must stop at once.
+func (tm *TimeManager) timeUp() bool {
+	return tm.Elapsed() >= tm.maximum
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestTimeManager(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	opening := NewTimeManager(Clock{Remaining: time.Minute}, board)
+	if opening.optimum != time.Minute/MAXMOVESLEFT {
+		t.Errorf("Expected a minute to be spread over %d moves in the opening, got %s per move", MAXMOVESLEFT, opening.optimum)
+	}
+	endgame, err := engine.FromFen("4k3/pp6/8/8/8/8/PP6/4K3 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm := NewTimeManager(Clock{Remaining: time.Minute}, endgame); tm.optimum <= opening.optimum {
+		t.Errorf("Expected more time per move in the endgame, got %s", tm.optimum)
+	}
+	if tm := NewTimeManager(Clock{Remaining: time.Minute, Increment: time.Second}, board); tm.optimum <= opening.optimum {
+		t.Errorf("Expected an increment to add time, got %s", tm.optimum)
+	}
+	last := NewTimeManager(Clock{Remaining: time.Second, MovesToGo: 1}, board)
+	if last.maximum >= time.Second-MOVEOVERHEAD {
+		t.Errorf("Expected the last move before the time control not to use all the time, got %s", last.maximum)
+	}
+
+	tm := NewTimeManager(Clock{Remaining: time.Minute}, board)
+	move := &engine.Move{Begin: engine.Square{X: 5, Y: 2}, End: engine.Square{X: 5, Y: 4}}
+	other := &engine.Move{Begin: engine.Square{X: 4, Y: 2}, End: engine.Square{X: 4, Y: 4}}
+	tm.update(move, 50, 1)
+	stable := tm.target()
+	tm.update(other, 50, 1)
+	if tm.target() <= stable {
+		t.Error("Expected more time when the best move changes")
+	}
+	tm.update(other, 50, 1)
+	tm.update(other, 50, 1)
+	tm.update(other, 50, 1)
+	tm.update(other, 50, 1)
+	changed := tm.target()
+	tm.update(other, -50, 1)
+	if tm.target() <= changed {
+		t.Error("Expected more time when the score drops")
+	}
+	if tm.target() > tm.maximum {
+		t.Error("Expected the time never to go past the maximum")
+	}
+}
+
+func TestSearchClock(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	for _, remaining := range []time.Duration{300 * time.Millisecond, 2 * time.Second} {
+		start := time.Now()
+		result := Search(context.Background(), board, Options{Clock: &Clock{Remaining: remaining, MovesToGo: 1}})
+		if elapsed := time.Since(start); elapsed >= remaining-MOVEOVERHEAD || result.Move == nil {
+			t.Errorf("Expected a move within %s, took %s", remaining-MOVEOVERHEAD, elapsed)
+		}
+	}
+	// out of time, the engine still searches one iteration rather than play an arbitrary move
+	for _, remaining := range []time.Duration{0, -time.Second} {
+		result := Search(context.Background(), board, Options{Clock: &Clock{Remaining: remaining}})
+		if result.Depth < 1 || result.Move == nil {
+			t.Errorf("Expected a searched move with %s left, got depth %d", remaining, result.Depth)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// The evaluation terms, for breaking the score of a position down in an EvalTrace.
+const (
+	termMaterial = iota
+	termPST
+	termPawns
+	termPassed
+	termKing
+	termKnights
+	termBishops
+	termRooks
+	termQueens
+	termSquares
+	nterms
+)
+
+var (
+	termNames  = [nterms]string{"material", "piece-square", "pawn structure", "passed pawns", "king safety", "knights", "bishops", "rooks", "queens", "square control"}
+	pieceTerms = map[byte]int{'n': termKnights, 'b': termBishops, 'r': termRooks, 'q': termQueens}
+)
+
+// The score of each evaluation term for white and for black, each from its own side's point of view.
+type evalTerms [nterms][2]Score
+
+func (terms *evalTerms) add(term, color int, s Score) {
+	side := colorSide(color)
+	terms[term][side] = terms[term][side].plus(s)
+}
+
+// Returns the white-relative sum of every term.
+func (terms *evalTerms) sum() Score {
+	var score Score
+	for _, term := range terms {
+		score = score.plus(term[0]).minus(term[1])
+	}
+	return score
+}
+
+// A breakdown of the evaluation of a position by term, to find out which term misled the engine.
+type EvalTrace struct {
+	Phase int         `json:"phase"` // see gamePhase
+	Terms []TraceTerm `json:"terms"` // empty when the game is over
+	Score int         `json:"score"` // the evaluation, as given by Classical
+
+	Endgame string `json:"endgame,omitempty"` // the endgame recognized, whose evaluator replaces the terms or scales them
+	Scale   int    `json:"scale"`             // how much of the terms the score keeps, out of SCALENORMAL
+}
+
+// What one evaluation term adds for each side, from that side's own point of view.
+type TraceTerm struct {
+	Name  string `json:"name"`
+	White Score  `json:"white"`
+	Black Score  `json:"black"`
+	Total int    `json:"total"` // white's score minus black's, tapered by the phase
+}
+
+// Evaluates a position like Classical with the given weights, or the default ones if params is nil, term by term.
+// Each term is tapered on its own, so the totals of the terms may add up to a few centipawns off the score.
+func TraceEval(b *engine.Board, params *Params) *EvalTrace {
+	evaluator := Classical{Params: params}
+	trace := &EvalTrace{Phase: gamePhase(b), Score: evaluator.Evaluate(b), Terms: []TraceTerm{}}
+	if b.IsOver() != 0 {
+		trace.Scale = SCALENORMAL
+		return trace
+	}
+	endgame := probeEndgame(b)
+	trace.Endgame, trace.Scale = endgame.name, endgame.scale
+	var terms evalTerms
+	pst := evaluator.params().PST
+	for _, p := range b.Board {
+		if !p.Captured {
+			terms.add(termPST, p.Color, pstScore(pst, p.Name, p.Color, p.Position).times(p.Color))
+		}
+	}
+	evaluateTerms(b, evaluator.params(), nil, &terms)
+	for i, term := range terms {
+		trace.Terms = append(trace.Terms, TraceTerm{
+			Name:  termNames[i],
+			White: term[0],
+			Black: term[1],
+			Total: taper(term[0].minus(term[1]), trace.Phase),
+		})
+	}
+	return trace
+}
+
+// Formats the trace as a table, with the middlegame and endgame weights of each side and the tapered total.
+func (trace *EvalTrace) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%-16s %13s %13s %7s\n", "term", "white mg/eg", "black mg/eg", "total")
+	for _, term := range trace.Terms {
+		fmt.Fprintf(&buf, "%-16s %6d %6d %6d %6d %7d\n", term.Name, term.White.MG, term.White.EG, term.Black.MG, term.Black.EG, term.Total)
+	}
+	if trace.Endgame != "" {
+		fmt.Fprintf(&buf, "endgame %s, scale %d/%d\n", trace.Endgame, trace.Scale, SCALENORMAL)
+	}
+	fmt.Fprintf(&buf, "%-16s %35d\n", fmt.Sprintf("score (phase %d)", trace.Phase), trace.Score)
+	return buf.String()
+}
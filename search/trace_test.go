@@ -0,0 +1,39 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+func TestTraceEval(t *testing.T) {
+	board := &engine.Board{Turn: 1}
+	board.SetUpPieces()
+	trace := TraceEval(board, nil)
+	if len(trace.Terms) != nterms || trace.Phase != MAXPHASE || trace.Score != DRAW {
+		t.Fatalf("Unexpected trace of the starting position: %+v", trace)
+	}
+	for _, term := range trace.Terms {
+		if term.White != term.Black || term.Total != 0 {
+			t.Errorf("Expected %s to be the same for both sides in the starting position, got %+v", term.Name, term)
+		}
+	}
+	for _, fen := range []string{"r1bqk2r/ppp2ppp/2n5/3pP3/1b1Pn3/2N2N2/PP3PPP/R1BQKB1R w", "8/5pk1/6p1/3P4/8/6P1/5PK1/8 b"} {
+		board, err := engine.FromFen(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trace := TraceEval(board, nil)
+		total := 0
+		for _, term := range trace.Terms {
+			total += term.Total
+		}
+		if absInt(total-trace.Score) > nterms || trace.Score != EvalBoard(board) {
+			t.Errorf("Expected the terms of %s to add up to its score %d, got %d", fen, trace.Score, total)
+		}
+		if !strings.Contains(trace.String(), "king safety") {
+			t.Errorf("Expected the table to list every term, got\n%s", trace)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"sync/atomic"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+const (
+	DEFAULTHASH = 16 // default transposition table size in megabytes
+
+	// how a stored score relates to the true score of the position
+	EXACT      = 0
+	LOWERBOUND = 1 // the true score is at least the stored score
+	UPPERBOUND = 2 // the true score is at most the stored score
+)
+
+// Reference: https://www.chessprogramming.org/Shared_Hash_Table#Lockless
+
+// Remembers the result of searching a position, keyed by its Zobrist hash, so that a position reached through
+// different move orders is only searched once.
+// Each entry is two words written with atomic stores, and the key is stored xor the data.
+// Threads can share the table without locks: a write torn by another thread simply fails the key check.
+type TranspositionTable struct {
+	entries    []ttEntry
+	mask       uint64
+	generation uint64
+}
+
+type ttEntry struct {
+	key  uint64 // hash xor data
+	data uint64
+}
+
+// An unpacked table entry.
+// The best move is stored without its piece or capture and must be matched against the legal moves.
+type ttData struct {
+	score      int
+	depth      int
+	bound      int
+	hasmove    bool
+	begin, end engine.Square
+	promotion  byte
+}
+
+var promotions = []byte{0, 'q', 'r', 'n', 'b'}
+
+// Makes a table of at most the given number of megabytes.
+func NewTranspositionTable(megabytes int) *TranspositionTable {
+	size := uint64(1)
+	for size*2*16 <= uint64(megabytes)<<20 {
+		size *= 2
+	}
+	return &TranspositionTable{
+		entries: make([]ttEntry, size),
+		mask:    size - 1,
+	}
+}
+
+// Marks the start of a new search, so that entries left over from earlier searches are replaced first.
+func (tt *TranspositionTable) NewSearch() {
+	atomic.AddUint64(&tt.generation, 1)
+}
+
+// Empties the table.
+func (tt *TranspositionTable) Clear() {
+	for i := range tt.entries {
+		atomic.StoreUint64(&tt.entries[i].key, 0)
+		atomic.StoreUint64(&tt.entries[i].data, 0)
+	}
+}
+
+// Returns how full the table is in permille, estimated from the first thousand entries.
+// Only entries written by the current search are counted.
+func (tt *TranspositionTable) Hashfull() int {
+	generation := atomic.LoadUint64(&tt.generation) & 0xff
+	sample := len(tt.entries)
+	if sample > 1000 {
+		sample = 1000
+	}
+	var used int
+	for i := 0; i < sample; i++ {
+		if data := atomic.LoadUint64(&tt.entries[i].data); data != 0 && data>>42&0xff == generation {
+			used++
+		}
+	}
+	return used * 1000 / sample
+}
+
+// Data layout, from the lowest bit:
+// score in centipawns (16), depth (8), bound (2), has move (1), move begin and end squares (12),
+// promotion (3), generation (8).
+func packEntry(d ttData, generation uint64) uint64 {
+	data := uint64(uint16(int16(d.score)))
+	data |= uint64(d.depth&0xff) << 16
+	data |= uint64(d.bound&3) << 24
+	if d.hasmove {
+		data |= 1 << 26
+		data |= uint64(d.begin.X-1) << 27
+		data |= uint64(d.begin.Y-1) << 30
+		data |= uint64(d.end.X-1) << 33
+		data |= uint64(d.end.Y-1) << 36
+		for i, p := range promotions {
+			if p == d.promotion {
+				data |= uint64(i) << 39
+			}
+		}
+	}
+	data |= (generation & 0xff) << 42
+	return data
+}
+
+func unpackEntry(data uint64) ttData {
+	d := ttData{
+		score:   int(int16(uint16(data))),
+		depth:   int(data >> 16 & 0xff),
+		bound:   int(data >> 24 & 3),
+		hasmove: data>>26&1 == 1,
+	}
+	if d.hasmove {
+		d.begin = engine.Square{X: int(data>>27&7) + 1, Y: int(data>>30&7) + 1}
+		d.end = engine.Square{X: int(data>>33&7) + 1, Y: int(data>>36&7) + 1}
+		d.promotion = promotions[data>>39&7]
+	}
+	return d
+}
+
+// Looks up a position by its hash.
+func (tt *TranspositionTable) Probe(hash uint64) (ttData, bool) {
+	entry := &tt.entries[hash&tt.mask]
+	key, data := atomic.LoadUint64(&entry.key), atomic.LoadUint64(&entry.data)
+	if key^data != hash || data == 0 {
+		return ttData{}, false
+	}
+	return unpackEntry(data), true
+}
+
+// Stores the result of searching a position.
+// An entry from the current search is only replaced by a search at least as deep, or by an exact score.
+func (tt *TranspositionTable) Store(hash uint64, d ttData) {
+	entry := &tt.entries[hash&tt.mask]
+	generation := atomic.LoadUint64(&tt.generation)
+	if olddata := atomic.LoadUint64(&entry.data); olddata != 0 {
+		old := unpackEntry(olddata)
+		samesearch := olddata>>42&0xff == generation&0xff
+		if samesearch && d.bound != EXACT && old.depth > d.depth {
+			return
+		}
+		if atomic.LoadUint64(&entry.key)^olddata == hash && !d.hasmove && old.hasmove {
+			// keep the best move found by an earlier search of the same position
+			d.hasmove, d.begin, d.end, d.promotion = true, old.begin, old.end, old.promotion
+		}
+	}
+	data := packEntry(d, generation)
+	atomic.StoreUint64(&entry.key, hash^data)
+	atomic.StoreUint64(&entry.data, data)
+}
+
+// Returns the move from movelist that a table entry refers to, or nil.
+func (d ttData) matchMove(movelist []*engine.Move) *engine.Move {
+	if !d.hasmove {
+		return nil
+	}
+	for _, m := range movelist {
+		if m.Begin == d.begin && m.End == d.end && m.Promotion == d.promotion {
+			return m
+		}
+	}
+	return nil
+}
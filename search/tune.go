@@ -0,0 +1,216 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jacobroberts/chess/engine"
+)
+
+// Texel tuning: the weights of the evaluation are adjusted to predict the results of real games. The score of
+// each position is turned into an expected result by a sigmoid, and the weights are changed one step at a time
+// for as long as that lowers the mean squared error over all positions.
+// Reference: https://www.chessprogramming.org/Texel%27s_Tuning_Method
+
+// A position from a game, with the result of the game: 1 if white won, 0.5 for a draw and 0 if black won.
+type TuningPosition struct {
+	Board  *engine.Board
+	Result float64
+}
+
+// How to tune the evaluation.
+type TuneOptions struct {
+	Passes  int      // passes over all weights, or 0 to go on until no step lowers the error
+	Only    []string // names or name prefixes of the weights to tune, such as "PASSEDRANK", all weights if empty
+	Step    int      // how far a weight is changed at a time, in centipawns, 1 if not set
+	Threads int      // number of positions scored in parallel, 1 if not set
+
+	// Progress is called after every pass with the number of the pass and the error. May be nil.
+	Progress func(pass int, err float64)
+}
+
+var (
+	resultPattern    = regexp.MustCompile(`"?(1-0|0-1|1/2-1/2)"?|\[(1\.0|0\.5|0\.0|1|0)\]`)
+	enpassantPattern = regexp.MustCompile(`^(-|[a-h][36])$`)
+)
+
+// Reads positions labelled with the results of their games from a file, one position on each line.
+// A line holds a FEN followed by the result, either as in PGN or in brackets:
+//
+//	rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1 [0.5]
+//	8/5pk1/6p1/3P4/8/6P1/5PK1/8 b - - c9 "1-0";
+//
+// Empty lines and lines starting with # are skipped.
+func LoadTuningPositions(filename string) ([]TuningPosition, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	positions := make([]TuningPosition, 0)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		position, err := parseTuningPosition(line)
+		if err != nil {
+			return nil, fmt.Errorf("func LoadTuningPositions: line %d: %s", n, err)
+		}
+		positions = append(positions, position)
+	}
+	return positions, scanner.Err()
+}
+
+func parseTuningPosition(line string) (TuningPosition, error) {
+	match := resultPattern.FindStringSubmatchIndex(line)
+	if match == nil {
+		return TuningPosition{}, errors.New("no result")
+	}
+	var position TuningPosition
+	switch result := strings.Trim(line[match[0]:match[1]], `"[]`); result {
+	case "1-0", "1.0", "1":
+		position.Result = 1
+	case "0-1", "0.0", "0":
+		position.Result = 0
+	default:
+		position.Result = 0.5
+	}
+	// keep the placement, turn, castling and en passant fields, but not an EPD opcode in their place
+	fields := strings.Fields(line[:match[0]])
+	if len(fields) > 4 {
+		fields = fields[:4]
+	}
+	if len(fields) == 4 && !enpassantPattern.MatchString(fields[3]) {
+		fields = fields[:3]
+	}
+	board, err := engine.FromFen(strings.Join(fields, " "))
+	if err != nil {
+		return TuningPosition{}, err
+	}
+	position.Board = board
+	return position, nil
+}
+
+// Returns the white-relative quiescence score of every position, evaluated with the given weights.
+func tuningScores(positions []TuningPosition, params *Params, threads int) []int {
+	if threads < 1 {
+		threads = 1
+	}
+	scores := make([]int, len(positions))
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// one thread and one pawn table for all of the worker's positions, as the weights do not change
+			evaluator := tuningEvaluator{Classical{Params: params}, newPawnTable()}
+			var t *thread
+			for j := i; j < len(positions); j += threads {
+				if t == nil {
+					t = newThread(context.Background(), positions[j].Board, nil, evaluator)
+					defer t.close()
+				} else {
+					t.reset(positions[j].Board, evaluator)
+				}
+				scores[j] = t.quiescence(BLACKWIN, WHITEWIN, 0, 0)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return scores
+}
+
+// The classical evaluation with one pawn table for every board it is attached to, which holds as long as the
+// weights stay the same.
+type tuningEvaluator struct {
+	Classical
+	pawns *pawnTable
+}
+
+func (e tuningEvaluator) Attach(b *engine.Board) (Evaluator, func()) {
+	return e.attach(b, e.pawns)
+}
+
+// Returns the expected result of a position with a white-relative score, scaled by k.
+func sigmoid(score int, k float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*float64(score)/400))
+}
+
+// Returns the mean squared error of the expected results of the scores, scaled by k.
+func tuningError(positions []TuningPosition, scores []int, k float64) float64 {
+	if len(positions) == 0 {
+		return 0
+	}
+	var sum float64
+	for i, position := range positions {
+		diff := position.Result - sigmoid(scores[i], k)
+		sum += diff * diff
+	}
+	return sum / float64(len(positions))
+}
+
+// Returns the scaling of the sigmoid that best fits the scores to the results, so that the tuner changes the
+// weights relative to each other rather than scaling them all.
+func fitScaling(positions []TuningPosition, scores []int) float64 {
+	best, besterror := 1.0, tuningError(positions, scores, 1)
+	for step := 0.1; step > 0.0005; step /= 10 {
+		for improved := true; improved; {
+			improved = false
+			for _, k := range []float64{best - step, best + step} {
+				if e := tuningError(positions, scores, k); k > 0 && e < besterror {
+					best, besterror, improved = k, e, true
+				}
+			}
+		}
+	}
+	return best
+}
+
+// Tunes the weights on the positions by local search, changing them in place, and returns the final mean squared
+// error. The weights stay within the bounds Params.Validate checks. Save the weights with Params.Save.
+// No search may be using the weights while they are tuned.
+func Tune(positions []TuningPosition, params *Params, opts TuneOptions) float64 {
+	weights := params.selectWeights(opts.Only)
+	scores := tuningScores(positions, params, opts.Threads)
+	k := fitScaling(positions, scores)
+	besterror := tuningError(positions, scores, k)
+	if opts.Step < 1 {
+		opts.Step = 1
+	}
+	for pass := 1; opts.Passes == 0 || pass <= opts.Passes; pass++ {
+		improved := false
+		for _, w := range weights {
+			value := w.get()
+			for _, step := range []int{opts.Step, -opts.Step} {
+				// a step that breaks a bound is reverted like one that does not help, so Save always writes weights
+				// that LoadParams accepts
+				w.set(value + step)
+				if params.Validate() != nil {
+					w.set(value)
+					continue
+				}
+				if e := tuningError(positions, tuningScores(positions, params, opts.Threads), k); e < besterror {
+					besterror, improved = e, true
+					break
+				}
+				w.set(value)
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(pass, besterror)
+		}
+		if !improved {
+			break
+		}
+	}
+	return besterror
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTuningPositions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "positions.epd")
+	data := `# quiet positions
+rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1 [0.5]
+8/5pk1/6p1/3P4/8/6P1/5PK1/8 b - - c9 "1-0";
+
+4k3/8/8/8/8/8/8/R3K3 w - - 0 1 0-1
+`
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	positions, err := LoadTuningPositions(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 3 || positions[0].Result != 0.5 || positions[1].Result != 1 || positions[2].Result != 0 {
+		t.Fatalf("Expected three positions with results 0.5, 1 and 0, got %+v", positions)
+	}
+	if positions[0].Board.Turn != -1 || positions[1].Board.ToFen() != "8/5pk1/6p1/3P4/8/6P1/5PK1/8 b" {
+		t.Error("Positions were read wrong")
+	}
+	if err := os.WriteFile(filename, []byte("4k3/8/8/8/8/8/8/R3K3 w\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTuningPositions(filename); err == nil {
+		t.Error("Expected a position without a result to be rejected")
+	}
+}
+
+func TestTune(t *testing.T) {
+	positions := make([]TuningPosition, 0)
+	for _, line := range []string{
+		"4k3/8/8/8/8/8/8/2B1KB2 w [1.0]",
+		"2b1kb2/8/8/8/8/8/8/4K3 w [0.0]",
+		"4k3/p7/8/8/8/8/8/2N1KB2 w [0.5]",
+		"2n1kb2/8/8/8/8/8/P7/4K3 w [0.5]",
+	} {
+		position, err := parseTuningPosition(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		positions = append(positions, position)
+	}
+	params := DefaultParams()
+	scores := tuningScores(positions, params, 2)
+	// each worker reuses its thread and pawn table, which must not change the scores
+	for i, position := range positions {
+		if score := Quiescence(context.Background(), position.Board, BLACKWIN, WHITEWIN, 0, 0); scores[i] != score {
+			t.Errorf("Expected position %d to score %d, got %d", i, score, scores[i])
+		}
+	}
+	k := fitScaling(positions, scores)
+	before := tuningError(positions, scores, k)
+	var passes int
+	after := Tune(positions, params, TuneOptions{Passes: 2, Step: 10, Only: []string{"BISHOPPAIR"}, Threads: 2, Progress: func(int, float64) { passes++ }})
+	if after >= before || passes != 2 {
+		t.Errorf("Expected two passes to lower the error from %f, got %f after %d passes", before, after, passes)
+	}
+	if params.BishopPair.EG <= BISHOPPAIR.EG || params.IsolatedPawn != ISOLATEDPAWN || defaultParams.BishopPair != BISHOPPAIR {
+		t.Errorf("Expected only the given weights' bishop pair to be tuned, and to be worth more, got %v", params.BishopPair)
+	}
+}
+
+func TestTuneBounds(t *testing.T) {
+	positions := make([]TuningPosition, 0)
+	for _, line := range []string{
+		"2b1k3/pp6/8/8/8/8/PP6/4K1N1 w [1.0]",
+		"4k1n1/pp6/8/8/8/8/PP6/2B1K3 w [0.0]",
+		"4k3/pp6/8/8/8/8/PP6/4K1N1 w [1.0]",
+		"4k1n1/pp6/8/8/8/8/PP6/4K3 w [0.0]",
+	} {
+		position, err := parseTuningPosition(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		positions = append(positions, position)
+	}
+	params := DefaultParams()
+	// the side with the knight wins, so the tuner would lower MOBILITYBASE.n below 0 if nothing stopped it
+	Tune(positions, params, TuneOptions{Step: 2, Only: []string{"MOBILITYBASE.n"}})
+	if params.MobilityBase['n'] != 0 {
+		t.Errorf("Expected MOBILITYBASE.n to be tuned down to 0, got %d", params.MobilityBase['n'])
+	}
+	filename := filepath.Join(t.TempDir(), "params.toml")
+	if err := params.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadParams(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MobilityBase['n'] != params.MobilityBase['n'] {
+		t.Errorf("Expected the saved MOBILITYBASE.n %d to load, got %d", params.MobilityBase['n'], loaded.MobilityBase['n'])
+	}
+}